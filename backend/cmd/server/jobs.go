@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/lingbao-market/backend/internal/config"
+	"github.com/lingbao-market/backend/internal/model"
+	"github.com/lingbao-market/backend/internal/scheduler"
+	"github.com/lingbao-market/backend/internal/service"
+)
+
+const (
+	jobDailyCleanup   = "daily_cleanup"
+	jobBilibiliImport = "bilibili_import"
+	jobFeedExpiry     = "feed_expiry"
+)
+
+type jobDeps struct {
+	svc                *service.PriceService
+	adminSvc           *service.AdminService
+	bilibiliImporter   *service.BilibiliImporter
+	bilibiliImportOpts service.BilibiliImportOptions
+	cfg                *config.Config
+	marketDay          service.MarketDay
+	retention          service.RetentionPolicy
+	feedWindow         time.Duration
+}
+
+func registerJobs(sched *scheduler.Scheduler, deps jobDeps) error {
+	cfg := deps.cfg
+
+	err := sched.Register(scheduler.Job{
+		Name:     jobDailyCleanup,
+		Schedule: fmt.Sprintf("%d %d * * *", deps.marketDay.Minute, deps.marketDay.Hour),
+		Timeout:  time.Minute,
+		Run:      dailyCleanupJob(deps.svc, deps.marketDay, deps.retention),
+	})
+	if err != nil {
+		return err
+	}
+
+	if cfg.BilibiliImportEnabled && deps.bilibiliImporter != nil {
+		timeout := time.Duration(cfg.BilibiliImportTimeoutSeconds) * time.Second
+		if timeout <= 0 {
+			timeout = 60 * time.Second
+		}
+		job := scheduler.Job{
+			Name:     jobBilibiliImport,
+			Schedule: cfg.BilibiliImportSchedule,
+			Timeout:  timeout,
+			Run:      bilibiliImportJob(deps.svc, deps.bilibiliImporter, deps.bilibiliImportOpts),
+		}
+		if job.Schedule == "" {
+			// Refill the feed right after it was wiped.
+			job.After = jobDailyCleanup
+		}
+		if err := sched.Register(job); err != nil {
+			return err
+		}
+	}
+
+	if deps.retention.RollingWindow() {
+		interval := time.Duration(cfg.ExpiryIntervalMinutes) * time.Minute
+		if interval <= 0 {
+			interval = 5 * time.Minute
+		}
+		err := sched.Register(scheduler.Job{
+			Name:     jobFeedExpiry,
+			Schedule: "@every " + interval.String(),
+			Timeout:  30 * time.Second,
+			Run:      feedExpiryJob(deps.svc, deps.adminSvc, deps.feedWindow),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dailyCleanupJob archives the market day that is ending and, under a daily
+// reset policy, wipes the feed.
+func dailyCleanupJob(svc *service.PriceService, day service.MarketDay, retention service.RetentionPolicy) func(context.Context) error {
+	return func(ctx context.Context) error {
+		// Name the day by the reset that opened it, not the one closing it.
+		marketDay := day.Date(time.Now().Add(-time.Minute))
+		archived, err := svc.ArchiveFeed(ctx, marketDay)
+		if err != nil {
+			// Keep the feed rather than lose a day that couldn't be archived.
+			return fmt.Errorf("archive of %s failed: %w", marketDay, err)
+		}
+		log.Printf("Archived %d records for %s", archived, marketDay)
+
+		if !retention.DailyReset() {
+			return nil
+		}
+		// Don't wipe the feed on a run another replica has taken over.
+		removedTime, removedPrice, err := svc.ClearAllPrices(fencedContext(ctx))
+		if err != nil {
+			return fmt.Errorf("cleanup failed: %w", err)
+		}
+		log.Printf("Cleanup finished: removed %d time records, %d price records", removedTime, removedPrice)
+		return nil
+	}
+}
+
+func bilibiliImportJob(svc *service.PriceService, importer *service.BilibiliImporter, opts service.BilibiliImportOptions) func(context.Context) error {
+	return func(ctx context.Context) error {
+		imported, err := importer.ImportHighPriceCodes(fencedContext(ctx), svc, opts)
+		log.Printf("Bilibili import finished: imported %d items", imported)
+		return err
+	}
+}
+
+// fencedContext fences the feed writes of a job run to its lock, so Redis
+// refuses them once another replica has taken the job over.
+func fencedContext(ctx context.Context) context.Context {
+	if lock, ok := scheduler.LockFromContext(ctx); ok {
+		return service.WithFence(ctx, service.Fence{Key: lock.Key(), Token: lock.Token()})
+	}
+	return ctx
+}
+
+// feedExpiryJob drops entries older than the feed window and records each
+// run in the admin log.
+func feedExpiryJob(svc *service.PriceService, adminSvc *service.AdminService, window time.Duration) func(context.Context) error {
+	return func(ctx context.Context) error {
+		cutoff := time.Now().Add(-window)
+		removed, _, err := svc.CleanupExpired(ctx, cutoff)
+
+		entry := model.AdminLogEntry{
+			Type:    "feed_expired",
+			Message: "expired entries removed from market feed",
+			Actor:   "system",
+			Metadata: map[string]string{
+				"cutoff":  strconv.FormatInt(cutoff.UnixMilli(), 10),
+				"removed": strconv.FormatInt(removed, 10),
+			},
+		}
+		if err != nil {
+			entry.Message = "expiring market feed entries failed"
+			entry.Metadata["error"] = err.Error()
+		}
+		logCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if logErr := adminSvc.AppendLog(logCtx, entry); logErr != nil {
+			log.Printf("Failed to log expiry: %v", logErr)
+		}
+		return err
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/lingbao-market/backend/internal/api"
 	"github.com/lingbao-market/backend/internal/config"
+	"github.com/lingbao-market/backend/internal/scheduler"
 	"github.com/lingbao-market/backend/internal/service"
 	"github.com/redis/go-redis/v9"
 )
@@ -42,10 +43,83 @@ func main() {
 	if err := rdb.Ping(ctx).Err(); err != nil {
 		log.Fatalf("Failed to connect to redis: %v", err)
 	}
+	// The feed scripts touch keys they only find while running, which a
+	// cluster can't route.
+	if info, err := rdb.Info(ctx, "cluster").Result(); err == nil && strings.Contains(info, "cluster_enabled:1") {
+		log.Fatalf("Redis Cluster is not supported, point REDIS_ADDR at a single Redis node")
+	}
+
+	cleanupHour, cleanupMinute, err := parseCleanupTime(cfg.CleanupTime)
+	if err != nil {
+		log.Printf("Invalid CLEANUP_TIME %q, falling back to 03:00", cfg.CleanupTime)
+		cleanupHour, cleanupMinute = 3, 0
+	}
+	loc, err := time.LoadLocation(cfg.CleanupTimezone)
+	if err != nil {
+		log.Printf("Invalid CLEANUP_TIMEZONE %q, falling back to Local", cfg.CleanupTimezone)
+		loc = time.Local
+	}
+	marketDay := service.MarketDay{Hour: cleanupHour, Minute: cleanupMinute, Location: loc}
+
+	retention, err := service.ParseRetentionPolicy(cfg.RetentionPolicy)
+	if err != nil {
+		log.Printf("Invalid RETENTION_POLICY %q, falling back to daily_reset", cfg.RetentionPolicy)
+		retention = service.RetentionDailyReset
+	}
+	moderation, err := service.ParseModerationMode(cfg.ModerationMode)
+	if err != nil {
+		log.Printf("Invalid MODERATION_MODE %q, falling back to off", cfg.ModerationMode)
+		moderation = service.ModerationOff
+	}
+	outliers, err := service.ParseOutlierPolicy(cfg.OutlierPolicy)
+	if err != nil {
+		log.Printf("Invalid OUTLIER_POLICY %q, falling back to flag", cfg.OutlierPolicy)
+		outliers = service.OutlierFlag
+	}
+	feedWindow := 24 * time.Hour
+	if retention.RollingWindow() && cfg.RetentionWindowHours > 0 {
+		feedWindow = time.Duration(cfg.RetentionWindowHours) * time.Hour
+	}
 
 	// 3. Init Services
-	svc := service.NewPriceService(rdb)
-	authSvc := service.NewAuthService(rdb, cfg.JWTSecret)
+	svc := service.NewPriceService(rdb, service.PriceServiceOptions{
+		HistoryRetention: time.Duration(cfg.HistoryRetentionDays) * 24 * time.Hour,
+		ArchiveRetention: time.Duration(cfg.ArchiveRetentionDays) * 24 * time.Hour,
+		MarketDay:        marketDay,
+		FeedWindow:       feedWindow,
+		FeedMaxSize:      int64(cfg.FeedMaxSize),
+		DisputeThreshold: int64(cfg.DisputeHideThreshold),
+		Reputation: service.ReputationOptions{
+			TrustedScore: int64(cfg.ReputationTrustedScore),
+			NewScore:     int64(cfg.ReputationNewScore),
+			RegularLimit: int64(cfg.SubmitLimitRegular),
+			NewLimit:     int64(cfg.SubmitLimitNew),
+		},
+		Moderation: moderation,
+		Outliers:   outliers,
+
+		IdempotencyWindow: time.Duration(cfg.IdempotencyWindowHours) * time.Hour,
+	})
+	captcha, err := service.NewCaptchaProvider(rdb, service.CaptchaOptions{
+		Provider:      cfg.CaptchaProvider,
+		VerifyURL:     cfg.CaptchaVerifyURL,
+		Secret:        cfg.CaptchaSecret,
+		SiteKey:       cfg.CaptchaSiteKey,
+		PoWDifficulty: cfg.CaptchaPoWDifficulty,
+	})
+	if err != nil {
+		log.Printf("Invalid captcha configuration (%v), falling back to image", err)
+		captcha = service.NewImageCaptcha(rdb)
+	}
+	authSvc := service.NewAuthService(rdb, cfg.JWTSecret, service.AuthServiceOptions{
+		Captcha:           captcha,
+		CaptchaOnSubmit:   cfg.CaptchaOnSubmit,
+		CaptchaOnFeedback: cfg.CaptchaOnFeedback,
+		AccessTokenTTL:    time.Duration(cfg.AccessTokenTTLMinutes) * time.Minute,
+		RefreshTokenTTL:   time.Duration(cfg.RefreshTokenTTLDays) * 24 * time.Hour,
+		KeyRetireAfter:    time.Duration(cfg.JWTKeyRetireHours) * time.Hour,
+		PasswordResetTTL:  time.Duration(cfg.PasswordResetMinutes) * time.Minute,
+	})
 	adminSvc := service.NewAdminService(rdb)
 
 	if _, err := authSvc.EnsureAdmin(context.Background(), cfg.AdminUsername, cfg.AdminPassword); err != nil {
@@ -61,10 +135,26 @@ func main() {
 	if bilibiliImportTimeout <= 0 {
 		bilibiliImportTimeout = 60 * time.Second
 	}
+	bilibiliImportOpts := service.BilibiliImportOptions{
+		Keyword:        cfg.BilibiliImportKeyword,
+		Limit:          cfg.BilibiliImportLimit,
+		MinPrice:       cfg.BilibiliImportMinPrice,
+		SearchPages:    cfg.BilibiliImportSearchPages,
+		SearchPageSize: cfg.BilibiliImportSearchPageSize,
+		CommentPages:   cfg.BilibiliImportCommentPages,
+	}
+
+	sched := scheduler.New(rdb, loc)
 
 	// 4. Init Fiber
+	// Only a trusted proxy may tell us the client's address; anyone else
+	// could pick a fresh IP, and so a fresh rate-limit bucket, per request.
 	app := fiber.New(fiber.Config{
-		AppName: "Lingbao Market Backend",
+		AppName:                 "Lingbao Market Backend",
+		ProxyHeader:             cfg.ProxyHeader,
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          parseList(cfg.TrustedProxies),
+		EnableIPValidation:      true,
 	})
 
 	// 4. Middleware
@@ -77,28 +167,22 @@ func main() {
 			if c.Method() == fiber.MethodOptions {
 				return true
 			}
-			if c.Method() == fiber.MethodGet && c.Path() == "/api/v1/feed" {
+			// Plain feed reads are cheap; filtered ones build intersections
+			// in Redis and count against the limit. Streams are capped per
+			// IP in the handler.
+			if c.Method() == fiber.MethodGet && c.Path() == "/api/v1/feed" && !api.FeedFiltered(c) {
 				return true
 			}
-			return false
-		},
-		KeyGenerator: func(c *fiber.Ctx) string {
-			xff := strings.TrimSpace(c.Get(fiber.HeaderXForwardedFor))
-			if xff != "" {
-				parts := strings.Split(xff, ",")
-				if len(parts) > 0 {
-					ip := strings.TrimSpace(parts[0])
-					if ip != "" {
-						return ip
-					}
-				}
+			if c.Method() == fiber.MethodGet && c.Path() == "/api/v1/feed/stream" {
+				return true
 			}
-			xri := strings.TrimSpace(c.Get("X-Real-IP"))
-			if xri != "" {
-				return xri
+			// Submissions are limited per submitter tier in the handler.
+			if c.Method() == fiber.MethodPost && (c.Path() == "/api/v1/submit" || c.Path() == "/api/v1/submit/batch") {
+				return true
 			}
-			return c.IP()
+			return false
 		},
+		KeyGenerator: api.ClientIP,
 		LimitReached: func(c *fiber.Ctx) error {
 			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
 				"error": "Too many requests, please try again later.",
@@ -106,9 +190,10 @@ func main() {
 		},
 	}))
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: "*", // Lock down in production
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
-		AllowMethods: "GET,POST,PUT,PATCH,DELETE,OPTIONS",
+		AllowOrigins:  "*", // Lock down in production
+		AllowHeaders:  "Origin, Content-Type, Accept, Authorization, Last-Event-ID, X-Submitter-Token, Idempotency-Key, X-Captcha-Id, X-Captcha-Answer",
+		AllowMethods:  "GET,POST,PUT,PATCH,DELETE,OPTIONS",
+		ExposeHeaders: "X-Submitter-Token",
 	}))
 
 	// 5. Routes
@@ -116,34 +201,30 @@ func main() {
 		svc,
 		authSvc,
 		adminSvc,
+		sched,
 		bilibiliImporter,
-		service.BilibiliImportOptions{
-			Keyword:        cfg.BilibiliImportKeyword,
-			Limit:          cfg.BilibiliImportLimit,
-			MinPrice:       cfg.BilibiliImportMinPrice,
-			SearchPages:    cfg.BilibiliImportSearchPages,
-			SearchPageSize: cfg.BilibiliImportSearchPageSize,
-			CommentPages:   cfg.BilibiliImportCommentPages,
-		},
+		bilibiliImportOpts,
 		bilibiliImportTimeout,
-		cfg.JWTSecret,
+		cfg.StreamMaxPerIP,
 	)
 	h.RegisterRoutes(app)
 
-	// 6. Schedule daily cleanup
-	cleanupCtx, cleanupCancel := context.WithCancel(context.Background())
-	defer cleanupCancel()
-	cleanupHour, cleanupMinute, err := parseCleanupTime(cfg.CleanupTime)
-	if err != nil {
-		log.Printf("Invalid CLEANUP_TIME %q, falling back to 03:00", cfg.CleanupTime)
-		cleanupHour, cleanupMinute = 3, 0
-	}
-	loc, err := time.LoadLocation(cfg.CleanupTimezone)
-	if err != nil {
-		log.Printf("Invalid CLEANUP_TIMEZONE %q, falling back to Local", cfg.CleanupTimezone)
-		loc = time.Local
+	// 6. Schedule background jobs
+	jobsCtx, jobsCancel := context.WithCancel(context.Background())
+	defer jobsCancel()
+	if err := registerJobs(sched, jobDeps{
+		svc:                svc,
+		adminSvc:           adminSvc,
+		bilibiliImporter:   bilibiliImporter,
+		bilibiliImportOpts: bilibiliImportOpts,
+		cfg:                cfg,
+		marketDay:          marketDay,
+		retention:          retention,
+		feedWindow:         feedWindow,
+	}); err != nil {
+		log.Fatalf("Failed to register jobs: %v", err)
 	}
-	go scheduleDailyCleanup(cleanupCtx, svc, bilibiliImporter, cfg, cleanupHour, cleanupMinute, loc)
+	sched.Start(jobsCtx)
 
 	// 6. Start Server
 	go func() {
@@ -159,61 +240,13 @@ func main() {
 	<-c
 
 	log.Println("Gracefully shutting down...")
-	cleanupCancel()
-	if err := app.Shutdown(); err != nil {
+	jobsCancel()
+	// Open event streams never go idle, so don't wait on them forever.
+	if err := app.ShutdownWithTimeout(10 * time.Second); err != nil {
 		log.Printf("Error shutting down: %v", err)
 	}
 }
 
-func scheduleDailyCleanup(ctx context.Context, svc *service.PriceService, bilibiliImporter *service.BilibiliImporter, cfg *config.Config, hour, minute int, loc *time.Location) {
-	for {
-		now := time.Now().In(loc)
-		next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, loc)
-		if !next.After(now) {
-			next = next.Add(24 * time.Hour)
-		}
-
-		timer := time.NewTimer(time.Until(next))
-		select {
-		case <-ctx.Done():
-			timer.Stop()
-			return
-		case <-timer.C:
-			cleanupCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-			removedTime, removedPrice, err := svc.ClearAllPrices(cleanupCtx)
-			cancel()
-			if err != nil {
-				log.Printf("Cleanup failed: %v", err)
-			} else {
-				log.Printf("Cleanup finished: removed %d time records, %d price records", removedTime, removedPrice)
-			}
-
-			if err == nil && cfg != nil && cfg.BilibiliImportEnabled && bilibiliImporter != nil {
-				timeout := time.Duration(cfg.BilibiliImportTimeoutSeconds) * time.Second
-				if timeout <= 0 {
-					timeout = 60 * time.Second
-				}
-
-				importCtx, importCancel := context.WithTimeout(context.Background(), timeout)
-				imported, importErr := bilibiliImporter.ImportHighPriceCodes(importCtx, svc, service.BilibiliImportOptions{
-					Keyword:        cfg.BilibiliImportKeyword,
-					Limit:          cfg.BilibiliImportLimit,
-					MinPrice:       cfg.BilibiliImportMinPrice,
-					SearchPages:    cfg.BilibiliImportSearchPages,
-					SearchPageSize: cfg.BilibiliImportSearchPageSize,
-					CommentPages:   cfg.BilibiliImportCommentPages,
-				})
-				importCancel()
-
-				if importErr != nil {
-					log.Printf("Bilibili import warning: %v", importErr)
-				}
-				log.Printf("Bilibili import finished: imported %d items", imported)
-			}
-		}
-	}
-}
-
 func parseCleanupTime(value string) (int, int, error) {
 	parsed, err := time.Parse("15:04", value)
 	if err != nil {
@@ -221,3 +254,14 @@ func parseCleanupTime(value string) (int, int, error) {
 	}
 	return parsed.Hour(), parsed.Minute(), nil
 }
+
+// parseList splits a comma-separated config value, dropping empty entries.
+func parseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
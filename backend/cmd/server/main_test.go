@@ -1,6 +1,9 @@
 package main
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestParseCleanupTime(t *testing.T) {
 	t.Parallel()
@@ -32,3 +35,15 @@ func TestParseCleanupTime(t *testing.T) {
 		}
 	})
 }
+
+func TestParseList(t *testing.T) {
+	t.Parallel()
+
+	got := parseList(" 127.0.0.1, ,10.0.0.0/8,")
+	if want := []string{"127.0.0.1", "10.0.0.0/8"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if got := parseList(""); len(got) != 0 {
+		t.Fatalf("expected no entries, got %v", got)
+	}
+}
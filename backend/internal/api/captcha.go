@@ -0,0 +1,51 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// Endpoints other than login and register take the captcha in headers, so
+// the request body (and its idempotency fingerprint) stays the same across
+// retries.
+const (
+	headerCaptchaID     = "X-Captcha-Id"
+	headerCaptchaAnswer = "X-Captcha-Answer"
+)
+
+// captchaMiddleware asks for a solved captcha on an endpoint when the scope
+// is enabled. Admins are never asked.
+func (h *Handler) captchaMiddleware(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !h.authSvc.CaptchaRequired(scope) {
+			return c.Next()
+		}
+		if who, err := h.submitterFromRequest(c); err == nil && who.Admin {
+			return c.Next()
+		}
+
+		if ok, err := h.checkCaptchaHeaders(c); !ok {
+			return err
+		}
+		return c.Next()
+	}
+}
+
+// checkCaptchaHeaders verifies the captcha sent in the request headers. When
+// it fails, the error response has already been written and is returned.
+func (h *Handler) checkCaptchaHeaders(c *fiber.Ctx) (bool, error) {
+	ok, err := h.authSvc.VerifyCaptcha(c.Context(), c.Get(headerCaptchaID), c.Get(headerCaptchaAnswer), ClientIP(c))
+	if err != nil {
+		c.Locals("captchaRejected", true)
+		return false, c.Status(500).JSON(fiber.Map{"error": "captcha verification failed"})
+	}
+	if !ok {
+		c.Locals("captchaRejected", true)
+		return false, c.Status(400).JSON(fiber.Map{"error": "invalid captcha"})
+	}
+	return true, nil
+}
+
+func captchaRejected(c *fiber.Ctx) bool {
+	rejected, _ := c.Locals("captchaRejected").(bool)
+	return rejected
+}
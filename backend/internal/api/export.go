@@ -0,0 +1,226 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lingbao-market/backend/internal/model"
+	"github.com/lingbao-market/backend/internal/service"
+)
+
+const exportTimeout = 5 * time.Minute
+
+var exportCSVHeader = []string{"code", "price", "server", "source", "ts", "firstSeen", "submissions", "servers"}
+
+// exportEncoder writes entries in one export format.
+type exportEncoder interface {
+	begin() error
+	write(items []model.PriceItem) error
+	end() error
+}
+
+// ExportFeed streams every live entry matching the feed filters as csv, json
+// or ndjson, in the requested sort order.
+func (h *Handler) ExportFeed(c *fiber.Ctx) error {
+	filter, err := parseFeedFilter(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	sortBy := c.Query("sort", "time")
+	name := "feed-" + time.Now().Format("20060102-150405")
+
+	return h.streamExport(c, name, func(ctx context.Context, emit func([]model.PriceItem) error) error {
+		return h.svc.ExportFeed(ctx, sortBy, filter, emit)
+	})
+}
+
+// ExportArchive streams an archived market day like ExportFeed.
+func (h *Handler) ExportArchive(c *fiber.Ctx) error {
+	filter, err := parseFeedFilter(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	date := strings.TrimSpace(c.Params("date"))
+	exists, err := h.svc.ArchiveExists(c.Context(), date)
+	if errors.Is(err, service.ErrInvalidArchiveDate) {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid date"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch archive"})
+	}
+	if !exists {
+		return c.Status(404).JSON(fiber.Map{"error": "archive not found"})
+	}
+	sortBy := c.Query("sort", "time")
+
+	return h.streamExport(c, "archive-"+date, func(ctx context.Context, emit func([]model.PriceItem) error) error {
+		return h.svc.ExportArchive(ctx, date, sortBy, filter, emit)
+	})
+}
+
+func (h *Handler) streamExport(c *fiber.Ctx, name string, run func(context.Context, func([]model.PriceItem) error) error) error {
+	format := strings.ToLower(strings.TrimSpace(c.Query("format", "csv")))
+	var contentType string
+	switch format {
+	case "csv":
+		contentType = "text/csv; charset=utf-8"
+	case "json":
+		contentType = fiber.MIMEApplicationJSONCharsetUTF8
+	case "ndjson":
+		contentType = "application/x-ndjson"
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "invalid format"})
+	}
+
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.%s"`, name, format))
+	c.Set("X-Accel-Buffering", "no")
+
+	// The body is written after the handler returns, so the export can't use
+	// the request context.
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+		defer cancel()
+
+		enc := newExportEncoder(format, w)
+		if err := enc.begin(); err != nil {
+			return
+		}
+		err := run(ctx, func(items []model.PriceItem) error {
+			if err := enc.write(items); err != nil {
+				return err
+			}
+			return w.Flush()
+		})
+		if err != nil {
+			// Headers are gone by now; a truncated body is all the client sees.
+			log.Printf("Export %s failed: %v", name, err)
+			return
+		}
+		if err := enc.end(); err == nil {
+			_ = w.Flush()
+		}
+	})
+	return nil
+}
+
+func newExportEncoder(format string, w *bufio.Writer) exportEncoder {
+	switch format {
+	case "json":
+		return &jsonExportEncoder{w: w}
+	case "ndjson":
+		return &ndjsonExportEncoder{w: w}
+	default:
+		return &csvExportEncoder{w: csv.NewWriter(w)}
+	}
+}
+
+type csvExportEncoder struct {
+	w *csv.Writer
+}
+
+func (e *csvExportEncoder) begin() error {
+	return e.w.Write(exportCSVHeader)
+}
+
+func (e *csvExportEncoder) write(items []model.PriceItem) error {
+	for _, item := range items {
+		record := []string{
+			item.Code,
+			strconv.FormatFloat(item.Price, 'f', -1, 64),
+			item.Server,
+			item.Source,
+			formatExportTime(item.Timestamp),
+			formatExportTime(item.FirstSeen),
+			strconv.FormatInt(item.Submissions, 10),
+			strings.Join(item.Servers, "|"),
+		}
+		if err := e.w.Write(record); err != nil {
+			return err
+		}
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvExportEncoder) end() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// jsonExportEncoder writes a single array, one element at a time.
+type jsonExportEncoder struct {
+	w       *bufio.Writer
+	written bool
+}
+
+func (e *jsonExportEncoder) begin() error {
+	return e.w.WriteByte('[')
+}
+
+func (e *jsonExportEncoder) write(items []model.PriceItem) error {
+	for _, item := range items {
+		raw, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		if e.written {
+			if err := e.w.WriteByte(','); err != nil {
+				return err
+			}
+		}
+		e.written = true
+		if _, err := e.w.Write(raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *jsonExportEncoder) end() error {
+	return e.w.WriteByte(']')
+}
+
+type ndjsonExportEncoder struct {
+	w *bufio.Writer
+}
+
+func (e *ndjsonExportEncoder) begin() error {
+	return nil
+}
+
+func (e *ndjsonExportEncoder) write(items []model.PriceItem) error {
+	for _, item := range items {
+		raw, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		if _, err := e.w.Write(raw); err != nil {
+			return err
+		}
+		if err := e.w.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *ndjsonExportEncoder) end() error {
+	return nil
+}
+
+func formatExportTime(millis int64) string {
+	if millis <= 0 {
+		return ""
+	}
+	return time.UnixMilli(millis).UTC().Format(time.RFC3339)
+}
@@ -3,46 +3,52 @@ package api
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/url"
 	"strconv"
 	"strings"
 	"time"
-	"unicode"
-	"unicode/utf8"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/lingbao-market/backend/internal/model"
+	"github.com/lingbao-market/backend/internal/scheduler"
 	"github.com/lingbao-market/backend/internal/service"
 )
 
+var msgPasswordTooShort = fmt.Sprintf("password min %d chars", service.MinPasswordLength)
+
 type Handler struct {
 	svc                   *service.PriceService
 	authSvc               *service.AuthService
 	adminSvc              *service.AdminService
+	scheduler             *scheduler.Scheduler
 	bilibiliImporter      *service.BilibiliImporter
 	bilibiliImportOpts    service.BilibiliImportOptions
 	bilibiliImportTimeout time.Duration
-	jwtKey                []byte
+	streams               *streamLimiter
 }
 
 func NewHandler(
 	svc *service.PriceService,
 	authSvc *service.AuthService,
 	adminSvc *service.AdminService,
+	sched *scheduler.Scheduler,
 	bilibiliImporter *service.BilibiliImporter,
 	bilibiliImportOpts service.BilibiliImportOptions,
 	bilibiliImportTimeout time.Duration,
-	jwtKey string,
+	maxStreamsPerIP int,
 ) *Handler {
 	return &Handler{
 		svc:                   svc,
 		authSvc:               authSvc,
 		adminSvc:              adminSvc,
+		scheduler:             sched,
 		bilibiliImporter:      bilibiliImporter,
 		bilibiliImportOpts:    bilibiliImportOpts,
 		bilibiliImportTimeout: bilibiliImportTimeout,
-		jwtKey:                []byte(jwtKey),
+		streams:               newStreamLimiter(maxStreamsPerIP),
 	}
 }
 
@@ -51,26 +57,68 @@ func (h *Handler) RegisterRoutes(app *fiber.App) {
 
 	// Public
 	api.Get("/feed", h.GetFeed)
+	api.Get("/feed/stream", h.StreamFeed)
+	api.Get("/feed/export", h.ExportFeed)
+	api.Get("/ws", h.WebSocketUpgrade, websocket.New(h.HandleWebSocket))
+	api.Get("/codes/:code/history", h.GetCodeHistory)
+	api.Post("/codes/:code/votes", h.VoteCode)
+	api.Get("/leaderboard", h.GetLeaderboard)
+	api.Get("/archive/:date", h.GetArchive)
+	api.Get("/archive/:date/export", h.ExportArchive)
+	api.Get("/stats", h.GetStats)
 	api.Get("/auth/captcha", h.GetCaptcha)
 	api.Post("/auth/register", h.Register)
 	api.Post("/auth/login", h.Login)
-	api.Post("/feedback", h.SubmitFeedback)
+	api.Post("/auth/refresh", h.RefreshToken)
+	api.Post("/auth/logout", h.Logout)
+	api.Post("/auth/password-reset", h.ResetPassword)
+	api.Post("/feedback", h.captchaMiddleware(service.CaptchaScopeFeedback), h.SubmitFeedback)
 
 	// Public (login not required)
-	api.Post("/submit", h.SubmitPrice)
+	submitCaptcha := h.captchaMiddleware(service.CaptchaScopeSubmit)
+	api.Post("/submit", h.idempotencyMiddleware, submitCaptcha, h.SubmitPrice)
+	api.Post("/submit/batch", h.idempotencyMiddleware, submitCaptcha, h.SubmitPriceBatch)
 	// api.Post("/submit", h.authMiddleware, h.SubmitPrice) // Keep for reuse
 
+	me := api.Group("/me", h.submitterMiddleware)
+	me.Get("/submissions", h.ListMySubmissions)
+	me.Get("/reputation", h.GetMyReputation)
+	me.Patch("/submissions/:id", h.UpdateMySubmission)
+	me.Delete("/submissions/:id", h.DeleteMySubmission)
+	me.Post("/password", h.authMiddleware, h.ChangePassword)
+
 	// Admin
 	admin := api.Group("/admin", h.authMiddleware, h.adminMiddleware)
 	admin.Get("/users", h.ListUsers)
 	admin.Post("/users", h.CreateUser)
 	admin.Patch("/users/:username/ban", h.SetUserBan)
+	admin.Post("/users/:username/revoke-tokens", h.RevokeUserTokens)
+	admin.Post("/users/:username/reset-password", h.CreatePasswordReset)
+	admin.Get("/keys", h.ListSigningKeys)
+	admin.Post("/keys/rotate", h.RotateSigningKey)
 	admin.Delete("/users/:username", h.DeleteUser)
 	admin.Delete("/prices/:code", h.DeletePriceByCode)
+	admin.Get("/submissions/:id", h.GetSubmission)
+	admin.Patch("/submissions/:id", h.UpdateSubmission)
+	admin.Delete("/submissions/:id", h.DeleteSubmission)
+	admin.Get("/codes/hidden", h.ListHiddenCodes)
+	admin.Post("/codes/:code/restore", h.RestoreCode)
+	admin.Get("/codes/:code/submissions", h.ListCodeSubmissions)
+	admin.Get("/archives", h.ListArchives)
 	admin.Get("/feedback", h.ListFeedback)
 	admin.Post("/feedback/:id/resolve", h.ResolveFeedback)
 	admin.Get("/logs", h.ListLogs)
 	admin.Post("/imports/bilibili", h.TriggerBilibiliImport)
+	admin.Get("/flagged", h.ListFlagged)
+	admin.Get("/moderation", h.ListPending)
+	admin.Post("/moderation/approve", h.BulkApprovePending)
+	admin.Post("/moderation/:id/approve", h.ApprovePending)
+	admin.Post("/moderation/:id/reject", h.RejectPending)
+	admin.Get("/metrics", h.GetMetrics)
+	admin.Get("/jobs", h.ListJobs)
+	admin.Post("/jobs/:name/run", h.TriggerJob)
+	admin.Post("/jobs/:name/pause", h.PauseJob)
+	admin.Post("/jobs/:name/resume", h.ResumeJob)
 }
 
 func (h *Handler) Register(c *fiber.Ctx) error {
@@ -81,10 +129,10 @@ func (h *Handler) Register(c *fiber.Ctx) error {
 	req.Username = strings.TrimSpace(req.Username)
 	req.CaptchaID = strings.TrimSpace(req.CaptchaID)
 	req.CaptchaCode = strings.TrimSpace(req.CaptchaCode)
-	if len(req.Username) < 3 || len(req.Password) < 6 {
-		return c.Status(400).JSON(fiber.Map{"error": "username min 3 chars, password min 6 chars"})
+	if len(req.Username) < 3 || len(req.Password) < service.MinPasswordLength {
+		return c.Status(400).JSON(fiber.Map{"error": "username min 3 chars, " + msgPasswordTooShort})
 	}
-	if ok, err := h.authSvc.VerifyCaptcha(c.Context(), req.CaptchaID, req.CaptchaCode); err != nil {
+	if ok, err := h.authSvc.VerifyCaptcha(c.Context(), req.CaptchaID, req.CaptchaCode, ClientIP(c)); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "captcha verification failed"})
 	} else if !ok {
 		return c.Status(400).JSON(fiber.Map{"error": "invalid captcha"})
@@ -94,7 +142,6 @@ func (h *Handler) Register(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
-	_ = h.authSvc.DeleteCaptcha(c.Context(), req.CaptchaID)
 
 	return c.Status(201).JSON(fiber.Map{"id": user.ID, "username": user.Username})
 }
@@ -107,7 +154,7 @@ func (h *Handler) Login(c *fiber.Ctx) error {
 	req.Username = strings.TrimSpace(req.Username)
 	req.CaptchaID = strings.TrimSpace(req.CaptchaID)
 	req.CaptchaCode = strings.TrimSpace(req.CaptchaCode)
-	if ok, err := h.authSvc.VerifyCaptcha(c.Context(), req.CaptchaID, req.CaptchaCode); err != nil {
+	if ok, err := h.authSvc.VerifyCaptcha(c.Context(), req.CaptchaID, req.CaptchaCode, ClientIP(c)); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "captcha verification failed"})
 	} else if !ok {
 		return c.Status(400).JSON(fiber.Map{"error": "invalid captcha"})
@@ -117,69 +164,296 @@ func (h *Handler) Login(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(401).JSON(fiber.Map{"error": "invalid credentials"})
 	}
-	_ = h.authSvc.DeleteCaptcha(c.Context(), req.CaptchaID)
 
 	return c.JSON(resp)
 }
 
+// ChangePassword sets a new password for the signed-in user. Other sessions
+// are signed out; the response carries a fresh token pair for this one.
+func (h *Handler) ChangePassword(c *fiber.Ctx) error {
+	var req model.ChangePasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request"})
+	}
+	username := h.actorFromCtx(c)
+
+	resp, err := h.authSvc.ChangePassword(c.Context(), username, req.CurrentPassword, req.NewPassword)
+	if errors.Is(err, service.ErrWeakPassword) {
+		return c.Status(400).JSON(fiber.Map{"error": msgPasswordTooShort})
+	}
+	if errors.Is(err, service.ErrInvalidCredentials) {
+		return c.Status(403).JSON(fiber.Map{"error": "current password is incorrect"})
+	}
+	if errors.Is(err, service.ErrAccountBanned) {
+		return c.Status(403).JSON(fiber.Map{"error": "account banned"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to change password"})
+	}
+
+	_ = h.adminSvc.AppendLog(c.Context(), model.AdminLogEntry{
+		Type:    "password_changed",
+		Message: "user changed their password",
+		Actor:   username,
+		Metadata: map[string]string{
+			"username": username,
+		},
+	})
+	return c.JSON(resp)
+}
+
+// ResetPassword redeems a reset token issued by an admin.
+func (h *Handler) ResetPassword(c *fiber.Ctx) error {
+	var req model.ResetPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request"})
+	}
+
+	username, err := h.authSvc.ResetPassword(c.Context(), strings.TrimSpace(req.Token), req.NewPassword)
+	if errors.Is(err, service.ErrWeakPassword) {
+		return c.Status(400).JSON(fiber.Map{"error": msgPasswordTooShort})
+	}
+	if errors.Is(err, service.ErrInvalidResetToken) {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid or expired reset token"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to reset password"})
+	}
+
+	_ = h.adminSvc.AppendLog(c.Context(), model.AdminLogEntry{
+		Type:    "password_reset_completed",
+		Message: "user set a new password with a reset token",
+		Actor:   username,
+		Metadata: map[string]string{
+			"username": username,
+		},
+	})
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+// RefreshToken trades a refresh token for a new token pair. Each refresh
+// token works once.
+func (h *Handler) RefreshToken(c *fiber.Ctx) error {
+	var req model.RefreshRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request"})
+	}
+
+	resp, err := h.authSvc.RefreshTokens(c.Context(), strings.TrimSpace(req.RefreshToken))
+	if errors.Is(err, service.ErrAccountBanned) {
+		return c.Status(403).JSON(fiber.Map{"error": "account banned"})
+	}
+	if errors.Is(err, service.ErrRefreshTokenReused) {
+		return c.Status(401).JSON(fiber.Map{"error": "refresh token reused, all sessions revoked"})
+	}
+	if errors.Is(err, service.ErrInvalidRefreshToken) || errors.Is(err, service.ErrTokenRevoked) || errors.Is(err, service.ErrInvalidToken) {
+		return c.Status(401).JSON(fiber.Map{"error": "invalid refresh token"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to refresh token"})
+	}
+	return c.JSON(resp)
+}
+
+// Logout drops a refresh token, or with all set every session of its user.
+func (h *Handler) Logout(c *fiber.Ctx) error {
+	var req model.LogoutRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request"})
+	}
+	if err := h.authSvc.Logout(c.Context(), strings.TrimSpace(req.RefreshToken), req.All); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to log out"})
+	}
+	return c.SendStatus(204)
+}
+
 func (h *Handler) GetCaptcha(c *fiber.Ctx) error {
-	id, code, err := h.authSvc.CreateCaptcha(c.Context())
+	challenge, err := h.authSvc.CreateCaptcha(c.Context())
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "failed to create captcha"})
 	}
-	return c.JSON(fiber.Map{"captchaId": id, "code": code})
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(challenge)
 }
 
 func (h *Handler) GetFeed(c *fiber.Ctx) error {
-	sortBy := c.Query("sort", "time") // Default to time
-	prices, err := h.svc.GetLatestFeed(c.Context(), 50, sortBy)
+	limit := c.QueryInt("limit", service.FeedDefaultLimit)
+	if limit <= 0 || limit > service.FeedMaxLimit {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid limit"})
+	}
+
+	filter, err := parseFeedFilter(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	page, err := h.svc.GetFeed(c.Context(), service.FeedQuery{
+		Sort:   c.Query("sort", "time"), // Default to time
+		Limit:  int64(limit),
+		Cursor: strings.TrimSpace(c.Query("cursor")),
+		Filter: filter,
+	})
+	if errors.Is(err, service.ErrInvalidCursor) {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid cursor"})
+	}
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch feed"})
 	}
-	return c.JSON(prices)
+	return c.JSON(page)
 }
 
-func (h *Handler) SubmitPrice(c *fiber.Ctx) error {
-	// User ID from middleware (optional usage)
-	// claims := c.Locals("user").(jwt.MapClaims)
-	// userID := claims["sub"].(string)
+// parseFeedFilter reads the feed filter query parameters. since accepts unix
+// milliseconds or an RFC 3339 timestamp.
+func parseFeedFilter(c *fiber.Ctx) (service.FeedFilter, error) {
+	filter := service.FeedFilter{
+		Server:     strings.TrimSpace(c.Query("server")),
+		CodePrefix: strings.TrimSpace(c.Query("codePrefix")),
+	}
 
-	var req model.SubmitRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "invalid request"})
+	if raw := strings.TrimSpace(c.Query("minPrice")); raw != "" {
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil || value < 0 {
+			return filter, errors.New("invalid minPrice")
+		}
+		filter.MinPrice = value
+	}
+	if raw := strings.TrimSpace(c.Query("maxPrice")); raw != "" {
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil || value <= 0 {
+			return filter, errors.New("invalid maxPrice")
+		}
+		filter.MaxPrice = value
+	}
+	if filter.MaxPrice > 0 && filter.MinPrice > filter.MaxPrice {
+		return filter, errors.New("minPrice greater than maxPrice")
 	}
 
-	req.Code = strings.TrimSpace(req.Code)
-	req.Code = strings.Join(strings.Fields(req.Code), "")
-	req.Code = strings.ToUpper(req.Code)
+	if raw := strings.TrimSpace(c.Query("since")); raw != "" {
+		ts, ok := parseTimeParam(raw)
+		if !ok {
+			return filter, errors.New("invalid since")
+		}
+		filter.Since = ts.UnixMilli()
+	}
 
-	if req.Code == "" || req.Price <= 0 {
-		return c.Status(400).JSON(fiber.Map{"error": "invalid data"})
+	return filter, nil
+}
+
+// FeedFiltered reports whether a feed request carries any filter.
+func FeedFiltered(c *fiber.Ctx) bool {
+	for _, param := range []string{"server", "codePrefix", "minPrice", "maxPrice", "since"} {
+		if strings.TrimSpace(c.Query(param)) != "" {
+			return true
+		}
 	}
+	return false
+}
 
-	// Validate Code Format (letters/digits incl. Chinese, 3-12 chars)
-	runeCount := utf8.RuneCountInString(req.Code)
-	if runeCount < 3 || runeCount > 12 {
-		return c.Status(400).JSON(fiber.Map{"error": "invalid code format"})
+// parseTimeParam accepts unix milliseconds or an RFC 3339 timestamp.
+func parseTimeParam(raw string) (time.Time, bool) {
+	if millis, err := strconv.ParseInt(raw, 10, 64); err == nil && millis >= 0 {
+		return time.UnixMilli(millis), true
 	}
-	for _, r := range req.Code {
-		if unicode.IsLetter(r) || unicode.IsDigit(r) {
-			continue
-		}
-		return c.Status(400).JSON(fiber.Map{"error": "invalid code format"})
+	if ts, err := time.Parse(time.RFC3339, raw); err == nil {
+		return ts, true
 	}
+	return time.Time{}, false
+}
 
-	item := model.PriceItem{
-		Code:   req.Code,
-		Price:  req.Price,
-		Server: req.Server,
+func (h *Handler) GetCodeHistory(c *fiber.Ctx) error {
+	code := strings.TrimSpace(c.Params("code"))
+	if decoded, err := url.PathUnescape(code); err == nil {
+		code = strings.TrimSpace(decoded)
 	}
+	if code == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "missing code"})
+	}
+
+	history, err := h.svc.GetHistory(c.Context(), code)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch history"})
+	}
+	return c.JSON(history)
+}
 
-	if err := h.svc.AddPrice(c.Context(), item); err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "failed to submit"})
+// GetArchive pages through an archived market day (YYYY-MM-DD) with the same
+// sort, limit and cursor parameters as GetFeed.
+func (h *Handler) GetArchive(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", service.FeedDefaultLimit)
+	if limit <= 0 || limit > service.FeedMaxLimit {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid limit"})
 	}
 
-	return c.Status(201).JSON(fiber.Map{"status": "ok"})
+	page, err := h.svc.GetArchive(c.Context(), strings.TrimSpace(c.Params("date")), service.FeedQuery{
+		Sort:   c.Query("sort", "time"),
+		Limit:  int64(limit),
+		Cursor: strings.TrimSpace(c.Query("cursor")),
+	})
+	if errors.Is(err, service.ErrInvalidArchiveDate) {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid date"})
+	}
+	if errors.Is(err, service.ErrInvalidCursor) {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid cursor"})
+	}
+	if errors.Is(err, service.ErrArchiveNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "archive not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch archive"})
+	}
+	return c.JSON(page)
+}
+
+// GetStats reports market statistics for the current market day, a past one
+// (date=YYYY-MM-DD), or an explicit from/to range.
+func (h *Handler) GetStats(c *fiber.Ctx) error {
+	day := h.svc.MarketDay()
+	now := time.Now()
+	from, to := day.Start(now), now
+
+	if date := strings.TrimSpace(c.Query("date")); date != "" {
+		start, end, err := day.Bounds(date)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid date"})
+		}
+		from, to = start, end
+	}
+	if raw := strings.TrimSpace(c.Query("from")); raw != "" {
+		ts, ok := parseTimeParam(raw)
+		if !ok {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid from"})
+		}
+		from = ts
+	}
+	if raw := strings.TrimSpace(c.Query("to")); raw != "" {
+		ts, ok := parseTimeParam(raw)
+		if !ok {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid to"})
+		}
+		to = ts
+	}
+
+	stats, err := h.svc.GetStats(c.Context(), from, to)
+	if errors.Is(err, service.ErrInvalidStatsRange) {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid range"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch stats"})
+	}
+	return c.JSON(stats)
+}
+
+// GetMetrics reports this instance's in-process counters.
+func (h *Handler) GetMetrics(c *fiber.Ctx) error {
+	return c.JSON(model.ServiceMetrics{SideEffectFailures: h.svc.SideEffectFailures()})
+}
+
+func (h *Handler) ListArchives(c *fiber.Ctx) error {
+	days, err := h.svc.ListArchives(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to list archives"})
+	}
+	return c.JSON(days)
 }
 
 func (h *Handler) ListUsers(c *fiber.Ctx) error {
@@ -188,13 +462,23 @@ func (h *Handler) ListUsers(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"error": "failed to list users"})
 	}
 
+	ids := make([]string, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.ID)
+	}
+	scores, err := h.svc.ReputationScores(c.Context(), ids)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to list users"})
+	}
+
 	resp := make([]model.UserPublic, 0, len(users))
 	for _, user := range users {
 		resp = append(resp, model.UserPublic{
-			ID:       user.ID,
-			Username: user.Username,
-			IsAdmin:  user.IsAdmin,
-			Banned:   user.Banned,
+			ID:         user.ID,
+			Username:   user.Username,
+			IsAdmin:    user.IsAdmin,
+			Banned:     user.Banned,
+			Reputation: scores[user.ID],
 		})
 	}
 	return c.JSON(resp)
@@ -210,8 +494,8 @@ func (h *Handler) CreateUser(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "invalid request"})
 	}
 	payload.Username = strings.TrimSpace(payload.Username)
-	if len(payload.Username) < 3 || len(payload.Password) < 6 {
-		return c.Status(400).JSON(fiber.Map{"error": "username min 3 chars, password min 6 chars"})
+	if len(payload.Username) < 3 || len(payload.Password) < service.MinPasswordLength {
+		return c.Status(400).JSON(fiber.Map{"error": "username min 3 chars, " + msgPasswordTooShort})
 	}
 
 	user, err := h.authSvc.CreateUser(c.Context(), payload.Username, payload.Password, payload.IsAdmin)
@@ -264,12 +548,95 @@ func (h *Handler) SetUserBan(c *fiber.Ctx) error {
 		},
 	})
 
+	scores, _ := h.svc.ReputationScores(c.Context(), []string{user.ID})
 	return c.JSON(model.UserPublic{
-		ID:       user.ID,
-		Username: user.Username,
-		IsAdmin:  user.IsAdmin,
-		Banned:   user.Banned,
+		ID:         user.ID,
+		Username:   user.Username,
+		IsAdmin:    user.IsAdmin,
+		Banned:     user.Banned,
+		Reputation: scores[user.ID],
+	})
+}
+
+// RevokeUserTokens signs a user out everywhere.
+func (h *Handler) RevokeUserTokens(c *fiber.Ctx) error {
+	username := strings.TrimSpace(c.Params("username"))
+	if username == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "missing username"})
+	}
+	if _, err := h.authSvc.GetUser(c.Context(), username); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "user not found"})
+	}
+	if _, err := h.authSvc.RevokeTokens(c.Context(), username); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to revoke tokens"})
+	}
+	resolver := h.actorFromCtx(c)
+	_ = h.adminSvc.AppendLog(c.Context(), model.AdminLogEntry{
+		Type:    "user_tokens_revoked",
+		Message: "admin revoked user tokens",
+		Actor:   resolver,
+		Metadata: map[string]string{
+			"username": username,
+		},
 	})
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+// CreatePasswordReset issues a one-time reset token for a user and signs
+// them out everywhere. The admin passes the token on out of band.
+func (h *Handler) CreatePasswordReset(c *fiber.Ctx) error {
+	username := strings.TrimSpace(c.Params("username"))
+	if username == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "missing username"})
+	}
+
+	reset, err := h.authSvc.CreatePasswordReset(c.Context(), username)
+	if errors.Is(err, service.ErrUserNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "user not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to create reset token"})
+	}
+
+	_ = h.adminSvc.AppendLog(c.Context(), model.AdminLogEntry{
+		Type:    "password_reset_issued",
+		Message: "admin issued a password reset token",
+		Actor:   h.actorFromCtx(c),
+		Metadata: map[string]string{
+			"username": username,
+		},
+	})
+	return c.Status(201).JSON(reset)
+}
+
+// ListSigningKeys shows the token signing keys still accepted.
+func (h *Handler) ListSigningKeys(c *fiber.Ctx) error {
+	keys, err := h.authSvc.ListSigningKeys(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to list keys"})
+	}
+	return c.JSON(keys)
+}
+
+// RotateSigningKey signs new tokens with a fresh key. Tokens signed with
+// the old key keep working until it retires, so nobody is logged out.
+func (h *Handler) RotateSigningKey(c *fiber.Ctx) error {
+	key, err := h.authSvc.RotateSigningKey(c.Context())
+	if errors.Is(err, service.ErrKeyRotationConflict) {
+		return c.Status(409).JSON(fiber.Map{"error": "key rotation already in progress"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to rotate key"})
+	}
+	_ = h.adminSvc.AppendLog(c.Context(), model.AdminLogEntry{
+		Type:    "signing_key_rotated",
+		Message: "admin rotated the token signing key",
+		Actor:   h.actorFromCtx(c),
+		Metadata: map[string]string{
+			"kid": key.ID,
+		},
+	})
+	return c.Status(201).JSON(key)
 }
 
 func (h *Handler) DeleteUser(c *fiber.Ctx) error {
@@ -277,9 +644,13 @@ func (h *Handler) DeleteUser(c *fiber.Ctx) error {
 	if username == "" {
 		return c.Status(400).JSON(fiber.Map{"error": "missing username"})
 	}
+	user, _ := h.authSvc.GetUser(c.Context(), username)
 	if err := h.authSvc.DeleteUser(c.Context(), username); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "failed to delete user"})
 	}
+	if user != nil {
+		_ = h.svc.ForgetReputation(c.Context(), user.ID)
+	}
 	resolver := h.actorFromCtx(c)
 	_ = h.adminSvc.AppendLog(c.Context(), model.AdminLogEntry{
 		Type:    "user_deleted",
@@ -328,6 +699,90 @@ func (h *Handler) DeletePriceByCode(c *fiber.Ctx) error {
 	})
 }
 
+func (h *Handler) GetSubmission(c *fiber.Ctx) error {
+	id := strings.TrimSpace(c.Params("id"))
+	if id == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "missing submission id"})
+	}
+
+	submission, err := h.svc.GetSubmission(c.Context(), id)
+	if errors.Is(err, service.ErrSubmissionNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "submission not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch submission"})
+	}
+	return c.JSON(submission)
+}
+
+func (h *Handler) UpdateSubmission(c *fiber.Ctx) error {
+	id := strings.TrimSpace(c.Params("id"))
+	if id == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "missing submission id"})
+	}
+
+	var req model.UpdateSubmissionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request"})
+	}
+	if req.Price == nil && req.Server == nil {
+		return c.Status(400).JSON(fiber.Map{"error": "nothing to update"})
+	}
+	if req.Price != nil && *req.Price <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid data"})
+	}
+
+	submission, err := h.svc.UpdateSubmission(c.Context(), id, req.Price, req.Server)
+	if errors.Is(err, service.ErrSubmissionNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "submission not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to update submission"})
+	}
+	resolver := h.actorFromCtx(c)
+	_ = h.adminSvc.AppendLog(c.Context(), model.AdminLogEntry{
+		Type:    "submission_updated",
+		Message: "admin edited a market submission",
+		Actor:   resolver,
+		Metadata: map[string]string{
+			"submissionId": submission.ID,
+			"code":         submission.Code,
+			"price":        strconv.FormatFloat(submission.Price, 'f', -1, 64),
+			"server":       submission.Server,
+		},
+	})
+
+	return c.JSON(submission)
+}
+
+func (h *Handler) DeleteSubmission(c *fiber.Ctx) error {
+	id := strings.TrimSpace(c.Params("id"))
+	if id == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "missing submission id"})
+	}
+
+	submission, err := h.svc.DeleteSubmission(c.Context(), id)
+	if errors.Is(err, service.ErrSubmissionNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "submission not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to delete submission"})
+	}
+	resolver := h.actorFromCtx(c)
+	_ = h.adminSvc.AppendLog(c.Context(), model.AdminLogEntry{
+		Type:    "submission_deleted",
+		Message: "admin deleted a market submission",
+		Actor:   resolver,
+		Metadata: map[string]string{
+			"submissionId": submission.ID,
+			"code":         submission.Code,
+			"price":        strconv.FormatFloat(submission.Price, 'f', -1, 64),
+		},
+	})
+
+	return c.JSON(fiber.Map{"status": "ok", "id": submission.ID})
+}
+
 func (h *Handler) SubmitFeedback(c *fiber.Ctx) error {
 	var req model.FeedbackRequest
 	if err := c.BodyParser(&req); err != nil {
@@ -388,7 +843,7 @@ func (h *Handler) ResolveFeedback(c *fiber.Ctx) error {
 	removedTime := int64(0)
 	removedPrice := int64(0)
 	if action == "delete" {
-		removedTime, removedPrice, err = h.svc.DeletePricesByCode(c.Context(), strings.ToUpper(feedback.Code))
+		removedTime, removedPrice, err = h.svc.DeleteReportedCode(c.Context(), strings.ToUpper(feedback.Code))
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": "failed to delete code"})
 		}
@@ -498,69 +953,74 @@ func int64ToString(value int64) string {
 	return strconv.FormatInt(value, 10)
 }
 
+// ClientIP is the address of the client: the proxy header when the peer is
+// one of the trusted proxies configured on the app, the peer address
+// otherwise. Clients talking to the server directly can't choose their IP.
+func ClientIP(c *fiber.Ctx) string {
+	return c.IP()
+}
+
 func (h *Handler) actorFromOptionalAuth(c *fiber.Ctx) string {
 	authHeader := strings.TrimSpace(c.Get("Authorization"))
 	if authHeader == "" {
 		return ""
 	}
 
-	tokenString := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
-	if tokenString == "" {
+	claims, ok := h.parseTokenClaims(c.Context(), strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer ")))
+	if !ok {
 		return ""
 	}
+	return usernameFromClaims(claims)
+}
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return h.jwtKey, nil
-	})
-	if err != nil || !token.Valid {
-		return ""
-	}
+// parseTokenClaims validates a bearer token and returns its claims. It does
+// not check revocation, so it only serves to label actions; anything that
+// grants access goes through authSvc.Authenticate.
+func (h *Handler) parseTokenClaims(ctx context.Context, tokenString string) (jwt.MapClaims, bool) {
+	claims, err := h.authSvc.ParseAccessToken(ctx, tokenString)
+	return claims, err == nil
+}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return ""
-	}
+func usernameFromClaims(claims jwt.MapClaims) string {
 	if username, ok := claims["username"].(string); ok && strings.TrimSpace(username) != "" {
 		return strings.TrimSpace(username)
 	}
 	if name, ok := claims["name"].(string); ok && strings.TrimSpace(name) != "" {
 		return strings.TrimSpace(name)
 	}
-
 	return ""
 }
 
+func isAdminClaims(claims jwt.MapClaims) bool {
+	isAdmin, _ := claims["admin"].(bool)
+	if !isAdmin {
+		// Some JWT libs marshal bools as float64
+		if v, ok := claims["admin"].(float64); ok {
+			isAdmin = v == 1
+		}
+	}
+	return isAdmin
+}
+
 func (h *Handler) authMiddleware(c *fiber.Ctx) error {
 	authHeader := c.Get("Authorization")
 	if authHeader == "" {
 		return c.Status(401).JSON(fiber.Map{"error": "missing authorization header"})
 	}
 
-	tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return h.jwtKey, nil
-	})
-
-	if err != nil || !token.Valid {
-		return c.Status(401).JSON(fiber.Map{"error": "invalid token"})
+	tokenString := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
+	claims, err := h.authSvc.Authenticate(c.Context(), tokenString)
+	if errors.Is(err, service.ErrAccountBanned) {
+		return c.Status(403).JSON(fiber.Map{"error": "account banned"})
 	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return c.Status(401).JSON(fiber.Map{"error": "invalid token claims"})
+	if errors.Is(err, service.ErrTokenRevoked) {
+		return c.Status(401).JSON(fiber.Map{"error": "token revoked"})
 	}
-
-	username := ""
-	if val, ok := claims["username"].(string); ok {
-		username = val
-	} else if val, ok := claims["name"].(string); ok {
-		username = val
+	if errors.Is(err, service.ErrInvalidToken) {
+		return c.Status(401).JSON(fiber.Map{"error": "invalid token"})
 	}
-	if username != "" {
-		banned, err := h.authSvc.IsBanned(c.Context(), username)
-		if err == nil && banned {
-			return c.Status(403).JSON(fiber.Map{"error": "account banned"})
-		}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to verify token"})
 	}
 
 	c.Locals("user", claims)
@@ -572,14 +1032,7 @@ func (h *Handler) adminMiddleware(c *fiber.Ctx) error {
 	if !ok {
 		return c.Status(403).JSON(fiber.Map{"error": "access denied"})
 	}
-	isAdmin, _ := claims["admin"].(bool)
-	if !isAdmin {
-		// Some JWT libs marshal bools as float64
-		if v, ok := claims["admin"].(float64); ok {
-			isAdmin = v == 1
-		}
-	}
-	if !isAdmin {
+	if !isAdminClaims(claims) {
 		return c.Status(403).JSON(fiber.Map{"error": "admin required"})
 	}
 	return c.Next()
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lingbao-market/backend/internal/service"
+)
+
+const (
+	headerIdempotencyKey      = "Idempotency-Key"
+	headerIdempotencyReplayed = "Idempotent-Replayed"
+
+	idempotencyKeyMaxLen = 255
+)
+
+// idempotencyMiddleware replays the stored response when a request repeats
+// an Idempotency-Key within the window. Keys are scoped to the submitter, or
+// to the client for guests without a token, so they can't collide across
+// callers. Requests without the header pass straight through.
+func (h *Handler) idempotencyMiddleware(c *fiber.Ctx) error {
+	key := strings.TrimSpace(c.Get(headerIdempotencyKey))
+	if key == "" {
+		return c.Next()
+	}
+	if len(key) > idempotencyKeyMaxLen {
+		return c.Status(400).JSON(fiber.Map{"error": "Idempotency-Key too long"})
+	}
+
+	// Banned callers are turned away by the handler itself.
+	scope := "ip:" + ClientIP(c)
+	if who, err := h.submitterFromRequest(c); err == nil && who.ID != "" {
+		scope = "sub:" + who.ID
+	}
+	key = hashIdempotencyKey(scope, key)
+	fingerprint := requestFingerprint(c)
+
+	stored, err := h.svc.BeginIdempotent(c.Context(), key, fingerprint)
+	if errors.Is(err, service.ErrIdempotencyInProgress) {
+		return c.Status(409).JSON(fiber.Map{"error": "a request with this Idempotency-Key is still in progress"})
+	}
+	if errors.Is(err, service.ErrIdempotencyMismatch) {
+		return c.Status(422).JSON(fiber.Map{"error": "Idempotency-Key was used with a different request"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to submit"})
+	}
+	if stored != nil {
+		c.Set(headerIdempotencyReplayed, "true")
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return c.Status(stored.Status).Send(stored.Body)
+	}
+
+	// The request context is recycled once the handler returns.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = c.Next()
+	status := c.Response().StatusCode()
+	if err != nil || !finalResponse(c, status) {
+		// Let the client retry with the same key.
+		if abortErr := h.svc.AbortIdempotent(ctx, key); abortErr != nil {
+			log.Printf("Idempotency key release failed: %v", abortErr)
+		}
+		return err
+	}
+	body := append([]byte(nil), c.Response().Body()...)
+	if err := h.svc.FinishIdempotent(ctx, key, fingerprint, status, body); err != nil {
+		log.Printf("Idempotency result store failed: %v", err)
+	}
+	return nil
+}
+
+// finalResponse reports whether a response may be stored for replay. Server
+// failures, captcha rejections, auth failures and rate limits can all turn out
+// differently on a retry, and so can a batch with rate-limited or failed
+// items.
+func finalResponse(c *fiber.Ctx, status int) bool {
+	switch {
+	case status >= 500:
+		return false
+	case status == fiber.StatusUnauthorized, status == fiber.StatusForbidden, status == fiber.StatusTooManyRequests:
+		return false
+	}
+	if captchaRejected(c) {
+		return false
+	}
+	retry, _ := c.Locals("idempotencyRetry").(bool)
+	return !retry
+}
+
+func hashIdempotencyKey(scope, key string) string {
+	sum := sha256.Sum256([]byte(scope + "\x00" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// requestFingerprint identifies what was asked, so a key reused for a
+// different request is caught rather than answered with a stale response.
+func requestFingerprint(c *fiber.Ctx) string {
+	sum := sha256.New()
+	sum.Write([]byte(c.Method() + " " + c.Path() + "\x00"))
+	sum.Write(c.Body())
+	return hex.EncodeToString(sum.Sum(nil))
+}
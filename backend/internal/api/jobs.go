@@ -0,0 +1,63 @@
+package api
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lingbao-market/backend/internal/model"
+	"github.com/lingbao-market/backend/internal/scheduler"
+)
+
+func (h *Handler) ListJobs(c *fiber.Ctx) error {
+	jobs, err := h.scheduler.List(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to list jobs"})
+	}
+	return c.JSON(jobs)
+}
+
+// TriggerJob starts a job in the background, even if it is paused.
+func (h *Handler) TriggerJob(c *fiber.Ctx) error {
+	name := strings.TrimSpace(c.Params("name"))
+	if err := h.scheduler.Trigger(name); errors.Is(err, scheduler.ErrJobNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "job not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to trigger job"})
+	}
+	h.logJobAction(c, "job_triggered", "admin triggered job", name)
+	return c.Status(202).JSON(fiber.Map{"status": "queued"})
+}
+
+func (h *Handler) PauseJob(c *fiber.Ctx) error {
+	name := strings.TrimSpace(c.Params("name"))
+	if err := h.scheduler.Pause(c.Context(), name); errors.Is(err, scheduler.ErrJobNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "job not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to pause job"})
+	}
+	h.logJobAction(c, "job_paused", "admin paused job", name)
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+func (h *Handler) ResumeJob(c *fiber.Ctx) error {
+	name := strings.TrimSpace(c.Params("name"))
+	if err := h.scheduler.Resume(c.Context(), name); errors.Is(err, scheduler.ErrJobNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "job not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to resume job"})
+	}
+	h.logJobAction(c, "job_resumed", "admin resumed job", name)
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+func (h *Handler) logJobAction(c *fiber.Ctx, logType, message, name string) {
+	_ = h.adminSvc.AppendLog(c.Context(), model.AdminLogEntry{
+		Type:    logType,
+		Message: message,
+		Actor:   h.actorFromCtx(c),
+		Metadata: map[string]string{
+			"job": name,
+		},
+	})
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lingbao-market/backend/internal/model"
+	"github.com/lingbao-market/backend/internal/service"
+)
+
+func (h *Handler) ListPending(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", service.ModerationDefaultLimit)
+	if limit <= 0 || limit > service.ModerationMaxLimit {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid limit"})
+	}
+	items, err := h.svc.ListPending(c.Context(), int64(limit))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to list pending submissions"})
+	}
+	return c.JSON(items)
+}
+
+func (h *Handler) ApprovePending(c *fiber.Ctx) error {
+	id := strings.TrimSpace(c.Params("id"))
+	submission, err := h.svc.ApprovePending(c.Context(), id)
+	if errors.Is(err, service.ErrPendingNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "pending submission not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to approve submission"})
+	}
+	h.logModeration(c, "moderation_approved", "admin approved a pending submission", id, submission)
+	return c.JSON(submission)
+}
+
+func (h *Handler) RejectPending(c *fiber.Ctx) error {
+	id := strings.TrimSpace(c.Params("id"))
+	item, err := h.svc.RejectPending(c.Context(), id)
+	if errors.Is(err, service.ErrPendingNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "pending submission not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to reject submission"})
+	}
+	h.logModeration(c, "moderation_rejected", "admin rejected a pending submission", id, item)
+	return c.JSON(fiber.Map{"status": "ok", "id": id})
+}
+
+// BulkApprovePending approves several pending submissions. Each one is
+// logged on its own; IDs that were already decided are reported as skipped.
+func (h *Handler) BulkApprovePending(c *fiber.Ctx) error {
+	var req model.BulkApproveRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request"})
+	}
+	ids := req.IDs
+	if req.All {
+		var err error
+		ids, err = h.svc.PendingIDs(c.Context(), service.ModerationMaxLimit)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to list pending submissions"})
+		}
+	}
+	if len(ids) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "nothing to approve"})
+	}
+	if len(ids) > service.ModerationMaxLimit {
+		return c.Status(400).JSON(fiber.Map{"error": "too many ids"})
+	}
+
+	approved := make([]model.PriceItem, 0, len(ids))
+	skipped := make([]string, 0)
+	for _, id := range ids {
+		id = strings.TrimSpace(id)
+		submission, err := h.svc.ApprovePending(c.Context(), id)
+		if errors.Is(err, service.ErrPendingNotFound) {
+			skipped = append(skipped, id)
+			continue
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":    "failed to approve submission",
+				"approved": approved,
+				"skipped":  skipped,
+			})
+		}
+		h.logModeration(c, "moderation_approved", "admin approved a pending submission", id, submission)
+		approved = append(approved, *submission)
+	}
+	return c.JSON(fiber.Map{"approved": approved, "skipped": skipped})
+}
+
+// ListFlagged lists live submissions whose price was flagged as an outlier.
+func (h *Handler) ListFlagged(c *fiber.Ctx) error {
+	items, err := h.svc.ListFlagged(c.Context(), int64(c.QueryInt("limit", 200)))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to list flagged submissions"})
+	}
+	return c.JSON(items)
+}
+
+func (h *Handler) logModeration(c *fiber.Ctx, logType, message, pendingID string, item *model.PriceItem) {
+	metadata := map[string]string{
+		"pendingId": pendingID,
+		"code":      item.Code,
+		"price":     strconv.FormatFloat(item.Price, 'f', -1, 64),
+		"submitter": item.SubmitterID,
+	}
+	if logType == "moderation_approved" {
+		metadata["submissionId"] = item.ID
+	}
+	_ = h.adminSvc.AppendLog(c.Context(), model.AdminLogEntry{
+		Type:     logType,
+		Message:  message,
+		Actor:    h.actorFromCtx(c),
+		Metadata: metadata,
+	})
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/lingbao-market/backend/internal/model"
+	"github.com/lingbao-market/backend/internal/service"
+)
+
+// GetLeaderboard lists the contributors with the highest reputation. Banned
+// users are left out.
+func (h *Handler) GetLeaderboard(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", service.LeaderboardDefaultLimit)
+	if limit <= 0 || limit > service.LeaderboardMaxLimit {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid limit"})
+	}
+
+	board, err := h.svc.Leaderboard(c.Context(), int64(limit))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch leaderboard"})
+	}
+
+	resp := make([]model.Reputation, 0, len(board))
+	for _, rep := range board {
+		if rep.Username != "" {
+			if banned, err := h.authSvc.IsBanned(c.Context(), rep.Username); err == nil && banned {
+				continue
+			}
+		}
+		rep.UserID = ""
+		resp = append(resp, rep)
+	}
+	return c.JSON(resp)
+}
+
+// GetMyReputation returns the caller's reputation and submitter tier.
+func (h *Handler) GetMyReputation(c *fiber.Ctx) error {
+	rep, err := h.svc.GetReputation(c.Context(), submitterFromCtx(c).ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to fetch reputation"})
+	}
+	return c.JSON(rep)
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lingbao-market/backend/internal/model"
+	"github.com/lingbao-market/backend/internal/service"
+)
+
+const (
+	sseHeartbeatInterval = 15 * time.Second
+
+	defaultStreamsPerIP = 5
+)
+
+// streamLimiter caps the feed streams (SSE and WebSocket together) one
+// client IP may hold open on this instance.
+type streamLimiter struct {
+	max int
+
+	mu   sync.Mutex
+	open map[string]int
+}
+
+func newStreamLimiter(max int) *streamLimiter {
+	if max <= 0 {
+		max = defaultStreamsPerIP
+	}
+	return &streamLimiter{max: max, open: make(map[string]int)}
+}
+
+// acquire takes a stream slot for ip. It reports false when the IP already
+// holds the maximum.
+func (l *streamLimiter) acquire(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.open[ip] >= l.max {
+		return false
+	}
+	l.open[ip]++
+	return true
+}
+
+func (l *streamLimiter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.open[ip] <= 1 {
+		delete(l.open, ip)
+		return
+	}
+	l.open[ip]--
+}
+
+// StreamFeed pushes feed events as Server-Sent Events. It accepts the same
+// filters as GetFeed and resumes from the Last-Event-ID header (or the
+// lastEventId query parameter, for clients that can't set headers).
+func (h *Handler) StreamFeed(c *fiber.Ctx) error {
+	filter, err := parseFeedFilter(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	lastEventID := strings.TrimSpace(c.Get("Last-Event-ID"))
+	if lastEventID == "" {
+		lastEventID = strings.TrimSpace(c.Query("lastEventId"))
+	}
+
+	ip := ClientIP(c)
+	if !h.streams.acquire(ip) {
+		return c.Status(429).JSON(fiber.Map{"error": "too many open streams"})
+	}
+
+	// The stream outlives this handler, so it can't use the request context.
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := h.svc.SubscribeFeed(ctx, lastEventID)
+	if errors.Is(err, service.ErrInvalidEventID) {
+		cancel()
+		h.streams.release(ip)
+		return c.Status(400).JSON(fiber.Map{"error": "invalid Last-Event-ID"})
+	}
+	if err != nil {
+		cancel()
+		h.streams.release(ip)
+		return c.Status(500).JSON(fiber.Map{"error": "failed to subscribe to feed"})
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer h.streams.release(ip)
+		defer cancel()
+
+		heartbeat := time.NewTicker(sseHeartbeatInterval)
+		defer heartbeat.Stop()
+
+		fmt.Fprintf(w, "retry: %d\n\n", (3 * time.Second).Milliseconds())
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				if !filter.MatchesEvent(event) {
+					continue
+				}
+				if err := writeSSEEvent(w, event); err != nil {
+					return
+				}
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": ping\n\n")
+				if err := w.Flush(); err != nil {
+					return
+				}
+			}
+		}
+	})
+
+	return nil
+}
+
+func writeSSEEvent(w *bufio.Writer, event model.FeedEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil
+	}
+	if event.ID != "" {
+		fmt.Fprintf(w, "id: %s\n", event.ID)
+	}
+	fmt.Fprintf(w, "event: %s\n", event.Type)
+	fmt.Fprintf(w, "data: %s\n\n", payload)
+	return w.Flush()
+}
@@ -0,0 +1,245 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lingbao-market/backend/internal/model"
+	"github.com/lingbao-market/backend/internal/service"
+)
+
+// Most items one batch submission may carry.
+const submitBatchMax = 50
+
+// Per-item outcomes of a submission.
+const (
+	submitStatusOK          = "ok"
+	submitStatusPending     = "pending"
+	submitStatusInvalid     = "invalid"
+	submitStatusRejected    = "rejected"
+	submitStatusRateLimited = "rate_limited"
+	submitStatusError       = "error"
+)
+
+var submitStatusCodes = map[string]int{
+	submitStatusOK:          201,
+	submitStatusPending:     202,
+	submitStatusInvalid:     400,
+	submitStatusRejected:    422,
+	submitStatusRateLimited: fiber.StatusTooManyRequests,
+	submitStatusError:       500,
+}
+
+type submitResult struct {
+	Index   int    `json:"index"`
+	Status  string `json:"status"`
+	ID      string `json:"id,omitempty"`
+	Flagged bool   `json:"flagged,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// submitContext is who is submitting, resolved once per request.
+type submitContext struct {
+	who         submitter
+	tier        string
+	limitKey    string
+	issuedToken string
+}
+
+// SubmitPrice records a submission under the caller's user ID, or under an
+// anonymous submitter ID for guests. Guests without a valid submitter token
+// get a new one in the response.
+func (h *Handler) SubmitPrice(c *fiber.Ctx) error {
+	var req model.SubmitRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request"})
+	}
+
+	sc, err := h.resolveSubmitContext(c)
+	if errors.Is(err, errSubmitterBanned) {
+		return c.Status(403).JSON(fiber.Map{"error": "account banned"})
+	}
+	if errors.Is(err, errSubmitterTokenLimit) {
+		return c.Status(429).JSON(fiber.Map{"error": "too many new submitter tokens, send back your X-Submitter-Token or sign in"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to submit"})
+	}
+
+	result := h.submitOne(c.Context(), sc, req)
+	resp := fiber.Map{}
+	switch result.Status {
+	case submitStatusOK, submitStatusPending:
+		resp["status"] = result.Status
+		resp["id"] = result.ID
+		resp["tier"] = sc.tier
+		if result.Flagged {
+			resp["flagged"] = true
+		}
+	case submitStatusRateLimited:
+		resp["error"] = result.Error
+		resp["tier"] = sc.tier
+	default:
+		resp["error"] = result.Error
+	}
+	if sc.issuedToken != "" && (result.Status == submitStatusOK || result.Status == submitStatusPending) {
+		resp["submitterToken"] = sc.issuedToken
+	}
+	return c.Status(submitStatusCodes[result.Status]).JSON(resp)
+}
+
+// SubmitPriceBatch applies SubmitPrice to up to submitBatchMax items and
+// reports the outcome of each; one bad item doesn't fail the others.
+func (h *Handler) SubmitPriceBatch(c *fiber.Ctx) error {
+	var req model.SubmitBatchRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request"})
+	}
+	if len(req.Items) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "no items"})
+	}
+	if len(req.Items) > submitBatchMax {
+		return c.Status(400).JSON(fiber.Map{"error": "too many items", "max": submitBatchMax})
+	}
+
+	sc, err := h.resolveSubmitContext(c)
+	if errors.Is(err, errSubmitterBanned) {
+		return c.Status(403).JSON(fiber.Map{"error": "account banned"})
+	}
+	if errors.Is(err, errSubmitterTokenLimit) {
+		return c.Status(429).JSON(fiber.Map{"error": "too many new submitter tokens, send back your X-Submitter-Token or sign in"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to submit"})
+	}
+
+	results := make([]submitResult, 0, len(req.Items))
+	accepted := 0
+	for i, item := range req.Items {
+		result := h.submitOne(c.Context(), sc, item)
+		result.Index = i
+		if result.Status == submitStatusOK || result.Status == submitStatusPending {
+			accepted++
+		}
+		if result.Status == submitStatusRateLimited || result.Status == submitStatusError {
+			// Retrying later may get these items in; idempotencyMiddleware
+			// must not pin the reply.
+			c.Locals("idempotencyRetry", true)
+		}
+		results = append(results, result)
+	}
+
+	resp := fiber.Map{"results": results, "accepted": accepted, "tier": sc.tier}
+	if sc.issuedToken != "" && accepted > 0 {
+		resp["submitterToken"] = sc.issuedToken
+	}
+	return c.JSON(resp)
+}
+
+// resolveSubmitContext identifies the submitter, issuing a guest token when
+// there is none, and places them in a tier. Each client can only mint a few
+// guest tokens a day.
+func (h *Handler) resolveSubmitContext(c *fiber.Ctx) (submitContext, error) {
+	who, err := h.submitterFromRequest(c)
+	if err != nil {
+		return submitContext{}, err
+	}
+	sc := submitContext{}
+	if who.ID == "" {
+		allowed, err := h.authSvc.AllowSubmitterToken(c.Context(), ClientIP(c))
+		if err != nil {
+			return submitContext{}, err
+		}
+		if !allowed {
+			return submitContext{}, errSubmitterTokenLimit
+		}
+		token, id, err := h.authSvc.IssueSubmitterToken(c.Context())
+		if err != nil {
+			return submitContext{}, err
+		}
+		who.ID, sc.issuedToken = id, token
+	}
+	sc.who = who
+
+	sc.tier, err = h.svc.SubmitterTier(c.Context(), who.ID)
+	if err != nil {
+		return submitContext{}, err
+	}
+	// Guests can drop their token at will, so they are limited per client.
+	sc.limitKey = who.ID
+	if who.guest() {
+		sc.limitKey = ClientIP(c)
+	}
+	return sc, nil
+}
+
+// submitOne validates and records one submission.
+func (h *Handler) submitOne(ctx context.Context, sc submitContext, req model.SubmitRequest) submitResult {
+	code, msg := normalizeSubmitRequest(req)
+	if msg != "" {
+		return submitResult{Status: submitStatusInvalid, Error: msg}
+	}
+
+	allowed, err := h.svc.AllowSubmission(ctx, sc.tier, sc.limitKey)
+	if err != nil {
+		return submitResult{Status: submitStatusError, Error: "failed to submit"}
+	}
+	if !allowed {
+		return submitResult{Status: submitStatusRateLimited, Error: "Too many requests, please try again later."}
+	}
+
+	item := model.PriceItem{
+		Code:          code,
+		Price:         req.Price,
+		Server:        req.Server,
+		Source:        model.PriceSourceManual,
+		SubmitterID:   sc.who.ID,
+		SubmitterName: sc.who.Name,
+	}
+
+	if !sc.who.Admin && h.svc.Moderation().Holds(sc.who.guest(), sc.tier) {
+		pending, err := h.svc.QueueSubmission(ctx, item)
+		if err != nil {
+			return submitResult{Status: submitStatusError, Error: "failed to submit"}
+		}
+		return submitResult{Status: submitStatusPending, ID: pending.ID}
+	}
+
+	submission, err := h.svc.AddPrice(ctx, item)
+	if errors.Is(err, service.ErrPriceOutlier) {
+		return submitResult{Status: submitStatusRejected, Error: "price is far off the usual range"}
+	}
+	if errors.Is(err, service.ErrQueuedForReview) {
+		return submitResult{Status: submitStatusPending, ID: submission.ID}
+	}
+	if err != nil {
+		return submitResult{Status: submitStatusError, Error: "failed to submit"}
+	}
+	return submitResult{Status: submitStatusOK, ID: submission.ID, Flagged: submission.Flagged}
+}
+
+// normalizeSubmitRequest returns the normalized code of a submission, or a
+// validation message when the submission is invalid.
+func normalizeSubmitRequest(req model.SubmitRequest) (string, string) {
+	code := strings.ToUpper(strings.Join(strings.Fields(req.Code), ""))
+	if code == "" || req.Price <= 0 {
+		return "", "invalid data"
+	}
+
+	// Validate Code Format (letters/digits incl. Chinese, 3-12 chars)
+	runeCount := utf8.RuneCountInString(code)
+	if runeCount < 3 || runeCount > 12 {
+		return "", "invalid code format"
+	}
+	for _, r := range code {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			continue
+		}
+		return "", "invalid code format"
+	}
+	return code, ""
+}
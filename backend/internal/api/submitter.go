@@ -0,0 +1,187 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lingbao-market/backend/internal/model"
+	"github.com/lingbao-market/backend/internal/service"
+)
+
+// Guests send back the token SubmitPrice issued them in this header. A
+// response carries it when the token was renewed under a newer key.
+const headerSubmitterToken = "X-Submitter-Token"
+
+var (
+	errSubmitterBanned     = errors.New("account banned")
+	errSubmitterTokenLimit = errors.New("too many submitter tokens")
+)
+
+type submitter struct {
+	ID    string
+	Name  string
+	Admin bool
+	// Since is when a guest's submitter token was issued.
+	Since time.Time
+}
+
+// submitterFromRequest identifies who is submitting: a signed-in user, or a
+// guest holding a submitter token. Invalid credentials count as none, the way
+// actorFromOptionalAuth treats them, so a stale login never blocks a guest.
+func (h *Handler) submitterFromRequest(c *fiber.Ctx) (submitter, error) {
+	authHeader := strings.TrimSpace(c.Get("Authorization"))
+	claims, err := h.authSvc.Authenticate(c.Context(), strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer ")))
+	if errors.Is(err, service.ErrAccountBanned) {
+		return submitter{}, errSubmitterBanned
+	}
+	if err == nil {
+		username := usernameFromClaims(claims)
+		id, _ := claims["sub"].(string)
+		if id == "" {
+			id = username
+		}
+		if id != "" {
+			return submitter{ID: id, Name: username, Admin: isAdminClaims(claims)}, nil
+		}
+	}
+
+	if token := strings.TrimSpace(c.Get(headerSubmitterToken)); token != "" {
+		if id, issuedAt, err := h.authSvc.ParseSubmitterToken(c.Context(), token); err == nil {
+			// Hand back a token under the active key before the old one
+			// retires; clients store it like the one SubmitPrice issues.
+			if renewed, err := h.authSvc.RenewSubmitterToken(c.Context(), token); err == nil && renewed != "" {
+				c.Set(headerSubmitterToken, renewed)
+			}
+			return submitter{ID: id, Since: issuedAt}, nil
+		}
+	}
+	return submitter{}, nil
+}
+
+// submitterMiddleware requires a submitter identity for the /me routes.
+func (h *Handler) submitterMiddleware(c *fiber.Ctx) error {
+	who, err := h.submitterFromRequest(c)
+	if errors.Is(err, errSubmitterBanned) {
+		return c.Status(403).JSON(fiber.Map{"error": "account banned"})
+	}
+	if who.ID == "" {
+		return c.Status(401).JSON(fiber.Map{"error": "missing submitter identity"})
+	}
+	c.Locals("submitter", who)
+	return c.Next()
+}
+
+func submitterFromCtx(c *fiber.Ctx) submitter {
+	who, _ := c.Locals("submitter").(submitter)
+	return who
+}
+
+// ListMySubmissions returns the caller's submissions that are still live.
+func (h *Handler) ListMySubmissions(c *fiber.Ctx) error {
+	items, err := h.svc.ListSubmitterSubmissions(c.Context(), submitterFromCtx(c).ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to list submissions"})
+	}
+	return c.JSON(items)
+}
+
+// UpdateMySubmission lets a submitter correct the price or server of one of
+// their own submissions.
+func (h *Handler) UpdateMySubmission(c *fiber.Ctx) error {
+	id := strings.TrimSpace(c.Params("id"))
+	if id == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "missing submission id"})
+	}
+
+	var req model.UpdateSubmissionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request"})
+	}
+	if req.Price == nil && req.Server == nil {
+		return c.Status(400).JSON(fiber.Map{"error": "nothing to update"})
+	}
+	if req.Price != nil && *req.Price <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid data"})
+	}
+
+	who := submitterFromCtx(c)
+	submission, err := h.svc.UpdateSubmissionAs(c.Context(), who.ID, id, req.Price, req.Server)
+	if errors.Is(err, service.ErrSubmissionNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "submission not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to update submission"})
+	}
+	_ = h.adminSvc.AppendLog(c.Context(), model.AdminLogEntry{
+		Type:    "submission_corrected",
+		Message: "submitter corrected their submission",
+		Actor:   who.actor(),
+		Metadata: map[string]string{
+			"submissionId": submission.ID,
+			"code":         submission.Code,
+			"price":        strconv.FormatFloat(submission.Price, 'f', -1, 64),
+			"server":       submission.Server,
+		},
+	})
+
+	return c.JSON(submission)
+}
+
+// DeleteMySubmission lets a submitter withdraw one of their own submissions.
+func (h *Handler) DeleteMySubmission(c *fiber.Ctx) error {
+	id := strings.TrimSpace(c.Params("id"))
+	if id == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "missing submission id"})
+	}
+
+	who := submitterFromCtx(c)
+	submission, err := h.svc.DeleteSubmissionAs(c.Context(), who.ID, id)
+	if errors.Is(err, service.ErrSubmissionNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "submission not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to delete submission"})
+	}
+	_ = h.adminSvc.AppendLog(c.Context(), model.AdminLogEntry{
+		Type:    "submission_withdrawn",
+		Message: "submitter withdrew their submission",
+		Actor:   who.actor(),
+		Metadata: map[string]string{
+			"submissionId": submission.ID,
+			"code":         submission.Code,
+			"price":        strconv.FormatFloat(submission.Price, 'f', -1, 64),
+		},
+	})
+
+	return c.JSON(fiber.Map{"status": "ok", "id": submission.ID})
+}
+
+// ListCodeSubmissions shows admins every live submission of a code together
+// with its submitter.
+func (h *Handler) ListCodeSubmissions(c *fiber.Ctx) error {
+	code := codeParam(c)
+	if code == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "missing code"})
+	}
+
+	items, err := h.svc.ListCodeSubmissions(c.Context(), code)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to list submissions"})
+	}
+	return c.JSON(items)
+}
+
+func (s submitter) guest() bool {
+	return strings.HasPrefix(s.ID, service.AnonymousSubmitterPrefix)
+}
+
+// actor names the submitter in admin logs.
+func (s submitter) actor() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.ID
+}
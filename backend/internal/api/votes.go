@@ -0,0 +1,125 @@
+package api
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lingbao-market/backend/internal/model"
+	"github.com/lingbao-market/backend/internal/service"
+)
+
+// VoteCode records a "still valid" (confirm) or "already used" (dispute)
+// vote on a live code. Votes count only from signed-in users and from guests
+// whose submitter token is at least service.GuestVoteMinAge old; guests also
+// solve a captcha. Every client is limited to a few votes per code.
+func (h *Handler) VoteCode(c *fiber.Ctx) error {
+	code := codeParam(c)
+	if code == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "missing code"})
+	}
+
+	var req model.VoteRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request"})
+	}
+
+	who, err := h.submitterFromRequest(c)
+	if errors.Is(err, errSubmitterBanned) {
+		return c.Status(403).JSON(fiber.Map{"error": "account banned"})
+	}
+	if who.ID == "" || (who.guest() && time.Since(who.Since) < service.GuestVoteMinAge) {
+		return c.Status(403).JSON(fiber.Map{"error": "sign in or use an established submitter token to vote"})
+	}
+	if who.guest() {
+		if ok, err := h.checkCaptchaHeaders(c); !ok {
+			return err
+		}
+	}
+	if !who.Admin {
+		allowed, err := h.svc.AllowVote(c.Context(), ClientIP(c), code)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to vote"})
+		}
+		if !allowed {
+			return c.Status(429).JSON(fiber.Map{"error": "too many votes on this code"})
+		}
+	}
+
+	result, err := h.svc.Vote(c.Context(), code, who.ID, req.Vote)
+	if errors.Is(err, service.ErrInvalidVote) {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vote"})
+	}
+	if errors.Is(err, service.ErrCodeNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "code not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to vote"})
+	}
+	if result.Hidden {
+		_ = h.adminSvc.AppendLog(c.Context(), model.AdminLogEntry{
+			Type:    "code_hidden",
+			Message: "code hidden after reaching the dispute threshold",
+			Actor:   who.actor(),
+			Metadata: map[string]string{
+				"code":          result.Code,
+				"confirmations": int64ToString(result.Confirmations),
+				"disputes":      int64ToString(result.Disputes),
+			},
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"code":          result.Code,
+		"confirmations": result.Confirmations,
+		"disputes":      result.Disputes,
+		"hidden":        result.Hidden,
+	})
+}
+
+func (h *Handler) ListHiddenCodes(c *fiber.Ctx) error {
+	items, err := h.svc.ListHiddenCodes(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to list hidden codes"})
+	}
+	return c.JSON(items)
+}
+
+// RestoreCode returns a code hidden by disputes to the feed. Hidden codes
+// that turn out to be used up are removed with DeletePriceByCode instead.
+func (h *Handler) RestoreCode(c *fiber.Ctx) error {
+	code := codeParam(c)
+	if code == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "missing code"})
+	}
+
+	item, err := h.svc.RestoreCode(c.Context(), code)
+	if errors.Is(err, service.ErrCodeNotHidden) || errors.Is(err, service.ErrCodeNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "hidden code not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to restore code"})
+	}
+	_ = h.adminSvc.AppendLog(c.Context(), model.AdminLogEntry{
+		Type:    "code_restored",
+		Message: "admin restored a disputed code",
+		Actor:   h.actorFromCtx(c),
+		Metadata: map[string]string{
+			"code":  item.Code,
+			"price": strconv.FormatFloat(item.Price, 'f', -1, 64),
+		},
+	})
+	return c.JSON(item)
+}
+
+// codeParam reads the :code route parameter, which may be percent-encoded.
+func codeParam(c *fiber.Ctx) string {
+	code := strings.TrimSpace(c.Params("code"))
+	if decoded, err := url.PathUnescape(code); err == nil {
+		code = strings.TrimSpace(decoded)
+	}
+	return code
+}
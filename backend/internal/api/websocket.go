@@ -0,0 +1,372 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lingbao-market/backend/internal/model"
+)
+
+const (
+	wsChannelFeed       = "feed"
+	wsChannelServerFeed = "feed:server:"
+	wsChannelCode       = "code:"
+	wsChannelAdminLogs  = "admin:logs"
+
+	wsMaxSubscriptions = 50
+	wsMaxMessageBytes  = 4 << 10
+	wsPingInterval     = 30 * time.Second
+	wsReadTimeout      = 2 * wsPingInterval
+	wsWriteTimeout     = 10 * time.Second
+	// An admin:logs subscription re-authenticates its token this often and
+	// ends once the token expires or its admin is banned or revoked.
+	wsAdminRecheckInterval = time.Minute
+)
+
+// wsClientMessage is a request sent by a WebSocket client:
+// {"action": "subscribe" | "unsubscribe" | "ping", "channel": "..."}.
+type wsClientMessage struct {
+	Action  string `json:"action"`
+	Channel string `json:"channel"`
+}
+
+type wsServerMessage struct {
+	Type    string               `json:"type"`
+	Channel string               `json:"channel,omitempty"`
+	Event   *model.FeedEvent     `json:"event,omitempty"`
+	Log     *model.AdminLogEntry `json:"log,omitempty"`
+	Error   string               `json:"error,omitempty"`
+}
+
+type wsClient struct {
+	conn *websocket.Conn
+	// token is the access token of the handshake, for rechecking admins.
+	token string
+
+	writeMu sync.Mutex
+
+	mu        sync.Mutex
+	isAdmin   bool
+	channels  map[string]bool
+	stopAdmin context.CancelFunc
+
+	// The connection is recycled once the handler returns, so every goroutine
+	// that writes to it must have exited by then.
+	wg sync.WaitGroup
+}
+
+// WebSocketUpgrade only lets WebSocket handshakes through. A token in the
+// Authorization header or the token query parameter identifies admins.
+func (h *Handler) WebSocketUpgrade(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return fiber.ErrUpgradeRequired
+	}
+
+	tokenString := strings.TrimSpace(strings.TrimPrefix(c.Get("Authorization"), "Bearer "))
+	if tokenString == "" {
+		tokenString = strings.TrimSpace(c.Query("token"))
+	}
+	if claims, err := h.authSvc.Authenticate(c.Context(), tokenString); err == nil {
+		c.Locals("user", claims)
+		c.Locals("token", tokenString)
+	}
+	c.Locals("clientIP", ClientIP(c))
+	return c.Next()
+}
+
+// HandleWebSocket serves the subscribe/unsubscribe protocol on one
+// connection. Channels: feed, feed:server:<name>, code:<CODE> and, for
+// admins, admin:logs, which ends once the handshake token stops
+// authenticating an admin.
+func (h *Handler) HandleWebSocket(conn *websocket.Conn) {
+	ip, _ := conn.Locals("clientIP").(string)
+	if !h.streams.acquire(ip) {
+		_ = conn.WriteJSON(wsServerMessage{Type: "error", Error: "too many open streams"})
+		return
+	}
+	defer h.streams.release(ip)
+
+	claims, _ := conn.Locals("user").(jwt.MapClaims)
+	token, _ := conn.Locals("token").(string)
+	client := &wsClient{
+		conn:     conn,
+		token:    token,
+		isAdmin:  claims != nil && isAdminClaims(claims),
+		channels: make(map[string]bool),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		client.stopAdminLogs()
+		client.wg.Wait()
+	}()
+
+	events, err := h.svc.SubscribeFeed(ctx, "")
+	if err != nil {
+		client.send(wsServerMessage{Type: "error", Error: "failed to subscribe to feed"})
+		return
+	}
+	client.wg.Add(2)
+	go client.pumpFeed(ctx, events)
+	go client.keepAlive(ctx)
+
+	conn.SetReadLimit(wsMaxMessageBytes)
+	_ = conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+	})
+
+	for {
+		_, raw, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+
+		var msg wsClientMessage
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			client.send(wsServerMessage{Type: "error", Error: "invalid message"})
+			continue
+		}
+
+		switch strings.ToLower(strings.TrimSpace(msg.Action)) {
+		case "subscribe":
+			h.wsSubscribe(client, msg.Channel)
+		case "unsubscribe":
+			channel, ok := normalizeWSChannel(msg.Channel)
+			if !ok {
+				client.send(wsServerMessage{Type: "error", Channel: msg.Channel, Error: "invalid channel"})
+				continue
+			}
+			client.unsubscribe(channel)
+			client.send(wsServerMessage{Type: "unsubscribed", Channel: channel})
+		case "ping":
+			client.send(wsServerMessage{Type: "pong"})
+		default:
+			client.send(wsServerMessage{Type: "error", Error: "unknown action"})
+		}
+	}
+}
+
+func (h *Handler) wsSubscribe(client *wsClient, requested string) {
+	channel, ok := normalizeWSChannel(requested)
+	if !ok {
+		client.send(wsServerMessage{Type: "error", Channel: requested, Error: "invalid channel"})
+		return
+	}
+	if channel == wsChannelAdminLogs && !client.admin() {
+		client.send(wsServerMessage{Type: "error", Channel: channel, Error: "admin required"})
+		return
+	}
+	if !client.subscribe(channel) {
+		client.send(wsServerMessage{Type: "error", Channel: channel, Error: "too many subscriptions"})
+		return
+	}
+
+	if channel == wsChannelAdminLogs {
+		if err := h.startAdminLogs(client); err != nil {
+			client.unsubscribe(channel)
+			client.send(wsServerMessage{Type: "error", Channel: channel, Error: "failed to subscribe to logs"})
+			return
+		}
+	}
+	client.send(wsServerMessage{Type: "subscribed", Channel: channel})
+}
+
+func (h *Handler) startAdminLogs(client *wsClient) error {
+	client.mu.Lock()
+	if client.stopAdmin != nil {
+		client.mu.Unlock()
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	client.stopAdmin = cancel
+	client.mu.Unlock()
+
+	logs, err := h.adminSvc.SubscribeLogs(ctx)
+	if err != nil {
+		client.stopAdminLogs()
+		return err
+	}
+
+	client.wg.Add(1)
+	go func() {
+		defer client.wg.Done()
+		recheck := time.NewTicker(wsAdminRecheckInterval)
+		defer recheck.Stop()
+		for {
+			select {
+			case entry, ok := <-logs:
+				if !ok {
+					return
+				}
+				client.send(wsServerMessage{Type: "log", Channel: wsChannelAdminLogs, Log: &entry})
+			case <-recheck.C:
+				if claims, err := h.authSvc.Authenticate(ctx, client.token); err == nil && isAdminClaims(claims) {
+					continue
+				}
+				client.dropAdmin()
+				client.send(wsServerMessage{Type: "error", Channel: wsChannelAdminLogs, Error: "admin session ended"})
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (c *wsClient) pumpFeed(ctx context.Context, events <-chan model.FeedEvent) {
+	defer c.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				// The feed dropped this client for falling behind; closing
+				// the connection makes it reconnect.
+				if ctx.Err() == nil {
+					c.writeMu.Lock()
+					_ = c.conn.Close()
+					c.writeMu.Unlock()
+				}
+				return
+			}
+			for _, channel := range c.matchingChannels(event) {
+				event := event
+				c.send(wsServerMessage{Type: "event", Channel: channel, Event: &event})
+			}
+		}
+	}
+}
+
+func (c *wsClient) keepAlive(ctx context.Context) {
+	defer c.wg.Done()
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.writeMu.Lock()
+			err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout))
+			c.writeMu.Unlock()
+			if err != nil {
+				_ = c.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+func (c *wsClient) send(msg wsServerMessage) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_ = c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if err := c.conn.WriteJSON(msg); err != nil {
+		_ = c.conn.Close()
+	}
+}
+
+func (c *wsClient) subscribe(channel string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.channels[channel] {
+		return true
+	}
+	if len(c.channels) >= wsMaxSubscriptions {
+		return false
+	}
+	c.channels[channel] = true
+	return true
+}
+
+func (c *wsClient) unsubscribe(channel string) {
+	c.mu.Lock()
+	delete(c.channels, channel)
+	c.mu.Unlock()
+	if channel == wsChannelAdminLogs {
+		c.stopAdminLogs()
+	}
+}
+
+func (c *wsClient) admin() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.isAdmin
+}
+
+// dropAdmin ends the admin:logs subscription for good; the client has to
+// reconnect with a valid admin token to get it back.
+func (c *wsClient) dropAdmin() {
+	c.mu.Lock()
+	c.isAdmin = false
+	c.mu.Unlock()
+	c.unsubscribe(wsChannelAdminLogs)
+}
+
+func (c *wsClient) stopAdminLogs() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopAdmin != nil {
+		c.stopAdmin()
+		c.stopAdmin = nil
+	}
+}
+
+func (c *wsClient) matchingChannels(event model.FeedEvent) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var matched []string
+	for channel := range c.channels {
+		if wsChannelMatches(channel, event) {
+			matched = append(matched, channel)
+		}
+	}
+	return matched
+}
+
+// wsChannelMatches reports whether a feed event belongs on a channel.
+func wsChannelMatches(channel string, event model.FeedEvent) bool {
+	switch {
+	case channel == wsChannelFeed:
+		return true
+	case strings.HasPrefix(channel, wsChannelServerFeed):
+		server := strings.TrimPrefix(channel, wsChannelServerFeed)
+		return event.Item != nil && strings.TrimSpace(event.Item.Server) == server
+	case strings.HasPrefix(channel, wsChannelCode):
+		return event.Code != "" && event.Code == strings.TrimPrefix(channel, wsChannelCode)
+	}
+	return false
+}
+
+// normalizeWSChannel validates a channel name, uppercasing codes the way
+// SubmitPrice stores them.
+func normalizeWSChannel(channel string) (string, bool) {
+	channel = strings.TrimSpace(channel)
+	switch {
+	case channel == wsChannelFeed, channel == wsChannelAdminLogs:
+		return channel, true
+	case strings.HasPrefix(channel, wsChannelServerFeed):
+		server := strings.TrimSpace(strings.TrimPrefix(channel, wsChannelServerFeed))
+		if server == "" {
+			return "", false
+		}
+		return wsChannelServerFeed + server, true
+	case strings.HasPrefix(channel, wsChannelCode):
+		code := strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(channel, wsChannelCode)))
+		if code == "" {
+			return "", false
+		}
+		return wsChannelCode + code, true
+	}
+	return "", false
+}
@@ -16,6 +16,42 @@ type Config struct {
 	CleanupTimezone string `mapstructure:"CLEANUP_TIMEZONE"`
 	AdminUsername   string `mapstructure:"ADMIN_USERNAME"`
 	AdminPassword   string `mapstructure:"ADMIN_PASSWORD"`
+	ProxyHeader     string `mapstructure:"PROXY_HEADER"`
+	TrustedProxies  string `mapstructure:"TRUSTED_PROXIES"`
+
+	AccessTokenTTLMinutes int `mapstructure:"ACCESS_TOKEN_TTL_MINUTES"`
+	RefreshTokenTTLDays   int `mapstructure:"REFRESH_TOKEN_TTL_DAYS"`
+	JWTKeyRetireHours     int `mapstructure:"JWT_KEY_RETIRE_HOURS"`
+	PasswordResetMinutes  int `mapstructure:"PASSWORD_RESET_TTL_MINUTES"`
+
+	HistoryRetentionDays int `mapstructure:"HISTORY_RETENTION_DAYS"`
+	ArchiveRetentionDays int `mapstructure:"ARCHIVE_RETENTION_DAYS"`
+	FeedMaxSize          int `mapstructure:"FEED_MAX_SIZE"`
+	DisputeHideThreshold int `mapstructure:"DISPUTE_HIDE_THRESHOLD"`
+
+	ReputationTrustedScore int `mapstructure:"REPUTATION_TRUSTED_SCORE"`
+	ReputationNewScore     int `mapstructure:"REPUTATION_NEW_SCORE"`
+	SubmitLimitRegular     int `mapstructure:"SUBMIT_LIMIT_REGULAR"`
+	SubmitLimitNew         int `mapstructure:"SUBMIT_LIMIT_NEW"`
+
+	ModerationMode string `mapstructure:"MODERATION_MODE"`
+	OutlierPolicy  string `mapstructure:"OUTLIER_POLICY"`
+
+	IdempotencyWindowHours int `mapstructure:"IDEMPOTENCY_WINDOW_HOURS"`
+
+	StreamMaxPerIP int `mapstructure:"STREAM_MAX_PER_IP"`
+
+	CaptchaProvider      string `mapstructure:"CAPTCHA_PROVIDER"`
+	CaptchaVerifyURL     string `mapstructure:"CAPTCHA_VERIFY_URL"`
+	CaptchaSecret        string `mapstructure:"CAPTCHA_SECRET"`
+	CaptchaSiteKey       string `mapstructure:"CAPTCHA_SITE_KEY"`
+	CaptchaPoWDifficulty int    `mapstructure:"CAPTCHA_POW_DIFFICULTY"`
+	CaptchaOnSubmit      bool   `mapstructure:"CAPTCHA_ON_SUBMIT"`
+	CaptchaOnFeedback    bool   `mapstructure:"CAPTCHA_ON_FEEDBACK"`
+
+	RetentionPolicy       string `mapstructure:"RETENTION_POLICY"`
+	RetentionWindowHours  int    `mapstructure:"RETENTION_WINDOW_HOURS"`
+	ExpiryIntervalMinutes int    `mapstructure:"EXPIRY_INTERVAL_MINUTES"`
 
 	BilibiliImportEnabled        bool    `mapstructure:"BILIBILI_IMPORT_ENABLED"`
 	BilibiliImportKeyword        string  `mapstructure:"BILIBILI_IMPORT_KEYWORD"`
@@ -25,6 +61,7 @@ type Config struct {
 	BilibiliImportSearchPageSize int     `mapstructure:"BILIBILI_IMPORT_SEARCH_PAGE_SIZE"`
 	BilibiliImportCommentPages   int     `mapstructure:"BILIBILI_IMPORT_COMMENT_PAGES"`
 	BilibiliImportTimeoutSeconds int     `mapstructure:"BILIBILI_IMPORT_TIMEOUT_SECONDS"`
+	BilibiliImportSchedule       string  `mapstructure:"BILIBILI_IMPORT_SCHEDULE"`
 	BilibiliCookie               string  `mapstructure:"BILIBILI_COOKIE"`
 }
 
@@ -34,10 +71,38 @@ func LoadConfig() (*Config, error) {
 	viper.SetDefault("REDIS_ADDR", "localhost:6379")
 	viper.SetDefault("REDIS_PASSWORD", "")
 	viper.SetDefault("JWT_SECRET", "lingbao-secret-key-change-me")
+	viper.SetDefault("ACCESS_TOKEN_TTL_MINUTES", 15)
+	viper.SetDefault("REFRESH_TOKEN_TTL_DAYS", 30)
+	viper.SetDefault("JWT_KEY_RETIRE_HOURS", 720)
+	viper.SetDefault("PASSWORD_RESET_TTL_MINUTES", 60)
 	viper.SetDefault("CLEANUP_TIME", "00:00")
 	viper.SetDefault("CLEANUP_TIMEZONE", "Local")
 	viper.SetDefault("ADMIN_USERNAME", "")
 	viper.SetDefault("ADMIN_PASSWORD", "")
+	viper.SetDefault("PROXY_HEADER", "X-Real-IP")
+	viper.SetDefault("TRUSTED_PROXIES", "127.0.0.1,::1,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16")
+	viper.SetDefault("HISTORY_RETENTION_DAYS", 30)
+	viper.SetDefault("ARCHIVE_RETENTION_DAYS", 90)
+	viper.SetDefault("FEED_MAX_SIZE", 10000)
+	viper.SetDefault("DISPUTE_HIDE_THRESHOLD", 5)
+	viper.SetDefault("REPUTATION_TRUSTED_SCORE", 50)
+	viper.SetDefault("REPUTATION_NEW_SCORE", 5)
+	viper.SetDefault("SUBMIT_LIMIT_REGULAR", 20)
+	viper.SetDefault("SUBMIT_LIMIT_NEW", 3)
+	viper.SetDefault("MODERATION_MODE", "off")
+	viper.SetDefault("OUTLIER_POLICY", "flag")
+	viper.SetDefault("IDEMPOTENCY_WINDOW_HOURS", 24)
+	viper.SetDefault("STREAM_MAX_PER_IP", 5)
+	viper.SetDefault("CAPTCHA_PROVIDER", "image")
+	viper.SetDefault("CAPTCHA_VERIFY_URL", "")
+	viper.SetDefault("CAPTCHA_SECRET", "")
+	viper.SetDefault("CAPTCHA_SITE_KEY", "")
+	viper.SetDefault("CAPTCHA_POW_DIFFICULTY", 20)
+	viper.SetDefault("CAPTCHA_ON_SUBMIT", false)
+	viper.SetDefault("CAPTCHA_ON_FEEDBACK", false)
+	viper.SetDefault("RETENTION_POLICY", "daily_reset")
+	viper.SetDefault("RETENTION_WINDOW_HOURS", 24)
+	viper.SetDefault("EXPIRY_INTERVAL_MINUTES", 5)
 
 	viper.SetDefault("BILIBILI_IMPORT_ENABLED", true)
 	viper.SetDefault("BILIBILI_IMPORT_KEYWORD", "小马糕")
@@ -47,6 +112,7 @@ func LoadConfig() (*Config, error) {
 	viper.SetDefault("BILIBILI_IMPORT_SEARCH_PAGE_SIZE", 20)
 	viper.SetDefault("BILIBILI_IMPORT_COMMENT_PAGES", 1)
 	viper.SetDefault("BILIBILI_IMPORT_TIMEOUT_SECONDS", 60)
+	viper.SetDefault("BILIBILI_IMPORT_SCHEDULE", "")
 	viper.SetDefault("BILIBILI_COOKIE", "")
 
 	viper.AutomaticEnv()
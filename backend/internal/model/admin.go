@@ -9,6 +9,13 @@ type ResolveFeedbackRequest struct {
 	Action string `json:"action"`
 }
 
+// BulkApproveRequest names the pending submissions to approve, or all of
+// them (oldest first, up to the moderation page limit).
+type BulkApproveRequest struct {
+	IDs []string `json:"ids"`
+	All bool     `json:"all"`
+}
+
 type FeedbackMessage struct {
 	ID           string `json:"id"`
 	Code         string `json:"code"`
@@ -31,3 +38,16 @@ type AdminLogEntry struct {
 	Timestamp int64             `json:"timestamp"`
 	Metadata  map[string]string `json:"metadata,omitempty"`
 }
+
+// SigningKey describes a token signing key without its secret.
+type SigningKey struct {
+	ID        string `json:"id"`
+	CreatedAt int64  `json:"createdAt,omitempty"`
+	RetiresAt int64  `json:"retiresAt,omitempty"`
+	Active    bool   `json:"active"`
+}
+
+// ServiceMetrics reports counters kept in process memory since start.
+type ServiceMetrics struct {
+	SideEffectFailures int64 `json:"sideEffectFailures"`
+}
@@ -1,14 +1,139 @@
 package model
 
+// PriceItem is either a single submission or the live market entry for a
+// code. Re-submitting a code updates the live entry instead of adding a new
+// one; its ID is the ID of the latest submission.
 type PriceItem struct {
-	Code      string  `json:"code"`
-	Price     float64 `json:"price"`
-	Server    string  `json:"server,omitempty"`
-	Timestamp int64   `json:"ts"`
+	ID          string   `json:"id,omitempty"`
+	Code        string   `json:"code"`
+	Price       float64  `json:"price"`
+	Server      string   `json:"server,omitempty"`
+	Source      string   `json:"source,omitempty"`
+	Timestamp   int64    `json:"ts"`
+	FirstSeen   int64    `json:"firstSeen,omitempty"`
+	Submissions int64    `json:"submissions,omitempty"`
+	Servers     []string `json:"servers,omitempty"`
+
+	// Flagged marks a price that looked like an outlier when submitted; on a
+	// live entry it refers to the latest submission.
+	Flagged    bool   `json:"flagged,omitempty"`
+	FlagReason string `json:"flagReason,omitempty"`
+
+	// Community votes on a live entry; filled in when the feed is read.
+	Confirmations int64 `json:"confirmations,omitempty"`
+	Disputes      int64 `json:"disputes,omitempty"`
+
+	// Submitter of a single submission: a user ID, or an anonymous ID for
+	// guests. Only shown to the submitter and to admins.
+	SubmitterID   string `json:"submitterId,omitempty"`
+	SubmitterName string `json:"submitterName,omitempty"`
 }
 
+const (
+	PriceSourceManual   = "manual"
+	PriceSourceBilibili = "bilibili"
+)
+
 type SubmitRequest struct {
 	Code   string  `json:"code"`
 	Price  float64 `json:"price"`
 	Server string  `json:"server"`
 }
+
+type SubmitBatchRequest struct {
+	Items []SubmitRequest `json:"items"`
+}
+
+type UpdateSubmissionRequest struct {
+	Price  *float64 `json:"price"`
+	Server *string  `json:"server"`
+}
+
+type FeedPage struct {
+	Items      []PriceItem `json:"items"`
+	NextCursor string      `json:"nextCursor,omitempty"`
+}
+
+const (
+	FeedEventSubmission = "submission"
+	FeedEventUpdate     = "update"
+	FeedEventDeletion   = "deletion"
+	FeedEventFeedback   = "feedback_resolved"
+	// FeedEventReset tells a resuming client that events were missed and it
+	// should reload the feed.
+	FeedEventReset = "reset"
+)
+
+// FeedEvent is a change to the live feed. Item is the live entry after the
+// change, or the removed entry for deletions; resolved feedback only carries
+// the code.
+type FeedEvent struct {
+	ID        string     `json:"id"`
+	Type      string     `json:"type"`
+	Code      string     `json:"code,omitempty"`
+	Item      *PriceItem `json:"item,omitempty"`
+	Timestamp int64      `json:"ts"`
+}
+
+// PriceHistory is every retained submission of a code, oldest first.
+type PriceHistory struct {
+	Code        string       `json:"code"`
+	Submissions []PriceItem  `json:"submissions"`
+	Summary     PriceSummary `json:"summary"`
+}
+
+type PriceSummary struct {
+	Count  int     `json:"count"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Median float64 `json:"median"`
+}
+
+// ArchiveDay describes one archived market day.
+type ArchiveDay struct {
+	Date       string `json:"date"`
+	Count      int64  `json:"count"`
+	ArchivedAt int64  `json:"archivedAt"`
+}
+
+// MarketStats aggregates the submissions received between From and To (unix
+// milliseconds, widened to whole market-day hours).
+type MarketStats struct {
+	From          int64         `json:"from"`
+	To            int64         `json:"to"`
+	Submissions   int64         `json:"submissions"`
+	DistinctCodes int64         `json:"distinctCodes"`
+	MaxPrice      float64       `json:"maxPrice"`
+	MedianPrice   float64       `json:"medianPrice"`
+	P90Price      float64       `json:"p90Price"`
+	Servers       []ServerStats `json:"servers"`
+	Hourly        []HourlyStats `json:"hourly"`
+}
+
+type ServerStats struct {
+	Server        string  `json:"server"`
+	Submissions   int64   `json:"submissions"`
+	DistinctCodes int64   `json:"distinctCodes"`
+	MaxPrice      float64 `json:"maxPrice"`
+}
+
+// HourlyStats covers the hour starting at Hour (unix milliseconds).
+type HourlyStats struct {
+	Hour          int64   `json:"hour"`
+	Submissions   int64   `json:"submissions"`
+	DistinctCodes int64   `json:"distinctCodes"`
+	MaxPrice      float64 `json:"maxPrice"`
+}
+
+type VoteRequest struct {
+	Vote string `json:"vote"`
+}
+
+// VoteResult is the tally of a code after a vote. Hidden is set when the vote
+// pushed the disputes to the threshold.
+type VoteResult struct {
+	Code          string `json:"code"`
+	Confirmations int64  `json:"confirmations"`
+	Disputes      int64  `json:"disputes"`
+	Hidden        bool   `json:"hidden"`
+}
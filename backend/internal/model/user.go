@@ -15,16 +15,77 @@ type AuthRequest struct {
 	CaptchaCode string `json:"captchaCode"`
 }
 
+// CaptchaChallenge is what a client needs to solve a captcha; which fields
+// are set depends on Provider.
+type CaptchaChallenge struct {
+	Provider  string `json:"provider"`
+	CaptchaID string `json:"captchaId,omitempty"`
+	// Image is a data URL of the code to type back (image).
+	Image string `json:"image,omitempty"`
+	// SiteKey renders the third-party widget (remote).
+	SiteKey string `json:"siteKey,omitempty"`
+	// Challenge and Difficulty describe the proof of work (pow).
+	Challenge  string `json:"challenge,omitempty"`
+	Difficulty int    `json:"difficulty,omitempty"`
+}
+
 type AuthResponse struct {
-	Token    string `json:"token"`
-	Username string `json:"username"`
-	ID       string `json:"id"`
-	IsAdmin  bool   `json:"isAdmin"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	// ExpiresIn is the lifetime of Token in seconds.
+	ExpiresIn int64  `json:"expiresIn"`
+	Username  string `json:"username"`
+	ID        string `json:"id"`
+	IsAdmin   bool   `json:"isAdmin"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"newPassword"`
+}
+
+// PasswordReset is a one-time token an admin hands to a user to set a new
+// password before ExpiresAt (unix milliseconds).
+type PasswordReset struct {
+	Username  string `json:"username"`
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refreshToken"`
+	// All revokes every session of the user, not just this one.
+	All bool `json:"all"`
 }
 
 type UserPublic struct {
-	ID       string `json:"id"`
-	Username string `json:"username"`
-	IsAdmin  bool   `json:"isAdmin"`
-	Banned   bool   `json:"banned"`
+	ID         string `json:"id"`
+	Username   string `json:"username"`
+	IsAdmin    bool   `json:"isAdmin"`
+	Banned     bool   `json:"banned"`
+	Reputation int64  `json:"reputation"`
+}
+
+// Reputation sums up a user's track record. Score weighs the counters:
+// confirmations from other users raise it, codes removed by admins lower it,
+// more so when they were reported. Distinct codes submitted only count for
+// the first few.
+type Reputation struct {
+	UserID        string `json:"userId,omitempty"`
+	Username      string `json:"username"`
+	Score         int64  `json:"score"`
+	Tier          string `json:"tier"`
+	Submissions   int64  `json:"submissions"`
+	Confirmations int64  `json:"confirmations"`
+	Deletions     int64  `json:"deletions"`
+	Reports       int64  `json:"reports"`
 }
@@ -0,0 +1,173 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Lock held by the replica running a job; its value is the fencing token.
+	keyLockPrefix = "scheduler:lock:"
+	// Counter handing out fencing tokens, one per job.
+	keyFencePrefix = "scheduler:fence:"
+
+	lockTTL           = 30 * time.Second
+	lockRenewInterval = lockTTL / 3
+)
+
+// ErrLockLost means the lock of a running job expired or was taken over, so
+// another replica may be running it too.
+var ErrLockLost = errors.New("job lock lost")
+
+// claimScript takes a job's lock and hands out the next fencing token, unless
+// the lock is held or the tick (ARGV[1], 0 for manual runs) was already
+// claimed. Returns 0 when the run must be skipped.
+//
+// KEYS: lock, job state, fence counter
+// ARGV: tick, lock TTL in milliseconds
+var claimScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return 0
+end
+local tick = tonumber(ARGV[1])
+if tick > 0 then
+	local last = tonumber(redis.call('HGET', KEYS[2], 'lastTick') or '0')
+	if last >= tick then
+		return 0
+	end
+	redis.call('HSET', KEYS[2], 'lastTick', ARGV[1])
+end
+local token = redis.call('INCR', KEYS[3])
+redis.call('SET', KEYS[1], token, 'PX', ARGV[2])
+redis.call('HSET', KEYS[2], 'lastToken', token)
+return token
+`)
+
+// renewScript extends the lock if it still carries the token.
+var renewScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseScript deletes the lock if it still carries the token.
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// Lock is a claimed run of a job. Its fencing token grows with every claim,
+// so a replica holding an older token knows it has been superseded.
+type Lock struct {
+	rdb   *redis.Client
+	key   string
+	token int64
+}
+
+type lockContextKey struct{}
+
+func claimLock(ctx context.Context, rdb *redis.Client, job string, tick int64) (*Lock, error) {
+	key := keyLockPrefix + job
+	token, err := claimScript.Run(ctx, rdb,
+		[]string{key, keyJobPrefix + job, keyFencePrefix + job},
+		tick, lockTTL.Milliseconds(),
+	).Int64()
+	if err != nil {
+		return nil, err
+	}
+	if token == 0 {
+		return nil, nil
+	}
+	return &Lock{rdb: rdb, key: key, token: token}, nil
+}
+
+func (l *Lock) Token() int64 {
+	return l.token
+}
+
+// Key is the Redis key holding the lock; while the lock is held its value
+// is the fencing token.
+func (l *Lock) Key() string {
+	return l.key
+}
+
+// Verify returns ErrLockLost unless the lock still carries this token.
+func (l *Lock) Verify(ctx context.Context) error {
+	current, err := l.rdb.Get(ctx, l.key).Result()
+	if err == redis.Nil {
+		return ErrLockLost
+	}
+	if err != nil {
+		return err
+	}
+	if current != strconv.FormatInt(l.token, 10) {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// keepAlive renews the lock until the returned stop function is called. If
+// the lock is lost, cancel is called with ErrLockLost.
+func (l *Lock) keepAlive(ctx context.Context, cancel context.CancelCauseFunc) func() {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(lockRenewInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				renewed, err := renewScript.Run(ctx, l.rdb, []string{l.key}, l.token, lockTTL.Milliseconds()).Int64()
+				if err != nil {
+					// A transient error is fine as long as a later renewal
+					// lands before the TTL runs out.
+					log.Printf("Renewing %s failed: %v", l.key, err)
+					continue
+				}
+				if renewed == 0 {
+					cancel(ErrLockLost)
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+func (l *Lock) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := releaseScript.Run(ctx, l.rdb, []string{l.key}, l.token).Err(); err != nil {
+		log.Printf("Releasing %s failed: %v", l.key, err)
+	}
+}
+
+func withLock(ctx context.Context, lock *Lock) context.Context {
+	return context.WithValue(ctx, lockContextKey{}, lock)
+}
+
+// LockFromContext returns the lock of the job run ctx belongs to. Jobs pass
+// its Key and Token to their writes as a fence, so Redis itself refuses the
+// writes of a run that was taken over; Verify is only a cheap early check.
+func LockFromContext(ctx context.Context) (*Lock, bool) {
+	lock, ok := ctx.Value(lockContextKey{}).(*Lock)
+	return lock, ok
+}
@@ -0,0 +1,383 @@
+// Package scheduler runs named background jobs on cron schedules and keeps
+// their run state in Redis so admins can inspect, trigger, pause and resume
+// them. Every replica runs the same schedules; a Redis lock per job makes
+// sure each tick runs on exactly one of them.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/robfig/cron/v3"
+)
+
+// Hash per job with lastRun, lastDuration, lastError, nextRun, paused and
+// the lastTick/lastToken of the latest claim.
+const keyJobPrefix = "scheduler:job:"
+
+const defaultJobTimeout = time.Minute
+
+var (
+	ErrJobNotFound = errors.New("job not found")
+	ErrJobExists   = errors.New("job already registered")
+)
+
+// Job is a unit of background work.
+type Job struct {
+	Name string
+	// Schedule is a standard five-field cron expression or a descriptor such
+	// as @hourly or @every 5m. Jobs without one only run when triggered or
+	// after the job named in After.
+	Schedule string
+	// After names a job whose successful runs also start this one.
+	After   string
+	Timeout time.Duration
+	Run     func(ctx context.Context) error
+}
+
+// Status is a job's configuration plus the run state shared by every
+// replica.
+type Status struct {
+	Name         string `json:"name"`
+	Schedule     string `json:"schedule,omitempty"`
+	After        string `json:"after,omitempty"`
+	Timeout      int64  `json:"timeoutSeconds"`
+	Paused       bool   `json:"paused"`
+	Running      bool   `json:"running"`
+	LastToken    int64  `json:"lastToken,omitempty"`
+	LastRun      int64  `json:"lastRun,omitempty"`
+	LastDuration int64  `json:"lastDurationMs,omitempty"`
+	LastError    string `json:"lastError,omitempty"`
+	NextRun      int64  `json:"nextRun,omitempty"`
+}
+
+type runReason int
+
+const (
+	runScheduled runReason = iota
+	runChained
+	runManual
+)
+
+// trigger asks for a run. Scheduled runs carry their tick and chained runs
+// the tick of the run that started them; manual runs have none.
+type trigger struct {
+	reason runReason
+	tick   int64
+}
+
+type entry struct {
+	job      Job
+	schedule cron.Schedule
+	trigger  chan trigger
+
+	mu      sync.Mutex
+	running bool
+}
+
+type Scheduler struct {
+	rdb *redis.Client
+	loc *time.Location
+
+	mu      sync.Mutex
+	jobs    map[string]*entry
+	order   []string
+	started bool
+	wg      sync.WaitGroup
+}
+
+// New creates a scheduler that evaluates cron expressions in loc.
+func New(rdb *redis.Client, loc *time.Location) *Scheduler {
+	if loc == nil {
+		loc = time.Local
+	}
+	return &Scheduler{rdb: rdb, loc: loc, jobs: make(map[string]*entry)}
+}
+
+// Register adds a job. All jobs must be registered before Start.
+func (s *Scheduler) Register(job Job) error {
+	if job.Name == "" || job.Run == nil {
+		return errors.New("job needs a name and a run function")
+	}
+	if job.Timeout <= 0 {
+		job.Timeout = defaultJobTimeout
+	}
+
+	var schedule cron.Schedule
+	if job.Schedule != "" {
+		parsed, err := cron.ParseStandard(job.Schedule)
+		if err != nil {
+			return fmt.Errorf("job %s: invalid schedule %q: %w", job.Name, job.Schedule, err)
+		}
+		schedule = parsed
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return errors.New("scheduler already started")
+	}
+	if _, ok := s.jobs[job.Name]; ok {
+		return ErrJobExists
+	}
+	s.jobs[job.Name] = &entry{job: job, schedule: schedule, trigger: make(chan trigger, 1)}
+	s.order = append(s.order, job.Name)
+	return nil
+}
+
+// Start runs every registered job until ctx is done. Wait blocks until the
+// jobs in flight have returned.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return
+	}
+	s.started = true
+	for _, name := range s.order {
+		e := s.jobs[name]
+		s.wg.Add(1)
+		go s.loop(ctx, e)
+	}
+}
+
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+// Trigger runs a job now, even if it is paused. A running job runs again once
+// it is done; triggers for a job that already has a run queued are merged.
+func (s *Scheduler) Trigger(name string) error {
+	e, ok := s.job(name)
+	if !ok {
+		return ErrJobNotFound
+	}
+	s.enqueue(e, trigger{reason: runManual})
+	return nil
+}
+
+// Pause stops scheduled and chained runs of a job on every replica.
+func (s *Scheduler) Pause(ctx context.Context, name string) error {
+	return s.setPaused(ctx, name, true)
+}
+
+func (s *Scheduler) Resume(ctx context.Context, name string) error {
+	return s.setPaused(ctx, name, false)
+}
+
+// List returns the status of every job in registration order.
+func (s *Scheduler) List(ctx context.Context) ([]Status, error) {
+	s.mu.Lock()
+	entries := make([]*entry, 0, len(s.order))
+	for _, name := range s.order {
+		entries = append(entries, s.jobs[name])
+	}
+	s.mu.Unlock()
+
+	pipe := s.rdb.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(entries))
+	locked := make([]*redis.IntCmd, len(entries))
+	for i, e := range entries {
+		cmds[i] = pipe.HGetAll(ctx, keyJobPrefix+e.job.Name)
+		locked[i] = pipe.Exists(ctx, keyLockPrefix+e.job.Name)
+	}
+	if len(entries) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	statuses := make([]Status, 0, len(entries))
+	for i, e := range entries {
+		state := cmds[i].Val()
+		status := Status{
+			Name:      e.job.Name,
+			Schedule:  e.job.Schedule,
+			After:     e.job.After,
+			Timeout:   int64(e.job.Timeout / time.Second),
+			Paused:    state["paused"] == "1",
+			Running:   e.isRunning() || locked[i].Val() > 0,
+			LastError: state["lastError"],
+		}
+		status.LastRun, _ = strconv.ParseInt(state["lastRun"], 10, 64)
+		status.LastDuration, _ = strconv.ParseInt(state["lastDuration"], 10, 64)
+		status.NextRun, _ = strconv.ParseInt(state["nextRun"], 10, 64)
+		status.LastToken, _ = strconv.ParseInt(state["lastToken"], 10, 64)
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func (s *Scheduler) loop(ctx context.Context, e *entry) {
+	defer s.wg.Done()
+	for {
+		var timer *time.Timer
+		var fire <-chan time.Time
+		var next time.Time
+		if e.schedule != nil {
+			next = nextRun(e.schedule, time.Now().In(s.loc))
+			if !next.IsZero() {
+				s.setState(ctx, e.job.Name, "nextRun", next.UnixMilli())
+				timer = time.NewTimer(time.Until(next))
+				fire = timer.C
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-fire:
+			s.run(ctx, e, trigger{reason: runScheduled, tick: next.UnixMilli()})
+		case t := <-e.trigger:
+			if timer != nil {
+				timer.Stop()
+			}
+			s.run(ctx, e, t)
+		}
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, e *entry, t trigger) {
+	name := e.job.Name
+	if t.reason != runManual {
+		paused, err := s.isPaused(ctx, name)
+		if err != nil {
+			log.Printf("Job %s: reading state failed: %v", name, err)
+		}
+		if paused {
+			return
+		}
+	}
+
+	lock, err := claimLock(ctx, s.rdb, name, t.tick)
+	if err != nil {
+		log.Printf("Job %s: claiming lock failed: %v", name, err)
+		return
+	}
+	if lock == nil {
+		// Another replica is running it or already ran this tick.
+		return
+	}
+	defer lock.release()
+
+	e.setRunning(true)
+	started := time.Now()
+	lockCtx, cancelLock := context.WithCancelCause(ctx)
+	runCtx, cancel := context.WithTimeout(withLock(lockCtx, lock), e.job.Timeout)
+	stopRenew := lock.keepAlive(runCtx, cancelLock)
+	err = e.job.Run(runCtx)
+	if cause := context.Cause(lockCtx); errors.Is(cause, ErrLockLost) {
+		err = cause
+	}
+	stopRenew()
+	cancel()
+	cancelLock(nil)
+	e.setRunning(false)
+
+	lastError := ""
+	if err != nil {
+		lastError = err.Error()
+		log.Printf("Job %s failed: %v", name, err)
+	} else {
+		log.Printf("Job %s finished in %s", name, time.Since(started).Round(time.Millisecond))
+	}
+
+	stateCtx, stateCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer stateCancel()
+	if err := s.rdb.HSet(stateCtx, keyJobPrefix+name,
+		"lastRun", started.UnixMilli(),
+		"lastDuration", time.Since(started).Milliseconds(),
+		"lastError", lastError,
+	).Err(); err != nil {
+		log.Printf("Job %s: saving state failed: %v", name, err)
+	}
+
+	if err == nil {
+		s.startDependents(name, t.tick)
+	}
+}
+
+func (s *Scheduler) startDependents(name string, tick int64) {
+	s.mu.Lock()
+	var dependents []*entry
+	for _, other := range s.order {
+		if e := s.jobs[other]; e.job.After == name {
+			dependents = append(dependents, e)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, e := range dependents {
+		s.enqueue(e, trigger{reason: runChained, tick: tick})
+	}
+}
+
+func (s *Scheduler) enqueue(e *entry, t trigger) {
+	select {
+	case e.trigger <- t:
+	default:
+	}
+}
+
+func (s *Scheduler) job(name string) (*entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.jobs[name]
+	return e, ok
+}
+
+func (s *Scheduler) isPaused(ctx context.Context, name string) (bool, error) {
+	val, err := s.rdb.HGet(ctx, keyJobPrefix+name, "paused").Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	return val == "1", err
+}
+
+func (s *Scheduler) setPaused(ctx context.Context, name string, paused bool) error {
+	if _, ok := s.job(name); !ok {
+		return ErrJobNotFound
+	}
+	value := "0"
+	if paused {
+		value = "1"
+	}
+	return s.rdb.HSet(ctx, keyJobPrefix+name, "paused", value).Err()
+}
+
+func (s *Scheduler) setState(ctx context.Context, name, field string, value interface{}) {
+	if err := s.rdb.HSet(ctx, keyJobPrefix+name, field, value).Err(); err != nil && ctx.Err() == nil {
+		log.Printf("Job %s: saving state failed: %v", name, err)
+	}
+}
+
+// nextRun is the schedule's next activation after t. Fixed intervals are
+// aligned to multiples of the interval so that every replica arrives at the
+// same ticks.
+func nextRun(schedule cron.Schedule, t time.Time) time.Time {
+	if every, ok := schedule.(cron.ConstantDelaySchedule); ok {
+		return t.Truncate(every.Delay).Add(every.Delay)
+	}
+	return schedule.Next(t)
+}
+
+func (e *entry) setRunning(running bool) {
+	e.mu.Lock()
+	e.running = running
+	e.mu.Unlock()
+}
+
+func (e *entry) isRunning() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.running
+}
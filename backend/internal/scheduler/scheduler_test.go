@@ -0,0 +1,77 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRegister(t *testing.T) {
+	t.Parallel()
+
+	noop := func(context.Context) error { return nil }
+
+	t.Run("defaults", func(t *testing.T) {
+		s := New(nil, time.UTC)
+		if err := s.Register(Job{Name: "cleanup", Schedule: "30 3 * * *", Run: noop}); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		if timeout := s.jobs["cleanup"].job.Timeout; timeout != defaultJobTimeout {
+			t.Fatalf("expected default timeout, got %v", timeout)
+		}
+		next := s.jobs["cleanup"].schedule.Next(time.Date(2024, 5, 1, 4, 0, 0, 0, time.UTC))
+		if want := time.Date(2024, 5, 2, 3, 30, 0, 0, time.UTC); !next.Equal(want) {
+			t.Fatalf("expected %v, got %v", want, next)
+		}
+	})
+
+	t.Run("descriptor", func(t *testing.T) {
+		s := New(nil, time.UTC)
+		if err := s.Register(Job{Name: "expiry", Schedule: "@every 5m", Run: noop}); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+	})
+
+	t.Run("invalid schedule", func(t *testing.T) {
+		s := New(nil, time.UTC)
+		if err := s.Register(Job{Name: "bad", Schedule: "61 * * * *", Run: noop}); err == nil {
+			t.Fatalf("expected error, got nil")
+		}
+	})
+
+	t.Run("duplicate", func(t *testing.T) {
+		s := New(nil, time.UTC)
+		_ = s.Register(Job{Name: "import", Run: noop})
+		if err := s.Register(Job{Name: "import", Run: noop}); !errors.Is(err, ErrJobExists) {
+			t.Fatalf("expected ErrJobExists, got %v", err)
+		}
+	})
+
+	t.Run("unknown trigger", func(t *testing.T) {
+		s := New(nil, time.UTC)
+		if err := s.Trigger("missing"); !errors.Is(err, ErrJobNotFound) {
+			t.Fatalf("expected ErrJobNotFound, got %v", err)
+		}
+	})
+}
+
+func TestNextRunAlignsIntervals(t *testing.T) {
+	t.Parallel()
+
+	s := New(nil, time.UTC)
+	noop := func(context.Context) error { return nil }
+	if err := s.Register(Job{Name: "expiry", Schedule: "@every 5m", Run: noop}); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	schedule := s.jobs["expiry"].schedule
+
+	// Replicas whose clocks read different moments in the same interval
+	// must agree on the tick.
+	a := nextRun(schedule, time.Date(2024, 5, 1, 10, 1, 7, 0, time.UTC))
+	b := nextRun(schedule, time.Date(2024, 5, 1, 10, 4, 59, 0, time.UTC))
+	want := time.Date(2024, 5, 1, 10, 5, 0, 0, time.UTC)
+	if !a.Equal(want) || !b.Equal(want) {
+		t.Fatalf("expected both at %v, got %v and %v", want, a, b)
+	}
+}
@@ -22,6 +22,8 @@ const (
 	feedbackIndexKey  = "admin:feedback:index"
 	adminLogsKey      = "admin:logs"
 	adminLogsMax      = 500
+	// Pub/sub channel carrying every entry written by AppendLog.
+	adminLogsChannel = "admin:logs:live"
 )
 
 func NewAdminService(rdb *redis.Client) *AdminService {
@@ -171,6 +173,13 @@ func (s *AdminService) ResolveFeedback(
 		return nil, err
 	}
 
+	// The feed is public: reporter, reason and resolver stay with the
+	// admin log, subscribers only learn which code was reviewed.
+	publishFeedEvent(ctx, s.rdb, model.FeedEvent{
+		Type: model.FeedEventFeedback,
+		Code: feedback.Code,
+	})
+
 	return feedback, nil
 }
 
@@ -193,10 +202,50 @@ func (s *AdminService) AppendLog(ctx context.Context, entry model.AdminLogEntry)
 	pipe := s.rdb.TxPipeline()
 	pipe.LPush(ctx, adminLogsKey, val)
 	pipe.LTrim(ctx, adminLogsKey, 0, adminLogsMax-1)
+	pipe.Publish(ctx, adminLogsChannel, val)
 	_, err = pipe.Exec(ctx)
 	return err
 }
 
+// SubscribeLogs delivers admin log entries as they are appended, until ctx is
+// done.
+func (s *AdminService) SubscribeLogs(ctx context.Context) (<-chan model.AdminLogEntry, error) {
+	sub := s.rdb.Subscribe(ctx, adminLogsChannel)
+	if _, err := sub.Receive(ctx); err != nil {
+		_ = sub.Close()
+		return nil, err
+	}
+
+	out := make(chan model.AdminLogEntry, feedEventBufferSize)
+	go func() {
+		defer close(out)
+		defer sub.Close()
+
+		messages := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				var entry model.AdminLogEntry
+				if err := json.Unmarshal([]byte(msg.Payload), &entry); err != nil {
+					continue
+				}
+				select {
+				case out <- entry:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return out, nil
+}
+
 func (s *AdminService) ListLogs(ctx context.Context, limit int64) ([]model.AdminLogEntry, error) {
 	if limit <= 0 {
 		limit = 100
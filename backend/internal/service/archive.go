@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/lingbao-market/backend/internal/model"
+	"github.com/redis/go-redis/v9"
+)
+
+// ArchiveDateLayout is the format of market day dates.
+const ArchiveDateLayout = "2006-01-02"
+
+const (
+	// Each archived day keeps the entries in a hash of code -> JSON record
+	// plus time and price sorted sets of codes, mirroring the live feed.
+	keyArchivePrefix = "market:archive:"
+	// Sorted set of archived dates scored by when they were written.
+	keyArchiveDates = "market:archive:dates"
+
+	defaultArchiveRetention = 90 * 24 * time.Hour
+	archiveBatchSize        = 200
+)
+
+var (
+	ErrArchiveNotFound    = errors.New("archive not found")
+	ErrInvalidArchiveDate = errors.New("invalid archive date")
+)
+
+// ArchiveFeed snapshots every live entry into the archive for a market day.
+// Archiving the same day again merges into the existing snapshot.
+func (s *PriceService) ArchiveFeed(ctx context.Context, date string) (int64, error) {
+	if _, err := time.Parse(ArchiveDateLayout, date); err != nil {
+		return 0, ErrInvalidArchiveDate
+	}
+	codes, err := s.indexedCodes(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var archived int64
+	for start := 0; start < len(codes); start += archiveBatchSize {
+		end := start + archiveBatchSize
+		if end > len(codes) {
+			end = len(codes)
+		}
+		items, err := s.loadCodeRecords(ctx, codes[start:end])
+		if err != nil {
+			return archived, err
+		}
+		if len(items) == 0 {
+			continue
+		}
+
+		pipe := s.rdb.TxPipeline()
+		if err := queueArchiveItems(ctx, pipe, date, items); err != nil {
+			return archived, err
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return archived, err
+		}
+		archived += int64(len(items))
+	}
+
+	pipe := s.rdb.TxPipeline()
+	s.queueArchiveDate(ctx, pipe, date, false)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return archived, err
+	}
+	return archived, nil
+}
+
+// archiveExpiring archives the entries the next expiry batch will drop into
+// the market days they were last updated in, so a rolling window loses
+// nothing the daily snapshot would have kept.
+func (s *PriceService) archiveExpiring(ctx context.Context, cutoff time.Time) error {
+	codes, err := s.rdb.ZRangeByScore(ctx, keyPriceTime, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(cutoff.UnixMilli(), 10),
+		Count: feedTrimBatch,
+	}).Result()
+	if err != nil || len(codes) == 0 {
+		return err
+	}
+	items, err := s.loadCodeRecords(ctx, codes)
+	if err != nil {
+		return err
+	}
+
+	byDate := make(map[string][]model.PriceItem)
+	for _, item := range items {
+		date := s.opts.MarketDay.Date(time.UnixMilli(item.Timestamp))
+		byDate[date] = append(byDate[date], item)
+	}
+	pipe := s.rdb.TxPipeline()
+	for date, dayItems := range byDate {
+		if err := queueArchiveItems(ctx, pipe, date, dayItems); err != nil {
+			return err
+		}
+		// The day may still be open; its snapshot dates it when it closes.
+		s.queueArchiveDate(ctx, pipe, date, true)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// queueArchiveItems queues records into a day's archive, replacing earlier
+// copies of their codes.
+func queueArchiveItems(ctx context.Context, pipe redis.Pipeliner, date string, items []model.PriceItem) error {
+	itemsKey, timeKey, priceKey := archiveKeys(date)
+	for _, item := range items {
+		val, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		pipe.HSet(ctx, itemsKey, item.Code, val)
+		pipe.ZAdd(ctx, timeKey, redis.Z{Score: float64(item.Timestamp), Member: item.Code})
+		pipe.ZAdd(ctx, priceKey, redis.Z{Score: item.Price, Member: item.Code})
+	}
+	return nil
+}
+
+// queueArchiveDate queues the retention of a day's archive and lists the
+// day, dated now. With keepDate an already listed day keeps its date.
+func (s *PriceService) queueArchiveDate(ctx context.Context, pipe redis.Pipeliner, date string, keepDate bool) {
+	itemsKey, timeKey, priceKey := archiveKeys(date)
+	now := time.Now()
+	cutoff := now.Add(-s.opts.ArchiveRetention).UnixMilli()
+	pipe.Expire(ctx, itemsKey, s.opts.ArchiveRetention)
+	pipe.Expire(ctx, timeKey, s.opts.ArchiveRetention)
+	pipe.Expire(ctx, priceKey, s.opts.ArchiveRetention)
+	entry := redis.Z{Score: float64(now.UnixMilli()), Member: date}
+	if keepDate {
+		pipe.ZAddNX(ctx, keyArchiveDates, entry)
+	} else {
+		pipe.ZAdd(ctx, keyArchiveDates, entry)
+	}
+	pipe.ZRemRangeByScore(ctx, keyArchiveDates, "-inf", fmt.Sprintf("(%d", cutoff))
+}
+
+// ListArchives returns the retained archive days, newest first.
+func (s *PriceService) ListArchives(ctx context.Context) ([]model.ArchiveDay, error) {
+	cutoff := time.Now().Add(-s.opts.ArchiveRetention).UnixMilli()
+	dates, err := s.rdb.ZRevRangeByScoreWithScores(ctx, keyArchiveDates, &redis.ZRangeBy{
+		Min: fmt.Sprintf("%d", cutoff),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := s.rdb.Pipeline()
+	counts := make([]*redis.IntCmd, len(dates))
+	for i, z := range dates {
+		itemsKey, _, _ := archiveKeys(z.Member.(string))
+		counts[i] = pipe.HLen(ctx, itemsKey)
+	}
+	if len(dates) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	days := make([]model.ArchiveDay, 0, len(dates))
+	for i, z := range dates {
+		days = append(days, model.ArchiveDay{
+			Date:       z.Member.(string),
+			Count:      counts[i].Val(),
+			ArchivedAt: int64(z.Score),
+		})
+	}
+	return days, nil
+}
+
+// GetArchive returns one page of an archived day, sorted and paged like the
+// live feed. Filters are not supported.
+func (s *PriceService) GetArchive(ctx context.Context, date string, q FeedQuery) (*model.FeedPage, error) {
+	if _, err := time.Parse(ArchiveDateLayout, date); err != nil {
+		return nil, ErrInvalidArchiveDate
+	}
+	sortBy := normalizeFeedSort(q.Sort)
+	limit := clampFeedLimit(q.Limit)
+	after, err := decodeQueryCursor(q.Cursor, sortBy)
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := s.ArchiveExists(ctx, date)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrArchiveNotFound
+	}
+
+	itemsKey, timeKey, priceKey := archiveKeys(date)
+	// Archives keep no confirmed index; that sort falls back to time.
+	key := timeKey
+	if sortBy == "price" {
+		key = priceKey
+	}
+	load := func(ctx context.Context, codes []string) ([]model.PriceItem, error) {
+		return s.loadArchiveRecords(ctx, itemsKey, codes)
+	}
+	return s.readFeedPage(ctx, key, "-inf", "+inf", sortBy, after, limit, load)
+}
+
+// ArchiveExists reports whether a market day has been archived.
+func (s *PriceService) ArchiveExists(ctx context.Context, date string) (bool, error) {
+	if _, err := time.Parse(ArchiveDateLayout, date); err != nil {
+		return false, ErrInvalidArchiveDate
+	}
+	itemsKey, _, _ := archiveKeys(date)
+	exists, err := s.rdb.Exists(ctx, itemsKey).Result()
+	if err != nil {
+		return false, err
+	}
+	return exists > 0, nil
+}
+
+func (s *PriceService) loadArchiveRecords(ctx context.Context, itemsKey string, codes []string) ([]model.PriceItem, error) {
+	if len(codes) == 0 {
+		return nil, nil
+	}
+
+	vals, err := s.rdb.HMGet(ctx, itemsKey, codes...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var items []model.PriceItem
+	for _, val := range vals {
+		raw, ok := val.(string)
+		if !ok {
+			continue
+		}
+		var item model.PriceItem
+		if err := json.Unmarshal([]byte(raw), &item); err == nil {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func archiveKeys(date string) (string, string, string) {
+	prefix := keyArchivePrefix + date
+	return prefix + ":items", prefix + ":time", prefix + ":price"
+}
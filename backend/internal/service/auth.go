@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"math/big"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,19 +18,60 @@ import (
 )
 
 type AuthService struct {
-	rdb       *redis.Client
-	jwtSecret []byte
+	rdb     *redis.Client
+	keyring *Keyring
+	captcha CaptchaProvider
+	opts    AuthServiceOptions
 }
 
+type AuthServiceOptions struct {
+	// Captcha guards login and register; nil means the image captcha.
+	Captcha CaptchaProvider
+	// CaptchaOnSubmit and CaptchaOnFeedback extend it to POST /submit
+	// (and /submit/batch) and POST /feedback.
+	CaptchaOnSubmit   bool
+	CaptchaOnFeedback bool
+	// AccessTokenTTL is the lifetime of bearer tokens; RefreshTokenTTL that
+	// of the refresh tokens that renew them.
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// KeyRetireAfter is how long a rotated-out signing key still verifies
+	// tokens.
+	KeyRetireAfter time.Duration
+	// PasswordResetTTL is how long an admin-issued reset token works.
+	PasswordResetTTL time.Duration
+}
+
+// Endpoints that can be configured to require a captcha.
+const (
+	CaptchaScopeSubmit   = "submit"
+	CaptchaScopeFeedback = "feedback"
+)
+
 const (
 	userKeyPrefix = "auth:user:"
 	userIndexKey  = "auth:users"
 )
 
-func NewAuthService(rdb *redis.Client, jwtSecret string) *AuthService {
+func NewAuthService(rdb *redis.Client, jwtSecret string, opts AuthServiceOptions) *AuthService {
+	captcha := opts.Captcha
+	if captcha == nil {
+		captcha = NewImageCaptcha(rdb)
+	}
+	if opts.AccessTokenTTL <= 0 {
+		opts.AccessTokenTTL = defaultAccessTokenTTL
+	}
+	if opts.RefreshTokenTTL <= 0 {
+		opts.RefreshTokenTTL = defaultRefreshTokenTTL
+	}
+	if opts.PasswordResetTTL <= 0 {
+		opts.PasswordResetTTL = defaultPasswordResetTTL
+	}
 	return &AuthService{
-		rdb:       rdb,
-		jwtSecret: []byte(jwtSecret),
+		rdb:     rdb,
+		keyring: NewKeyring(rdb, jwtSecret, opts.KeyRetireAfter),
+		captcha: captcha,
+		opts:    opts,
 	}
 }
 
@@ -70,7 +112,7 @@ func (s *AuthService) Login(ctx context.Context, username, password string) (*mo
 	// 1. Get User
 	val, err := s.rdb.Get(ctx, userKeyPrefix+username).Result()
 	if err == redis.Nil {
-		return nil, errors.New("invalid credentials")
+		return nil, ErrInvalidCredentials
 	}
 	if err != nil {
 		return nil, err
@@ -81,72 +123,49 @@ func (s *AuthService) Login(ctx context.Context, username, password string) (*mo
 		return nil, err
 	}
 	if user.Banned {
-		return nil, errors.New("account banned")
+		return nil, ErrAccountBanned
 	}
 
 	// 2. Verify Password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-		return nil, errors.New("invalid credentials")
+		return nil, ErrInvalidCredentials
 	}
 
-	// 3. Generate JWT
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub":      user.ID,
-		"username": user.Username,
-		"admin":    user.IsAdmin,
-		"exp":      time.Now().Add(72 * time.Hour).Unix(),
-	})
-
-	tokenString, err := token.SignedString(s.jwtSecret)
+	// 3. Issue access and refresh tokens
+	version, err := s.tokenVersion(ctx, user.Username)
 	if err != nil {
 		return nil, err
 	}
-
-	return &model.AuthResponse{
-		Token:    tokenString,
-		Username: user.Username,
-		ID:       user.ID,
-		IsAdmin:  user.IsAdmin,
-	}, nil
+	return s.issueTokens(ctx, &user, version)
 }
 
-func (s *AuthService) CreateCaptcha(ctx context.Context) (string, string, error) {
-	id := uuid.New().String()
-	code, err := randomCode(4)
-	if err != nil {
-		return "", "", err
-	}
-
-	if err := s.rdb.Set(ctx, "auth:captcha:"+id, code, 5*time.Minute).Err(); err != nil {
-		return "", "", err
-	}
-
-	return id, code, nil
+// CreateCaptcha issues a challenge from the configured provider.
+func (s *AuthService) CreateCaptcha(ctx context.Context) (*model.CaptchaChallenge, error) {
+	return s.captcha.Create(ctx)
 }
 
-func (s *AuthService) VerifyCaptcha(ctx context.Context, id, code string) (bool, error) {
-	if id == "" || code == "" {
-		return false, nil
-	}
-
-	val, err := s.rdb.Get(ctx, "auth:captcha:"+id).Result()
-	if err == redis.Nil {
-		return false, nil
-	}
-	if err != nil {
-		return false, err
-	}
-
-	return strings.EqualFold(val, code), nil
+// VerifyCaptcha checks a captcha answer. A captcha is single-use: it is
+// consumed by the first attempt, so a wrong guess burns it.
+func (s *AuthService) VerifyCaptcha(ctx context.Context, id, answer, remoteIP string) (bool, error) {
+	return s.captcha.Verify(ctx, id, answer, remoteIP)
 }
 
-func (s *AuthService) DeleteCaptcha(ctx context.Context, id string) error {
-	if id == "" {
-		return nil
+// CaptchaRequired reports whether an endpoint beyond login and register
+// asks for a captcha.
+func (s *AuthService) CaptchaRequired(scope string) bool {
+	switch scope {
+	case CaptchaScopeSubmit:
+		return s.opts.CaptchaOnSubmit
+	case CaptchaScopeFeedback:
+		return s.opts.CaptchaOnFeedback
 	}
-	return s.rdb.Del(ctx, "auth:captcha:"+id).Err()
+	return false
 }
 
+// EnsureAdmin creates the configured admin account, or makes an existing
+// account of that name an admin. The password only applies on creation, so a
+// password changed through the API survives restarts; a forgotten one is
+// recovered with a reset token.
 func (s *AuthService) EnsureAdmin(ctx context.Context, username, password string) (*model.User, error) {
 	if username == "" || password == "" {
 		return nil, nil
@@ -160,20 +179,8 @@ func (s *AuthService) EnsureAdmin(ctx context.Context, username, password string
 		if err != nil {
 			return nil, err
 		}
-		updated := false
 		if !user.IsAdmin {
 			user.IsAdmin = true
-			updated = true
-		}
-		if password != "" {
-			hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-			if err != nil {
-				return nil, err
-			}
-			user.PasswordHash = string(hash)
-			updated = true
-		}
-		if updated {
 			if err := s.saveUser(ctx, user); err != nil {
 				return nil, err
 			}
@@ -245,11 +252,16 @@ func (s *AuthService) SetBanned(ctx context.Context, username string, banned boo
 	if err := s.saveUser(ctx, user); err != nil {
 		return nil, err
 	}
+	if banned {
+		if _, err := s.RevokeTokens(ctx, username); err != nil {
+			return nil, err
+		}
+	}
 	return user, nil
 }
 
 func (s *AuthService) DeleteUser(ctx context.Context, username string) error {
-	if err := s.rdb.Del(ctx, userKeyPrefix+username).Err(); err != nil {
+	if err := s.rdb.Del(ctx, userKeyPrefix+username, keyTokenVersionPrefix+username).Err(); err != nil {
 		return err
 	}
 	return s.rdb.SRem(ctx, userIndexKey, username).Err()
@@ -276,15 +288,119 @@ func (s *AuthService) saveUser(ctx context.Context, user *model.User) error {
 	return err
 }
 
+// SubmitterTokenType marks the tokens issued to anonymous submitters, which
+// identify a guest's submissions but never authenticate a user.
+const SubmitterTokenType = "submitter"
+
+var ErrInvalidSubmitterToken = errors.New("invalid submitter token")
+
+const (
+	keySubmitterTokenLimitPrefix = "ratelimit:submitter-token:"
+
+	// A client gets submitterTokenLimit new guest identities per
+	// submitterTokenWindow, so it can't mint a crowd of voters.
+	submitterTokenLimit  = 5
+	submitterTokenWindow = 24 * time.Hour
+)
+
+// IssueSubmitterToken creates a new anonymous submitter ID and a signed token
+// carrying it.
+func (s *AuthService) IssueSubmitterToken(ctx context.Context) (string, string, error) {
+	id := AnonymousSubmitterPrefix + uuid.New().String()
+	tokenString, err := s.keyring.Sign(ctx, jwt.MapClaims{
+		"sub": id,
+		"typ": SubmitterTokenType,
+		"iat": time.Now().Unix(),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return tokenString, id, nil
+}
+
+// AllowSubmitterToken takes one of the client's guest identity slots. It
+// reports false once the client has used them up for the window.
+func (s *AuthService) AllowSubmitterToken(ctx context.Context, client string) (bool, error) {
+	window := time.Now().Truncate(submitterTokenWindow).Unix()
+	counter := keySubmitterTokenLimitPrefix + client + ":" + strconv.FormatInt(window, 10)
+	pipe := s.rdb.TxPipeline()
+	count := pipe.Incr(ctx, counter)
+	pipe.Expire(ctx, counter, submitterTokenWindow)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+	return count.Val() <= submitterTokenLimit, nil
+}
+
+// ParseSubmitterToken returns the anonymous submitter ID of a token issued by
+// IssueSubmitterToken, and when it was issued.
+func (s *AuthService) ParseSubmitterToken(ctx context.Context, tokenString string) (string, time.Time, error) {
+	token, err := s.keyring.Parse(ctx, tokenString)
+	if err != nil || !token.Valid {
+		return "", time.Time{}, ErrInvalidSubmitterToken
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", time.Time{}, ErrInvalidSubmitterToken
+	}
+	typ, _ := claims["typ"].(string)
+	id, _ := claims["sub"].(string)
+	if typ != SubmitterTokenType || !strings.HasPrefix(id, AnonymousSubmitterPrefix) {
+		return "", time.Time{}, ErrInvalidSubmitterToken
+	}
+	issuedAt, err := claims.GetIssuedAt()
+	if err != nil || issuedAt == nil {
+		return "", time.Time{}, ErrInvalidSubmitterToken
+	}
+	return id, issuedAt.Time, nil
+}
+
+// RenewSubmitterToken re-signs a valid submitter token with the active key
+// when an older key signed it, keeping its ID and issue time, so a guest
+// keeps their identity after that key retires. It returns "" for a token
+// that is already current.
+func (s *AuthService) RenewSubmitterToken(ctx context.Context, tokenString string) (string, error) {
+	id, issuedAt, err := s.ParseSubmitterToken(ctx, tokenString)
+	if err != nil {
+		return "", err
+	}
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, jwt.MapClaims{})
+	if err != nil {
+		return "", ErrInvalidSubmitterToken
+	}
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = DefaultKeyID
+	}
+	if kid == s.keyring.ActiveKeyID(ctx) {
+		return "", nil
+	}
+	return s.keyring.Sign(ctx, jwt.MapClaims{
+		"sub": id,
+		"typ": SubmitterTokenType,
+		"iat": issuedAt.Unix(),
+	})
+}
+
+// RotateSigningKey switches token signing to a fresh key. Tokens signed
+// with the previous key stay valid until it retires.
+func (s *AuthService) RotateSigningKey(ctx context.Context) (*model.SigningKey, error) {
+	return s.keyring.Rotate(ctx)
+}
+
+// ListSigningKeys describes the signing keys still accepted.
+func (s *AuthService) ListSigningKeys(ctx context.Context) ([]model.SigningKey, error) {
+	return s.keyring.List(ctx)
+}
+
 func randomCode(length int) (string, error) {
-	const charset = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
 	result := make([]byte, length)
 	for i := 0; i < length; i++ {
-		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(captchaCharset))))
 		if err != nil {
 			return "", err
 		}
-		result[i] = charset[n.Int64()]
+		result[i] = captchaCharset[n.Int64()]
 	}
 	return string(result), nil
 }
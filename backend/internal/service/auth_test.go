@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestSubmitterTokenRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	svc := NewAuthService(nil, "secret", AuthServiceOptions{})
+	token, id, err := svc.IssueSubmitterToken(context.Background())
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if !strings.HasPrefix(id, AnonymousSubmitterPrefix) {
+		t.Fatalf("expected anonymous id, got %q", id)
+	}
+
+	got, issuedAt, err := svc.ParseSubmitterToken(context.Background(), token)
+	if err != nil || got != id {
+		t.Fatalf("expected %q, got %q (%v)", id, got, err)
+	}
+	if time.Since(issuedAt) > time.Minute {
+		t.Fatalf("expected a fresh issue time, got %v", issuedAt)
+	}
+
+	if _, _, err := NewAuthService(nil, "other", AuthServiceOptions{}).ParseSubmitterToken(context.Background(), token); err == nil {
+		t.Fatalf("expected error for a foreign key, got nil")
+	}
+}
+
+func TestSubmitterTokenRejectsLoginToken(t *testing.T) {
+	t.Parallel()
+
+	svc := NewAuthService(nil, "secret", AuthServiceOptions{})
+	login, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":      "user-1",
+		"username": "alice",
+		"exp":      time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if _, _, err := svc.ParseSubmitterToken(context.Background(), login); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+}
+
+func TestParseAccessToken(t *testing.T) {
+	t.Parallel()
+
+	svc := NewAuthService(nil, "secret", AuthServiceOptions{})
+	sign := func(method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		return token
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	access := sign(jwt.SigningMethodHS256, []byte("secret"), jwt.MapClaims{
+		"sub": "user-1", "username": "alice", "typ": AccessTokenType, "ver": 2, "exp": exp,
+	})
+	claims, err := svc.ParseAccessToken(context.Background(), access)
+	if err != nil || claims["username"] != "alice" {
+		t.Fatalf("expected alice, got %v (%v)", claims, err)
+	}
+
+	submitter, _, err := svc.IssueSubmitterToken(context.Background())
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	rejected := map[string]string{
+		"empty":     "",
+		"untyped":   sign(jwt.SigningMethodHS256, []byte("secret"), jwt.MapClaims{"sub": "user-1", "username": "alice", "exp": exp}),
+		"submitter": submitter,
+		"foreign":   sign(jwt.SigningMethodHS256, []byte("other"), jwt.MapClaims{"username": "alice", "typ": AccessTokenType, "exp": exp}),
+		"expired":   sign(jwt.SigningMethodHS256, []byte("secret"), jwt.MapClaims{"username": "alice", "typ": AccessTokenType, "exp": time.Now().Add(-time.Minute).Unix()}),
+		"hs512":     sign(jwt.SigningMethodHS512, []byte("secret"), jwt.MapClaims{"username": "alice", "typ": AccessTokenType, "exp": exp}),
+	}
+	for name, token := range rejected {
+		if _, err := svc.ParseAccessToken(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+}
+
+func TestAllowSubmitterToken(t *testing.T) {
+	svc := NewAuthService(testRedis(t), "secret", AuthServiceOptions{})
+	ctx := context.Background()
+
+	for i := 0; i < submitterTokenLimit; i++ {
+		if ok, err := svc.AllowSubmitterToken(ctx, "203.0.113.7"); err != nil || !ok {
+			t.Fatalf("token %d: expected allowed, got %v (%v)", i+1, ok, err)
+		}
+	}
+	if ok, _ := svc.AllowSubmitterToken(ctx, "203.0.113.7"); ok {
+		t.Fatalf("expected the client to run out of submitter tokens")
+	}
+	if ok, _ := svc.AllowSubmitterToken(ctx, "203.0.113.8"); !ok {
+		t.Fatalf("expected another client to have its own limit")
+	}
+}
+
+func TestRenewSubmitterToken(t *testing.T) {
+	svc := NewAuthService(testRedis(t), "secret", AuthServiceOptions{})
+	ctx := context.Background()
+
+	token, id, err := svc.IssueSubmitterToken(ctx)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	_, issuedAt, _ := svc.ParseSubmitterToken(ctx, token)
+	if renewed, err := svc.RenewSubmitterToken(ctx, token); err != nil || renewed != "" {
+		t.Fatalf("expected a current token to stay, got %q (%v)", renewed, err)
+	}
+
+	if _, err := svc.RotateSigningKey(ctx); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	renewed, err := svc.RenewSubmitterToken(ctx, token)
+	if err != nil || renewed == "" {
+		t.Fatalf("expected a renewed token, got %q (%v)", renewed, err)
+	}
+	got, gotIssuedAt, err := svc.ParseSubmitterToken(ctx, renewed)
+	if err != nil || got != id || !gotIssuedAt.Equal(issuedAt) {
+		t.Fatalf("expected %q issued at %v, got %q at %v (%v)", id, issuedAt, got, gotIssuedAt, err)
+	}
+	if again, _ := svc.RenewSubmitterToken(ctx, renewed); again != "" {
+		t.Fatalf("expected the renewed token to be current")
+	}
+
+	if _, err := svc.RenewSubmitterToken(ctx, "garbage"); !errors.Is(err, ErrInvalidSubmitterToken) {
+		t.Fatalf("expected ErrInvalidSubmitterToken, got %v", err)
+	}
+}
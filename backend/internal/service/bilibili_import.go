@@ -265,8 +265,11 @@ func (i *BilibiliImporter) ImportHighPriceCodes(ctx context.Context, svc *PriceS
 			Code:   c.Code,
 			Price:  c.Price,
 			Server: server,
+			Source: model.PriceSourceBilibili,
 		}
-		if err := svc.AddPrice(ctx, item); err != nil {
+		if _, err := svc.AddPrice(ctx, item); errors.Is(err, ErrPriceOutlier) || errors.Is(err, ErrQueuedForReview) {
+			continue
+		} else if err != nil {
 			return imported, err
 		}
 		imported++
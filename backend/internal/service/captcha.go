@@ -0,0 +1,258 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lingbao-market/backend/internal/model"
+	"github.com/redis/go-redis/v9"
+)
+
+// CaptchaProvider issues and checks the challenges that keep bots off login,
+// register and, when enabled, submit and feedback.
+type CaptchaProvider interface {
+	// Name is the provider name the client sees on every challenge.
+	Name() string
+	// Create issues a challenge for the client to solve.
+	Create(ctx context.Context) (*model.CaptchaChallenge, error)
+	// Verify checks an answer. Answers are single-use: a failed attempt
+	// consumes the challenge as well.
+	Verify(ctx context.Context, id, answer, remoteIP string) (bool, error)
+}
+
+const (
+	CaptchaImage  = "image"
+	CaptchaRemote = "remote"
+	CaptchaPoW    = "pow"
+)
+
+const (
+	keyCaptchaPrefix = "auth:captcha:"
+	captchaTTL       = 5 * time.Minute
+)
+
+// CaptchaOptions configures NewCaptchaProvider.
+type CaptchaOptions struct {
+	// Provider is image (default), remote or pow.
+	Provider string
+	// VerifyURL, Secret and SiteKey configure the remote provider, which
+	// follows the Turnstile/hCaptcha siteverify protocol.
+	VerifyURL string
+	Secret    string
+	SiteKey   string
+	// PoWDifficulty is the number of leading zero bits a proof-of-work
+	// answer must have.
+	PoWDifficulty int
+}
+
+// NewCaptchaProvider builds the provider named in opts.
+func NewCaptchaProvider(rdb *redis.Client, opts CaptchaOptions) (CaptchaProvider, error) {
+	switch name := strings.ToLower(strings.TrimSpace(opts.Provider)); name {
+	case "", CaptchaImage:
+		return NewImageCaptcha(rdb), nil
+	case CaptchaRemote:
+		return NewRemoteCaptcha(opts.VerifyURL, opts.Secret, opts.SiteKey)
+	case CaptchaPoW:
+		return NewPoWCaptcha(rdb, opts.PoWDifficulty), nil
+	}
+	return nil, fmt.Errorf("unknown captcha provider %q", opts.Provider)
+}
+
+// takeCaptcha reads and deletes a stored challenge in one step, so each one
+// can be answered once.
+func takeCaptcha(ctx context.Context, rdb *redis.Client, id string) (string, bool, error) {
+	val, err := rdb.GetDel(ctx, keyCaptchaPrefix+id).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return val, true, nil
+}
+
+// imageCaptcha shows a distorted code the user types back.
+type imageCaptcha struct {
+	rdb *redis.Client
+}
+
+func NewImageCaptcha(rdb *redis.Client) CaptchaProvider {
+	return &imageCaptcha{rdb: rdb}
+}
+
+func (p *imageCaptcha) Name() string { return CaptchaImage }
+
+func (p *imageCaptcha) Create(ctx context.Context) (*model.CaptchaChallenge, error) {
+	id := uuid.New().String()
+	code, err := randomCode(captchaLength)
+	if err != nil {
+		return nil, err
+	}
+	img, err := RenderCaptcha(code)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.rdb.Set(ctx, keyCaptchaPrefix+id, code, captchaTTL).Err(); err != nil {
+		return nil, err
+	}
+
+	return &model.CaptchaChallenge{
+		Provider:  CaptchaImage,
+		CaptchaID: id,
+		Image:     "data:image/png;base64," + base64.StdEncoding.EncodeToString(img),
+	}, nil
+}
+
+func (p *imageCaptcha) Verify(ctx context.Context, id, answer, _ string) (bool, error) {
+	if id == "" || answer == "" {
+		return false, nil
+	}
+	code, ok, err := takeCaptcha(ctx, p.rdb, id)
+	if err != nil || !ok {
+		return false, err
+	}
+	return strings.EqualFold(code, answer), nil
+}
+
+// Letters and digits that are hard to confuse (no I/O/0/1).
+const captchaCharset = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+const (
+	captchaWidth   = 120
+	captchaHeight  = 40
+	captchaLength  = 4
+	captchaGlyphW  = 5
+	captchaGlyphH  = 7
+	captchaScale   = 3.6
+	captchaLines   = 5
+	captchaSpeckle = 150
+)
+
+// 5x7 bitmaps for every character of captchaCharset.
+var captchaGlyphs = map[rune][captchaGlyphH]string{
+	'A': {".###.", "#...#", "#...#", "#####", "#...#", "#...#", "#...#"},
+	'B': {"####.", "#...#", "#...#", "####.", "#...#", "#...#", "####."},
+	'C': {".###.", "#...#", "#....", "#....", "#....", "#...#", ".###."},
+	'D': {"####.", "#...#", "#...#", "#...#", "#...#", "#...#", "####."},
+	'E': {"#####", "#....", "#....", "####.", "#....", "#....", "#####"},
+	'F': {"#####", "#....", "#....", "####.", "#....", "#....", "#...."},
+	'G': {".###.", "#...#", "#....", "#.###", "#...#", "#...#", ".####"},
+	'H': {"#...#", "#...#", "#...#", "#####", "#...#", "#...#", "#...#"},
+	'J': {"..###", "...#.", "...#.", "...#.", "...#.", "#..#.", ".##.."},
+	'K': {"#...#", "#..#.", "#.#..", "##...", "#.#..", "#..#.", "#...#"},
+	'L': {"#....", "#....", "#....", "#....", "#....", "#....", "#####"},
+	'M': {"#...#", "##.##", "#.#.#", "#.#.#", "#...#", "#...#", "#...#"},
+	'N': {"#...#", "#...#", "##..#", "#.#.#", "#..##", "#...#", "#...#"},
+	'P': {"####.", "#...#", "#...#", "####.", "#....", "#....", "#...."},
+	'Q': {".###.", "#...#", "#...#", "#...#", "#.#.#", "#..#.", ".##.#"},
+	'R': {"####.", "#...#", "#...#", "####.", "#.#..", "#..#.", "#...#"},
+	'S': {".####", "#....", "#....", ".###.", "....#", "....#", "####."},
+	'T': {"#####", "..#..", "..#..", "..#..", "..#..", "..#..", "..#.."},
+	'U': {"#...#", "#...#", "#...#", "#...#", "#...#", "#...#", ".###."},
+	'V': {"#...#", "#...#", "#...#", "#...#", "#...#", ".#.#.", "..#.."},
+	'W': {"#...#", "#...#", "#...#", "#.#.#", "#.#.#", "#.#.#", ".#.#."},
+	'X': {"#...#", "#...#", ".#.#.", "..#..", ".#.#.", "#...#", "#...#"},
+	'Y': {"#...#", "#...#", ".#.#.", "..#..", "..#..", "..#..", "..#.."},
+	'Z': {"#####", "....#", "...#.", "..#..", ".#...", "#....", "#####"},
+	'2': {".###.", "#...#", "....#", "...#.", "..#..", ".#...", "#####"},
+	'3': {"#####", "...#.", "..#..", "...#.", "....#", "#...#", ".###."},
+	'4': {"...#.", "..##.", ".#.#.", "#..#.", "#####", "...#.", "...#."},
+	'5': {"#####", "#....", "####.", "....#", "....#", "#...#", ".###."},
+	'6': {"..##.", ".#...", "#....", "####.", "#...#", "#...#", ".###."},
+	'7': {"#####", "....#", "...#.", "..#..", ".#...", ".#...", ".#..."},
+	'8': {".###.", "#...#", "#...#", ".###.", "#...#", "#...#", ".###."},
+	'9': {".###.", "#...#", "#...#", ".####", "....#", "...#.", ".##.."},
+}
+
+// RenderCaptcha draws code as a PNG. Every character is scaled, rotated and
+// shifted on its own, the whole image is bent along a sine wave, and noise
+// lines and speckles are laid over it, so the code can't be read back by
+// matching the bitmaps.
+func RenderCaptcha(code string) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, captchaWidth, captchaHeight))
+	bg := color.RGBA{uint8(225 + rand.IntN(30)), uint8(225 + rand.IntN(30)), uint8(225 + rand.IntN(30)), 255}
+	for y := 0; y < captchaHeight; y++ {
+		for x := 0; x < captchaWidth; x++ {
+			img.SetRGBA(x, y, bg)
+		}
+	}
+
+	runes := []rune(code)
+	cell := float64(captchaWidth) / float64(max(len(runes), 1))
+	waveAmp := 1.5 + rand.Float64()*2
+	waveFreq := 0.05 + rand.Float64()*0.05
+	wavePhase := rand.Float64() * 2 * math.Pi
+
+	for i, r := range runes {
+		glyph, ok := captchaGlyphs[r]
+		if !ok {
+			continue
+		}
+		ink := randomInk()
+		scale := captchaScale * (0.85 + rand.Float64()*0.3)
+		angle := (rand.Float64() - 0.5) * 0.7
+		shear := (rand.Float64() - 0.5) * 0.4
+		cx := cell*(float64(i)+0.5) + (rand.Float64()-0.5)*6
+		cy := float64(captchaHeight)/2 + (rand.Float64()-0.5)*6
+		sin, cos := math.Sincos(-angle)
+
+		x0, x1 := int(cx-cell), int(cx+cell)
+		for y := 0; y < captchaHeight; y++ {
+			for x := max(x0, 0); x < min(x1, captchaWidth); x++ {
+				// Map the output pixel back into glyph space.
+				dy := float64(y) - cy + waveAmp*math.Sin(float64(x)*waveFreq+wavePhase)
+				dx := float64(x) - cx - shear*dy
+				gx := (dx*cos-dy*sin)/scale + captchaGlyphW/2.0
+				gy := (dx*sin+dy*cos)/scale + captchaGlyphH/2.0
+				if gx < 0 || gy < 0 || gx >= captchaGlyphW || gy >= captchaGlyphH {
+					continue
+				}
+				if glyph[int(gy)][int(gx)] == '#' {
+					img.SetRGBA(x, y, ink)
+				}
+			}
+		}
+	}
+
+	for i := 0; i < captchaLines; i++ {
+		drawCaptchaLine(img, randomInk())
+	}
+	for i := 0; i < captchaSpeckle; i++ {
+		img.SetRGBA(rand.IntN(captchaWidth), rand.IntN(captchaHeight), randomInk())
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// drawCaptchaLine draws a wavy line across the image.
+func drawCaptchaLine(img *image.RGBA, ink color.RGBA) {
+	y0 := rand.Float64() * captchaHeight
+	y1 := rand.Float64() * captchaHeight
+	amp := rand.Float64() * 4
+	phase := rand.Float64() * 2 * math.Pi
+	for x := 0; x < captchaWidth; x++ {
+		t := float64(x) / captchaWidth
+		y := y0 + (y1-y0)*t + amp*math.Sin(t*2*math.Pi+phase)
+		img.SetRGBA(x, int(y), ink)
+	}
+}
+
+func randomInk() color.RGBA {
+	return color.RGBA{uint8(rand.IntN(140)), uint8(rand.IntN(140)), uint8(rand.IntN(140)), 255}
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/bits"
+
+	"github.com/google/uuid"
+	"github.com/lingbao-market/backend/internal/model"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultPoWDifficulty = 20
+	maxPoWDifficulty     = 32
+	powNonceMaxLen       = 64
+)
+
+// powCaptcha is a hashcash-style challenge: the client finds a nonce so that
+// SHA-256(challenge + nonce) starts with difficulty zero bits. It costs a
+// browser or a well-behaved bot a moment of CPU and needs no human.
+type powCaptcha struct {
+	rdb        *redis.Client
+	difficulty int
+}
+
+func NewPoWCaptcha(rdb *redis.Client, difficulty int) CaptchaProvider {
+	if difficulty <= 0 {
+		difficulty = defaultPoWDifficulty
+	}
+	if difficulty > maxPoWDifficulty {
+		difficulty = maxPoWDifficulty
+	}
+	return &powCaptcha{rdb: rdb, difficulty: difficulty}
+}
+
+func (p *powCaptcha) Name() string { return CaptchaPoW }
+
+func (p *powCaptcha) Create(ctx context.Context) (*model.CaptchaChallenge, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	id := uuid.New().String()
+	challenge := hex.EncodeToString(raw)
+
+	if err := p.rdb.Set(ctx, keyCaptchaPrefix+id, challenge, captchaTTL).Err(); err != nil {
+		return nil, err
+	}
+
+	return &model.CaptchaChallenge{
+		Provider:   CaptchaPoW,
+		CaptchaID:  id,
+		Challenge:  challenge,
+		Difficulty: p.difficulty,
+	}, nil
+}
+
+// Verify checks the nonce in answer.
+func (p *powCaptcha) Verify(ctx context.Context, id, answer, _ string) (bool, error) {
+	if id == "" || answer == "" || len(answer) > powNonceMaxLen {
+		return false, nil
+	}
+	challenge, ok, err := takeCaptcha(ctx, p.rdb, id)
+	if err != nil || !ok {
+		return false, err
+	}
+	return powSolved(challenge, answer, p.difficulty), nil
+}
+
+// powSolved reports whether SHA-256(challenge + nonce) starts with at least
+// difficulty zero bits.
+func powSolved(challenge, nonce string, difficulty int) bool {
+	sum := sha256.Sum256([]byte(challenge + nonce))
+	zeros := 0
+	for _, b := range sum {
+		if b != 0 {
+			zeros += bits.LeadingZeros8(b)
+			break
+		}
+		zeros += 8
+	}
+	return zeros >= difficulty
+}
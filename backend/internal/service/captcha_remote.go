@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lingbao-market/backend/internal/model"
+)
+
+const remoteCaptchaTimeout = 10 * time.Second
+
+// remoteCaptcha hands the challenge to a third-party widget and checks the
+// token it produces against a siteverify endpoint, the way Turnstile and
+// hCaptcha do. The third party keeps tokens single-use.
+type remoteCaptcha struct {
+	verifyURL string
+	secret    string
+	siteKey   string
+	client    *http.Client
+}
+
+func NewRemoteCaptcha(verifyURL, secret, siteKey string) (CaptchaProvider, error) {
+	verifyURL = strings.TrimSpace(verifyURL)
+	if verifyURL == "" || secret == "" {
+		return nil, errors.New("remote captcha needs a verify URL and a secret")
+	}
+	if _, err := url.ParseRequestURI(verifyURL); err != nil {
+		return nil, fmt.Errorf("invalid captcha verify URL: %w", err)
+	}
+	return &remoteCaptcha{
+		verifyURL: verifyURL,
+		secret:    secret,
+		siteKey:   siteKey,
+		client:    &http.Client{Timeout: remoteCaptchaTimeout},
+	}, nil
+}
+
+func (p *remoteCaptcha) Name() string { return CaptchaRemote }
+
+func (p *remoteCaptcha) Create(context.Context) (*model.CaptchaChallenge, error) {
+	return &model.CaptchaChallenge{Provider: CaptchaRemote, SiteKey: p.siteKey}, nil
+}
+
+// Verify checks the widget token in answer; the challenge ID is unused.
+func (p *remoteCaptcha) Verify(ctx context.Context, _, answer, remoteIP string) (bool, error) {
+	if answer == "" {
+		return false, nil
+	}
+
+	form := url.Values{"secret": {p.secret}, "response": {answer}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.verifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("captcha verify returned %s", resp.Status)
+	}
+
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, err
+	}
+	return result.Success, nil
+}
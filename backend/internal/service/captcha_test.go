@@ -0,0 +1,144 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestCaptchaGlyphsCoverCharset(t *testing.T) {
+	t.Parallel()
+
+	for _, r := range captchaCharset {
+		glyph, ok := captchaGlyphs[r]
+		if !ok {
+			t.Fatalf("no glyph for %q", r)
+		}
+		for _, row := range glyph {
+			if len(row) != captchaGlyphW {
+				t.Fatalf("glyph %q: expected rows of %d, got %q", r, captchaGlyphW, row)
+			}
+		}
+	}
+}
+
+func TestRenderCaptcha(t *testing.T) {
+	t.Parallel()
+
+	raw, err := RenderCaptcha("AB23")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("expected a PNG, got %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != captchaWidth || b.Dy() != captchaHeight {
+		t.Fatalf("expected %dx%d, got %dx%d", captchaWidth, captchaHeight, b.Dx(), b.Dy())
+	}
+}
+
+func TestNewCaptchaProvider(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"":      CaptchaImage,
+		"IMAGE": CaptchaImage,
+		" pow ": CaptchaPoW,
+	}
+	for name, want := range cases {
+		provider, err := NewCaptchaProvider(nil, CaptchaOptions{Provider: name})
+		if err != nil || provider.Name() != want {
+			t.Fatalf("%q: expected %q, got %v (%v)", name, want, provider, err)
+		}
+	}
+	if _, err := NewCaptchaProvider(nil, CaptchaOptions{Provider: "remote"}); err == nil {
+		t.Fatalf("expected error for remote without verify URL, got nil")
+	}
+	if _, err := NewCaptchaProvider(nil, CaptchaOptions{Provider: "recaptcha"}); err == nil {
+		t.Fatalf("expected error for unknown provider, got nil")
+	}
+}
+
+func TestRemoteCaptchaVerify(t *testing.T) {
+	t.Parallel()
+
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ok := r.PostForm.Get("secret") == "s3cret" &&
+			r.PostForm.Get("response") == "good-token" &&
+			r.PostForm.Get("remoteip") == "203.0.113.7"
+		_ = json.NewEncoder(w).Encode(map[string]bool{"success": ok})
+	}))
+	defer stub.Close()
+
+	provider, err := NewCaptchaProvider(nil, CaptchaOptions{
+		Provider:  CaptchaRemote,
+		VerifyURL: stub.URL,
+		Secret:    "s3cret",
+		SiteKey:   "site",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	challenge, err := provider.Create(context.Background())
+	if err != nil || challenge.SiteKey != "site" || challenge.Provider != CaptchaRemote {
+		t.Fatalf("unexpected challenge %+v (%v)", challenge, err)
+	}
+
+	cases := map[string]bool{"good-token": true, "bad-token": false, "": false}
+	for answer, want := range cases {
+		got, err := provider.Verify(context.Background(), "", answer, "203.0.113.7")
+		if err != nil || got != want {
+			t.Fatalf("%q: expected %v, got %v (%v)", answer, want, got, err)
+		}
+	}
+}
+
+func TestRemoteCaptchaVerifyUpstreamError(t *testing.T) {
+	t.Parallel()
+
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer stub.Close()
+
+	provider, err := NewRemoteCaptcha(stub.URL, "s3cret", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ok, err := provider.Verify(context.Background(), "", "token", ""); err == nil || ok {
+		t.Fatalf("expected an error, got %v (%v)", ok, err)
+	}
+}
+
+func TestPowSolved(t *testing.T) {
+	t.Parallel()
+
+	const challenge = "00112233445566778899aabbccddeeff"
+	nonce := ""
+	for i := 0; i < 1<<20; i++ {
+		if powSolved(challenge, strconv.Itoa(i), 12) {
+			nonce = strconv.Itoa(i)
+			break
+		}
+	}
+	if nonce == "" {
+		t.Fatalf("no nonce found")
+	}
+	if !powSolved(challenge, nonce, 8) {
+		t.Fatalf("expected a 12-bit solution to pass 8 bits")
+	}
+	if powSolved(challenge, nonce, 64) {
+		t.Fatalf("expected a 12-bit solution to fail 64 bits")
+	}
+}
@@ -0,0 +1,312 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lingbao-market/backend/internal/model"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Replay buffer for Last-Event-ID resume; stream IDs double as event IDs.
+	keyFeedEvents = "market:events"
+	// Pub/sub channel every replica listens on.
+	channelFeedEvents = "market:events:live"
+
+	feedEventsMaxLen    = 1000
+	feedEventBufferSize = 64
+)
+
+var ErrInvalidEventID = errors.New("invalid event id")
+
+func (s *PriceService) publishFeedEvent(ctx context.Context, event model.FeedEvent) {
+	publishFeedEvent(ctx, s.rdb, event)
+}
+
+// publishFeedEvent appends the event to the replay buffer and fans it out to
+// all subscribers. Publishing is best effort: a failure is logged but never
+// fails the write that triggered it.
+func publishFeedEvent(ctx context.Context, rdb *redis.Client, event model.FeedEvent) {
+	if event.Timestamp <= 0 {
+		event.Timestamp = time.Now().UnixMilli()
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Feed event encode failed: %v", err)
+		return
+	}
+
+	id, err := rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: keyFeedEvents,
+		MaxLen: feedEventsMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"event": payload},
+	}).Result()
+	if err != nil {
+		log.Printf("Feed event append failed: %v", err)
+		return
+	}
+
+	event.ID = id
+	payload, err = json.Marshal(event)
+	if err != nil {
+		return
+	}
+	if err := rdb.Publish(ctx, channelFeedEvents, payload).Err(); err != nil {
+		log.Printf("Feed event publish failed: %v", err)
+	}
+}
+
+// SubscribeFeed delivers feed events until ctx is done. With a lastEventID,
+// buffered events after it are replayed first; a reset event is sent when
+// the buffer no longer reaches back that far.
+func (s *PriceService) SubscribeFeed(ctx context.Context, lastEventID string) (<-chan model.FeedEvent, error) {
+	lastEventID = strings.TrimSpace(lastEventID)
+	if lastEventID != "" {
+		if _, _, ok := parseStreamID(lastEventID); !ok {
+			return nil, ErrInvalidEventID
+		}
+	}
+
+	// Join before replaying so nothing published in between is lost;
+	// duplicates are dropped by ID below.
+	live, err := s.hub.join(ctx, s.rdb)
+	if err != nil {
+		return nil, err
+	}
+
+	var replay []model.FeedEvent
+	if lastEventID != "" {
+		events, err := s.replayFeedEvents(ctx, lastEventID)
+		if err != nil {
+			s.hub.leave(live)
+			return nil, err
+		}
+		replay = events
+	}
+
+	out := make(chan model.FeedEvent, feedEventBufferSize)
+	go func() {
+		defer close(out)
+		defer s.hub.leave(live)
+
+		last := lastEventID
+		send := func(event model.FeedEvent) bool {
+			select {
+			case out <- event:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for _, event := range replay {
+			if !send(event) {
+				return
+			}
+			if event.ID != "" {
+				last = event.ID
+			}
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-live:
+				if !ok {
+					return
+				}
+				if last != "" && compareStreamIDs(event.ID, last) <= 0 {
+					continue
+				}
+				if !send(event) {
+					return
+				}
+				last = event.ID
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// feedHub shares one subscription to the live channel between all feed
+// subscribers of the process, so the number of Redis connections doesn't
+// grow with the number of streaming clients.
+type feedHub struct {
+	mu      sync.Mutex
+	sub     *redis.PubSub
+	clients map[chan model.FeedEvent]struct{}
+}
+
+func newFeedHub() *feedHub {
+	return &feedHub{clients: make(map[chan model.FeedEvent]struct{})}
+}
+
+// join registers a subscriber, subscribing to the live channel on first use.
+func (h *feedHub) join(ctx context.Context, rdb *redis.Client) (chan model.FeedEvent, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.sub == nil {
+		// The subscription outlives the request that opened it.
+		sub := rdb.Subscribe(context.Background(), channelFeedEvents)
+		if _, err := sub.Receive(ctx); err != nil {
+			_ = sub.Close()
+			return nil, err
+		}
+		h.sub = sub
+		go h.run(sub.Channel())
+	}
+
+	live := make(chan model.FeedEvent, feedEventBufferSize)
+	h.clients[live] = struct{}{}
+	return live, nil
+}
+
+// leave unregisters a subscriber and closes its channel.
+func (h *feedHub) leave(live chan model.FeedEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[live]; ok {
+		delete(h.clients, live)
+		close(live)
+	}
+}
+
+// run fans published events out to the subscribers. A subscriber whose
+// buffer is full is dropped rather than stalling everyone else; its client
+// reconnects and resumes from its last event ID.
+func (h *feedHub) run(messages <-chan *redis.Message) {
+	for msg := range messages {
+		var event model.FeedEvent
+		if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+			continue
+		}
+		h.mu.Lock()
+		for live := range h.clients {
+			select {
+			case live <- event:
+			default:
+				delete(h.clients, live)
+				close(live)
+			}
+		}
+		h.mu.Unlock()
+	}
+}
+
+func (s *PriceService) replayFeedEvents(ctx context.Context, lastEventID string) ([]model.FeedEvent, error) {
+	var events []model.FeedEvent
+
+	oldest, err := s.rdb.XRangeN(ctx, keyFeedEvents, "-", "+", 1).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(oldest) > 0 && compareStreamIDs(lastEventID, oldest[0].ID) < 0 {
+		events = append(events, model.FeedEvent{
+			Type:      model.FeedEventReset,
+			Timestamp: time.Now().UnixMilli(),
+		})
+	}
+
+	msgs, err := s.rdb.XRange(ctx, keyFeedEvents, "("+lastEventID, "+").Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range msgs {
+		raw, ok := msg.Values["event"].(string)
+		if !ok {
+			continue
+		}
+		var event model.FeedEvent
+		if err := json.Unmarshal([]byte(raw), &event); err != nil {
+			continue
+		}
+		event.ID = msg.ID
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// Matches reports whether a feed entry passes the filter.
+func (f FeedFilter) Matches(item model.PriceItem) bool {
+	if server := strings.TrimSpace(f.Server); server != "" && strings.TrimSpace(item.Server) != server {
+		return false
+	}
+	if f.MinPrice > 0 && item.Price < f.MinPrice {
+		return false
+	}
+	if f.MaxPrice > 0 && item.Price > f.MaxPrice {
+		return false
+	}
+	if prefix := normalizeFeedCode(f.CodePrefix); prefix != "" && !strings.HasPrefix(item.Code, prefix) {
+		return false
+	}
+	if f.Since > 0 && item.Timestamp < f.Since {
+		return false
+	}
+	return true
+}
+
+// MatchesEvent reports whether a subscriber with this filter should receive
+// the event. Events without an entry only check the code prefix; resets
+// always pass.
+func (f FeedFilter) MatchesEvent(event model.FeedEvent) bool {
+	if event.Item != nil {
+		return f.Matches(*event.Item)
+	}
+	if prefix := normalizeFeedCode(f.CodePrefix); prefix != "" && event.Code != "" {
+		return strings.HasPrefix(event.Code, prefix)
+	}
+	return true
+}
+
+func parseStreamID(id string) (int64, int64, bool) {
+	msPart, seqPart, found := strings.Cut(id, "-")
+	ms, err := strconv.ParseInt(msPart, 10, 64)
+	if err != nil || ms < 0 {
+		return 0, 0, false
+	}
+	if !found {
+		return ms, 0, true
+	}
+	seq, err := strconv.ParseInt(seqPart, 10, 64)
+	if err != nil || seq < 0 {
+		return 0, 0, false
+	}
+	return ms, seq, true
+}
+
+// compareStreamIDs orders two Redis stream IDs; unparsable IDs sort first.
+func compareStreamIDs(a, b string) int {
+	aMs, aSeq, aOK := parseStreamID(a)
+	bMs, bSeq, bOK := parseStreamID(b)
+	switch {
+	case !aOK && !bOK:
+		return 0
+	case !aOK:
+		return -1
+	case !bOK:
+		return 1
+	case aMs != bMs:
+		if aMs < bMs {
+			return -1
+		}
+		return 1
+	case aSeq != bSeq:
+		if aSeq < bSeq {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
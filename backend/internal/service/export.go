@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+
+	"github.com/lingbao-market/backend/internal/model"
+)
+
+const exportBatchSize = FeedMaxLimit
+
+// ExportFeed walks every live entry matching the filter in feed order and
+// hands them to emit one batch at a time, so the result never has to fit in
+// memory.
+func (s *PriceService) ExportFeed(ctx context.Context, sortBy string, filter FeedFilter, emit func([]model.PriceItem) error) error {
+	view, err := s.openFeedView(ctx, normalizeFeedSort(sortBy), filter, false)
+	if err != nil {
+		return err
+	}
+	defer s.releaseFeedView(view)
+
+	return s.walkSortedSet(ctx, view.key, view.minScore, view.maxScore, s.loadCodeRecords, func() {
+		s.touchFeedView(ctx, view)
+	}, emit)
+}
+
+// ExportArchive walks an archived day like ExportFeed. Archives have no
+// secondary indexes, so filters are applied to each batch as it is read.
+func (s *PriceService) ExportArchive(ctx context.Context, date, sortBy string, filter FeedFilter, emit func([]model.PriceItem) error) error {
+	exists, err := s.ArchiveExists(ctx, date)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrArchiveNotFound
+	}
+
+	itemsKey, timeKey, priceKey := archiveKeys(date)
+	key := timeKey
+	if normalizeFeedSort(sortBy) == "price" {
+		key = priceKey
+	}
+	load := func(ctx context.Context, codes []string) ([]model.PriceItem, error) {
+		items, err := s.loadArchiveRecords(ctx, itemsKey, codes)
+		if err != nil {
+			return nil, err
+		}
+		matched := items[:0]
+		for _, item := range items {
+			if filter.Matches(item) {
+				matched = append(matched, item)
+			}
+		}
+		return matched, nil
+	}
+	return s.walkSortedSet(ctx, key, "-inf", "+inf", load, nil, emit)
+}
+
+// walkSortedSet pages through a sorted set of codes, highest score first,
+// calling touch (if set) before each batch.
+func (s *PriceService) walkSortedSet(
+	ctx context.Context,
+	key, minScore, maxScore string,
+	load func(context.Context, []string) ([]model.PriceItem, error),
+	touch func(),
+	emit func([]model.PriceItem) error,
+) error {
+	var after *feedCursor
+	for {
+		if touch != nil {
+			touch()
+		}
+		upper := maxScore
+		if after != nil {
+			upper = formatScore(after.Score)
+		}
+		entries, err := s.scanFeedAfter(ctx, key, minScore, upper, after, exportBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+
+		codes := make([]string, 0, len(entries))
+		for _, z := range entries {
+			codes = append(codes, z.Member.(string))
+		}
+		items, err := load(ctx, codes)
+		if err != nil {
+			return err
+		}
+		if len(items) > 0 {
+			if err := emit(items); err != nil {
+				return err
+			}
+		}
+
+		if len(entries) < exportBatchSize {
+			return nil
+		}
+		last := entries[len(entries)-1]
+		after = &feedCursor{Score: last.Score, Member: last.Member.(string)}
+	}
+}
@@ -0,0 +1,376 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lingbao-market/backend/internal/model"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	FeedDefaultLimit = 50
+	FeedMaxLimit     = 200
+)
+
+const (
+	keyFeedTempPrefix = "market:feed:tmp:"
+	feedTempTTL       = 30 * time.Second
+
+	// Intersections built for GetFeed, keyed by the ranges intersected.
+	// Requests with the same filter share one for feedViewTTL, so paging or
+	// polling a filtered feed doesn't rebuild it every time.
+	keyFeedViewPrefix = "market:feed:view:"
+	feedViewTTL       = 5 * time.Second
+	feedViewMinTTL    = time.Second
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// FeedQuery selects one page of the market feed.
+type FeedQuery struct {
+	Sort   string
+	Limit  int64
+	Cursor string
+	Filter FeedFilter
+}
+
+// FeedFilter narrows the feed. Zero values leave a dimension unfiltered;
+// Since is a unix timestamp in milliseconds.
+type FeedFilter struct {
+	Server     string
+	MinPrice   float64
+	MaxPrice   float64
+	CodePrefix string
+	Since      int64
+}
+
+// feedView is a sorted set plus score bounds that yields exactly the entries
+// matching a filter. Filters that can't be expressed as bounds on the sort
+// index are intersected into a shared cached set or, for long reads, a
+// temporary set, which release deletes.
+type feedView struct {
+	key      string
+	minScore string
+	maxScore string
+	temp     []string
+}
+
+// feedCursor marks the last entry of a page by its score and member, so the
+// next page starts strictly after it no matter what was added on top since.
+type feedCursor struct {
+	Sort   string  `json:"s"`
+	Score  float64 `json:"v"`
+	Member string  `json:"m"`
+}
+
+// GetFeed returns one page of live entries, highest score first (latest time,
+// highest price or most confirmations).
+func (s *PriceService) GetFeed(ctx context.Context, q FeedQuery) (*model.FeedPage, error) {
+	sortBy := normalizeFeedSort(q.Sort)
+	limit := clampFeedLimit(q.Limit)
+	after, err := decodeQueryCursor(q.Cursor, sortBy)
+	if err != nil {
+		return nil, err
+	}
+
+	view, err := s.openFeedView(ctx, sortBy, q.Filter, true)
+	if err != nil {
+		return nil, err
+	}
+	defer s.releaseFeedView(view)
+
+	return s.readFeedPage(ctx, view.key, view.minScore, view.maxScore, sortBy, after, limit, s.loadCodeRecords)
+}
+
+// readFeedPage reads the page after the cursor from a sorted set of codes and
+// resolves the codes to entries with load.
+func (s *PriceService) readFeedPage(
+	ctx context.Context,
+	key, minScore, maxScore, sortBy string,
+	after *feedCursor,
+	limit int64,
+	load func(context.Context, []string) ([]model.PriceItem, error),
+) (*model.FeedPage, error) {
+	if after != nil {
+		maxScore = formatScore(after.Score)
+	}
+
+	entries, err := s.scanFeedAfter(ctx, key, minScore, maxScore, after, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	hasMore := int64(len(entries)) > limit
+	if hasMore {
+		entries = entries[:limit]
+	}
+
+	codes := make([]string, 0, len(entries))
+	for _, z := range entries {
+		codes = append(codes, z.Member.(string))
+	}
+	items, err := load(ctx, codes)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &model.FeedPage{Items: items}
+	if page.Items == nil {
+		page.Items = []model.PriceItem{}
+	}
+	if hasMore {
+		last := entries[len(entries)-1]
+		page.NextCursor = encodeFeedCursor(feedCursor{
+			Sort:   sortBy,
+			Score:  last.Score,
+			Member: last.Member.(string),
+		})
+	}
+	return page, nil
+}
+
+// scanFeedAfter reads up to want members at or below maxScore, skipping the
+// members that share the cursor's score but were already returned (Redis
+// orders equal scores in reverse lexicographic order).
+func (s *PriceService) scanFeedAfter(ctx context.Context, key, minScore, maxScore string, after *feedCursor, want int64) ([]redis.Z, error) {
+	var entries []redis.Z
+	var offset int64
+	for int64(len(entries)) < want {
+		batch, err := s.rdb.ZRevRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{
+			Min:    minScore,
+			Max:    maxScore,
+			Offset: offset,
+			Count:  want,
+		}).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, z := range batch {
+			member, _ := z.Member.(string)
+			if after != nil && z.Score == after.Score && member >= after.Member {
+				continue
+			}
+			z.Member = member
+			entries = append(entries, z)
+		}
+
+		if int64(len(batch)) < want {
+			break
+		}
+		offset += int64(len(batch))
+	}
+
+	if int64(len(entries)) > want {
+		entries = entries[:want]
+	}
+	return entries, nil
+}
+
+// openFeedView resolves a filter against the feed indexes. The sort index
+// (per-server when filtering by server) is the base; the filter on the sort
+// dimension becomes score bounds, every other filter a range that is
+// intersected with the base. With shared, the intersection is cached for
+// feedViewTTL and reused by identical filters; otherwise it belongs to the
+// caller until release.
+func (s *PriceService) openFeedView(ctx context.Context, sortBy string, f FeedFilter, shared bool) (*feedView, error) {
+	server := strings.TrimSpace(f.Server)
+	timeKey, priceKey := keyPriceTime, keyPriceValue
+	if server != "" {
+		timeKey, priceKey = serverFeedKey(server, "time"), serverFeedKey(server, "price")
+	}
+
+	view := &feedView{minScore: "-inf", maxScore: "+inf"}
+	// Expired entries are trimmed from every index at once, so both sorts
+	// already cover the same window and need no bound of their own.
+	priceMin, priceMax := priceBounds(f)
+
+	var ranges []redis.ZRangeArgs
+	switch sortBy {
+	case "confirmed":
+		// The confirmed index is global, so every filter is a range.
+		view.key = keyFeedConfirmed
+		if server != "" || f.Since > 0 {
+			since := "-inf"
+			if f.Since > 0 {
+				since = strconv.FormatInt(f.Since, 10)
+			}
+			ranges = append(ranges, redis.ZRangeArgs{
+				Key: timeKey, Start: since, Stop: "+inf", ByScore: true,
+			})
+		}
+		if f.MinPrice > 0 || f.MaxPrice > 0 {
+			ranges = append(ranges, redis.ZRangeArgs{
+				Key: priceKey, Start: priceMin, Stop: priceMax, ByScore: true,
+			})
+		}
+	case "price":
+		view.key = priceKey
+		view.minScore, view.maxScore = priceMin, priceMax
+		if f.Since > 0 {
+			ranges = append(ranges, redis.ZRangeArgs{
+				Key: timeKey, Start: strconv.FormatInt(f.Since, 10), Stop: "+inf", ByScore: true,
+			})
+		}
+	default:
+		view.key = timeKey
+		if f.Since > 0 {
+			view.minScore = strconv.FormatInt(f.Since, 10)
+		}
+		if f.MinPrice > 0 || f.MaxPrice > 0 {
+			ranges = append(ranges, redis.ZRangeArgs{
+				Key: priceKey, Start: priceMin, Stop: priceMax, ByScore: true,
+			})
+		}
+	}
+
+	if prefix := normalizeFeedCode(f.CodePrefix); prefix != "" {
+		// No valid UTF-8 byte is 0xff, so this bounds every code with the prefix.
+		ranges = append(ranges, redis.ZRangeArgs{
+			Key: keyFeedCodes, Start: "[" + prefix, Stop: "[" + prefix + "\xff", ByLex: true,
+		})
+	}
+
+	if len(ranges) == 0 {
+		return view, nil
+	}
+
+	result, ttl := keyFeedTempPrefix+uuid.New().String(), feedTempTTL
+	if shared {
+		result, ttl = feedViewKey(view.key, ranges), feedViewTTL
+		// A view about to expire is rebuilt rather than read half-gone.
+		left, err := s.rdb.PTTL(ctx, result).Result()
+		if err != nil {
+			return nil, err
+		}
+		if left >= feedViewMinTTL {
+			view.key = result
+			return view, nil
+		}
+	}
+
+	pipe := s.rdb.TxPipeline()
+	keys := []string{view.key}
+	weights := []float64{1}
+	var ranged []string
+	for _, r := range ranges {
+		tmp := keyFeedTempPrefix + uuid.New().String()
+		ranged = append(ranged, tmp)
+		pipe.ZRangeStore(ctx, tmp, r)
+		keys = append(keys, tmp)
+		weights = append(weights, 0)
+	}
+	// Weight 0 on the filter sets keeps the scores of the sort index.
+	pipe.ZInterStore(ctx, result, &redis.ZStore{Keys: keys, Weights: weights, Aggregate: "SUM"})
+	pipe.Expire(ctx, result, ttl)
+	pipe.Del(ctx, ranged...)
+	if _, err := pipe.Exec(ctx); err != nil {
+		if !shared {
+			s.releaseFeedView(&feedView{temp: []string{result}})
+		}
+		return nil, err
+	}
+	view.key = result
+	if !shared {
+		view.temp = []string{result}
+	}
+	return view, nil
+}
+
+// feedViewKey names the cached intersection of base with ranges.
+func feedViewKey(base string, ranges []redis.ZRangeArgs) string {
+	sum := sha256.New()
+	sum.Write([]byte(base))
+	for _, r := range ranges {
+		sum.Write([]byte("\x00" + r.Key + "\x00" + fmt.Sprint(r.Start) + "\x00" + fmt.Sprint(r.Stop) + "\x00" + strconv.FormatBool(r.ByLex)))
+	}
+	return keyFeedViewPrefix + hex.EncodeToString(sum.Sum(nil))
+}
+
+func (s *PriceService) releaseFeedView(view *feedView) {
+	if view == nil || len(view.temp) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = s.rdb.Del(ctx, view.temp...).Err()
+}
+
+// touchFeedView keeps the temporary sets of a long-lived view from expiring.
+func (s *PriceService) touchFeedView(ctx context.Context, view *feedView) {
+	for _, key := range view.temp {
+		_ = s.rdb.Expire(ctx, key, feedTempTTL).Err()
+	}
+}
+
+func priceBounds(f FeedFilter) (string, string) {
+	minScore, maxScore := "-inf", "+inf"
+	if f.MinPrice > 0 {
+		minScore = formatScore(f.MinPrice)
+	}
+	if f.MaxPrice > 0 {
+		maxScore = formatScore(f.MaxPrice)
+	}
+	return minScore, maxScore
+}
+
+func clampFeedLimit(limit int64) int64 {
+	if limit <= 0 {
+		return FeedDefaultLimit
+	}
+	if limit > FeedMaxLimit {
+		return FeedMaxLimit
+	}
+	return limit
+}
+
+func normalizeFeedSort(sortBy string) string {
+	switch sortBy {
+	case "price", "confirmed":
+		return sortBy
+	default:
+		return "time"
+	}
+}
+
+func formatScore(score float64) string {
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
+
+func encodeFeedCursor(cursor feedCursor) string {
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeQueryCursor decodes an optional cursor; an empty one starts at the top.
+func decodeQueryCursor(value, sortBy string) (*feedCursor, error) {
+	if value == "" {
+		return nil, nil
+	}
+	return decodeFeedCursor(value, sortBy)
+}
+
+func decodeFeedCursor(value, sortBy string) (*feedCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor feedCursor
+	if err := json.Unmarshal(raw, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if cursor.Sort != sortBy || cursor.Member == "" {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
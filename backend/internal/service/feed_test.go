@@ -0,0 +1,119 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lingbao-market/backend/internal/model"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestFeedCursorRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	encoded := encodeFeedCursor(feedCursor{Sort: "price", Score: 912.5, Member: "ABC123"})
+	decoded, err := decodeFeedCursor(encoded, "price")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if decoded.Score != 912.5 || decoded.Member != "ABC123" {
+		t.Fatalf("unexpected cursor: %+v", decoded)
+	}
+	if formatScore(decoded.Score) != "912.5" {
+		t.Fatalf("unexpected score format %q", formatScore(decoded.Score))
+	}
+}
+
+func TestFeedCursorRejectsInvalid(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"garbage":        "!!!",
+		"wrong_sort":     encodeFeedCursor(feedCursor{Sort: "time", Score: 1, Member: "ABC"}),
+		"missing_member": encodeFeedCursor(feedCursor{Sort: "price", Score: 1}),
+	}
+	for name, value := range cases {
+		value := value
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := decodeFeedCursor(value, "price"); !errors.Is(err, ErrInvalidCursor) {
+				t.Fatalf("expected ErrInvalidCursor, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCompareStreamIDs(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{a: "1700000000000-0", b: "1700000000000-0", want: 0},
+		{a: "1700000000000-1", b: "1700000000000-0", want: 1},
+		{a: "1699999999999-9", b: "1700000000000-0", want: -1},
+		{a: "1700000000000", b: "1700000000000-0", want: 0},
+		{a: "garbage", b: "1-0", want: -1},
+	}
+	for _, tc := range cases {
+		if got := compareStreamIDs(tc.a, tc.b); got != tc.want {
+			t.Fatalf("compareStreamIDs(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestFeedFilterMatches(t *testing.T) {
+	t.Parallel()
+
+	item := model.PriceItem{Code: "ABC123", Price: 500, Server: "s1", Timestamp: 2000}
+	cases := []struct {
+		name   string
+		filter FeedFilter
+		want   bool
+	}{
+		{name: "empty", filter: FeedFilter{}, want: true},
+		{name: "server", filter: FeedFilter{Server: "s1"}, want: true},
+		{name: "other_server", filter: FeedFilter{Server: "s2"}, want: false},
+		{name: "price_range", filter: FeedFilter{MinPrice: 400, MaxPrice: 600}, want: true},
+		{name: "below_min", filter: FeedFilter{MinPrice: 501}, want: false},
+		{name: "prefix_case_insensitive", filter: FeedFilter{CodePrefix: "abc"}, want: true},
+		{name: "prefix_miss", filter: FeedFilter{CodePrefix: "XYZ"}, want: false},
+		{name: "since", filter: FeedFilter{Since: 3000}, want: false},
+	}
+	for _, tc := range cases {
+		if got := tc.filter.Matches(item); got != tc.want {
+			t.Fatalf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestFeedViewKey(t *testing.T) {
+	t.Parallel()
+
+	priceRange := redis.ZRangeArgs{Key: keyPriceValue, Start: "900", Stop: "+inf", ByScore: true}
+	prefixRange := redis.ZRangeArgs{Key: keyFeedCodes, Start: "[AB", Stop: "[AB\xff", ByLex: true}
+
+	key := feedViewKey(keyPriceTime, []redis.ZRangeArgs{priceRange, prefixRange})
+	if !strings.HasPrefix(key, keyFeedViewPrefix) {
+		t.Fatalf("expected view prefix, got %q", key)
+	}
+	if again := feedViewKey(keyPriceTime, []redis.ZRangeArgs{priceRange, prefixRange}); again != key {
+		t.Fatalf("expected the same filter to share a view, got %q and %q", key, again)
+	}
+
+	otherPrice := priceRange
+	otherPrice.Start = "950"
+	others := map[string]string{
+		"base":   feedViewKey(keyFeedConfirmed, []redis.ZRangeArgs{priceRange, prefixRange}),
+		"bounds": feedViewKey(keyPriceTime, []redis.ZRangeArgs{otherPrice, prefixRange}),
+		"ranges": feedViewKey(keyPriceTime, []redis.ZRangeArgs{priceRange}),
+	}
+	for name, other := range others {
+		if other == key {
+			t.Fatalf("%s: expected a different view key", name)
+		}
+	}
+}
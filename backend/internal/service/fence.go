@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrFenced means a fenced write was refused because the lock it was made
+// under has been taken over.
+var ErrFenced = errors.New("write fenced off by a newer lock holder")
+
+// Fence ties writes to a scheduler lock. Redis applies a fenced write only
+// while Key still holds Token, so a replica that lost its lock can't clobber
+// the work of the one that took over.
+type Fence struct {
+	Key   string
+	Token int64
+}
+
+type fenceContextKey struct{}
+
+// WithFence fences the feed writes made with ctx.
+func WithFence(ctx context.Context, fence Fence) context.Context {
+	return context.WithValue(ctx, fenceContextKey{}, fence)
+}
+
+func fenceFromContext(ctx context.Context) (Fence, bool) {
+	fence, ok := ctx.Value(fenceContextKey{}).(Fence)
+	return fence, ok && fence.Key != ""
+}
+
+// fenceScriptArgs returns the key and token a script compares. An empty key
+// means the write is not fenced.
+func fenceScriptArgs(ctx context.Context) (string, string) {
+	fence, ok := fenceFromContext(ctx)
+	if !ok {
+		return "", ""
+	}
+	return fence.Key, strconv.FormatInt(fence.Token, 10)
+}
+
+// checkFence returns ErrFenced unless the lock still holds the token. Run it
+// inside a WATCH on fence.Key so a takeover before EXEC aborts the write.
+func checkFence(ctx context.Context, tx *redis.Tx, fence Fence) error {
+	current, err := tx.Get(ctx, fence.Key).Result()
+	if errors.Is(err, redis.Nil) {
+		return ErrFenced
+	}
+	if err != nil {
+		return err
+	}
+	if current != strconv.FormatInt(fence.Token, 10) {
+		return ErrFenced
+	}
+	return nil
+}
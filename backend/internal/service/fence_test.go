@@ -0,0 +1,24 @@
+package service
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFenceScriptArgs(t *testing.T) {
+	t.Parallel()
+
+	if key, token := fenceScriptArgs(context.Background()); key != "" || token != "" {
+		t.Fatalf("expected an unfenced write, got %q %q", key, token)
+	}
+
+	ctx := WithFence(context.Background(), Fence{Key: "scheduler:lock:daily_cleanup", Token: 42})
+	key, token := fenceScriptArgs(ctx)
+	if key != "scheduler:lock:daily_cleanup" || token != "42" {
+		t.Fatalf("expected the lock key and token, got %q %q", key, token)
+	}
+
+	if _, ok := fenceFromContext(WithFence(context.Background(), Fence{Token: 1})); ok {
+		t.Fatalf("expected a fence without a key to be ignored")
+	}
+}
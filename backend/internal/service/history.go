@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/lingbao-market/backend/internal/model"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Per-code sorted set of JSON submissions scored by time. Unlike the feed
+	// it survives ClearAllPrices and only ages out after the retention period.
+	keyHistoryPrefix = "market:history:"
+
+	defaultHistoryRetention = 30 * 24 * time.Hour
+	historyMaxEntries       = 1000
+)
+
+// appendHistory queues a submission into its code's history and trims
+// entries past the retention period.
+func (s *PriceService) appendHistory(ctx context.Context, pipe redis.Pipeliner, val []byte, sub model.PriceItem) {
+	key := keyHistoryPrefix + sub.Code
+	cutoff := time.Now().Add(-s.opts.HistoryRetention).UnixMilli()
+
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(sub.Timestamp), Member: val})
+	pipe.ZRemRangeByScore(ctx, key, "-inf", fmt.Sprintf("(%d", cutoff))
+	pipe.ZRemRangeByRank(ctx, key, 0, -historyMaxEntries-1)
+	pipe.Expire(ctx, key, s.opts.HistoryRetention)
+}
+
+// GetHistory returns the retained submissions of a code, oldest first, with
+// summary statistics over their prices.
+func (s *PriceService) GetHistory(ctx context.Context, code string) (*model.PriceHistory, error) {
+	code = normalizeFeedCode(code)
+	cutoff := time.Now().Add(-s.opts.HistoryRetention).UnixMilli()
+
+	vals, err := s.rdb.ZRangeByScore(ctx, keyHistoryPrefix+code, &redis.ZRangeBy{
+		Min: strconv.FormatInt(cutoff, 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	history := &model.PriceHistory{
+		Code:        code,
+		Submissions: make([]model.PriceItem, 0, len(vals)),
+	}
+	prices := make([]float64, 0, len(vals))
+	for _, val := range vals {
+		var item model.PriceItem
+		if err := json.Unmarshal([]byte(val), &item); err != nil {
+			continue
+		}
+		// History is public; submitters are not.
+		item.SubmitterID, item.SubmitterName = "", ""
+		history.Submissions = append(history.Submissions, item)
+		prices = append(prices, item.Price)
+	}
+	history.Summary = summarizePrices(prices)
+	return history, nil
+}
+
+// replaceHistory swaps the stored copy of a submission, or drops it when
+// updated is nil.
+func (s *PriceService) replaceHistory(ctx context.Context, previous model.PriceItem, updated *model.PriceItem) error {
+	key := keyHistoryPrefix + previous.Code
+	score := strconv.FormatInt(previous.Timestamp, 10)
+
+	vals, err := s.rdb.ZRangeByScore(ctx, key, &redis.ZRangeBy{Min: score, Max: score}).Result()
+	if err != nil {
+		return err
+	}
+
+	pipe := s.rdb.TxPipeline()
+	found := false
+	for _, val := range vals {
+		var item model.PriceItem
+		if err := json.Unmarshal([]byte(val), &item); err != nil || item.ID != previous.ID {
+			continue
+		}
+		pipe.ZRem(ctx, key, val)
+		found = true
+	}
+	if !found {
+		return nil
+	}
+	if updated != nil {
+		val, err := json.Marshal(updated)
+		if err != nil {
+			return err
+		}
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(updated.Timestamp), Member: val})
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func summarizePrices(prices []float64) model.PriceSummary {
+	if len(prices) == 0 {
+		return model.PriceSummary{}
+	}
+	sorted := append([]float64(nil), prices...)
+	sort.Float64s(sorted)
+	return model.PriceSummary{
+		Count:  len(sorted),
+		Min:    sorted[0],
+		Max:    sorted[len(sorted)-1],
+		Median: percentile(sorted, 0.5),
+	}
+}
+
+// percentile interpolates linearly between the closest ranks of an
+// ascending slice.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	if p <= 0 {
+		return sorted[0]
+	}
+	if p >= 1 {
+		return sorted[len(sorted)-1]
+	}
+	rank := p * float64(len(sorted)-1)
+	lower := int(rank)
+	frac := rank - float64(lower)
+	if lower+1 >= len(sorted) {
+		return sorted[lower]
+	}
+	return sorted[lower] + frac*(sorted[lower+1]-sorted[lower])
+}
@@ -0,0 +1,43 @@
+package service
+
+import "testing"
+
+func TestSummarizePrices(t *testing.T) {
+	t.Parallel()
+
+	t.Run("empty", func(t *testing.T) {
+		summary := summarizePrices(nil)
+		if summary.Count != 0 || summary.Median != 0 {
+			t.Fatalf("expected zero summary, got %+v", summary)
+		}
+	})
+
+	t.Run("odd", func(t *testing.T) {
+		summary := summarizePrices([]float64{900, 300, 450})
+		if summary.Count != 3 || summary.Min != 300 || summary.Max != 900 || summary.Median != 450 {
+			t.Fatalf("unexpected summary: %+v", summary)
+		}
+	})
+
+	t.Run("even", func(t *testing.T) {
+		summary := summarizePrices([]float64{100, 400, 200, 300})
+		if summary.Median != 250 {
+			t.Fatalf("expected median 250, got %v", summary.Median)
+		}
+	})
+}
+
+func TestPercentile(t *testing.T) {
+	t.Parallel()
+
+	sorted := []float64{10, 20, 30, 40, 50, 60, 70, 80, 90, 100}
+	if got := percentile(sorted, 0.9); got != 91 {
+		t.Fatalf("expected p90 91, got %v", got)
+	}
+	if got := percentile(sorted, 0); got != 10 {
+		t.Fatalf("expected p0 10, got %v", got)
+	}
+	if got := percentile(sorted, 1); got != 100 {
+		t.Fatalf("expected p100 100, got %v", got)
+	}
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// String per scoped Idempotency-Key: a pending marker while the first
+	// request runs, then its JSON response for the rest of the window.
+	keyIdempotencyPrefix = "idempotency:"
+
+	defaultIdempotencyWindow = 24 * time.Hour
+	// How long a pending marker holds the key if the request never finishes.
+	idempotencyLease = 2 * time.Minute
+)
+
+var (
+	ErrIdempotencyInProgress = errors.New("request with this idempotency key is in progress")
+	ErrIdempotencyMismatch   = errors.New("idempotency key reused with a different request")
+)
+
+// IdempotentResponse is the stored outcome of a request.
+type IdempotentResponse struct {
+	Fingerprint string `json:"f"`
+	Status      int    `json:"s,omitempty"`
+	Body        []byte `json:"b,omitempty"`
+}
+
+// BeginIdempotent claims key for a request with the given fingerprint. It
+// returns the stored response when the request already completed, or nil
+// when the caller holds the key and must Finish or Abort it.
+func (s *PriceService) BeginIdempotent(ctx context.Context, key, fingerprint string) (*IdempotentResponse, error) {
+	key = keyIdempotencyPrefix + key
+	marker, err := json.Marshal(IdempotentResponse{Fingerprint: fingerprint})
+	if err != nil {
+		return nil, err
+	}
+
+	claimed, err := s.rdb.SetNX(ctx, key, marker, idempotencyLease).Result()
+	if err != nil {
+		return nil, err
+	}
+	if claimed {
+		return nil, nil
+	}
+
+	raw, err := s.rdb.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		// Aborted or expired in between; the client may retry right away.
+		return nil, ErrIdempotencyInProgress
+	}
+	if err != nil {
+		return nil, err
+	}
+	var stored IdempotentResponse
+	if err := json.Unmarshal(raw, &stored); err != nil {
+		return nil, err
+	}
+	if stored.Fingerprint != fingerprint {
+		return nil, ErrIdempotencyMismatch
+	}
+	if stored.Status == 0 {
+		return nil, ErrIdempotencyInProgress
+	}
+	return &stored, nil
+}
+
+// FinishIdempotent stores the response of a claimed request for the
+// idempotency window.
+func (s *PriceService) FinishIdempotent(ctx context.Context, key, fingerprint string, status int, body []byte) error {
+	val, err := json.Marshal(IdempotentResponse{Fingerprint: fingerprint, Status: status, Body: body})
+	if err != nil {
+		return err
+	}
+	return s.rdb.Set(ctx, keyIdempotencyPrefix+key, val, s.opts.IdempotencyWindow).Err()
+}
+
+// AbortIdempotent releases a claimed key so the request can be retried.
+func (s *PriceService) AbortIdempotent(ctx context.Context, key string) error {
+	return s.rdb.Del(ctx, keyIdempotencyPrefix+key).Err()
+}
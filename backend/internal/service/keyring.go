@@ -0,0 +1,377 @@
+package service
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/lingbao-market/backend/internal/model"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// Hash of kid -> JSON signingKey for every key still accepted.
+	keySigningKeys = "auth:keys"
+	// kid of the key new tokens are signed with.
+	keySigningActive = "auth:keys:active"
+
+	// DefaultKeyID names the key configured by JWT_SECRET. Its secret never
+	// leaves the config; tokens without a kid were signed with it.
+	DefaultKeyID = "default"
+
+	defaultKeyRetireAfter = 30 * 24 * time.Hour
+	keyringReloadInterval = 30 * time.Second
+	// Floor between reloads triggered by an unknown kid, so forged kids
+	// can't hammer Redis.
+	keyringMissReloadInterval = 2 * time.Second
+
+	signingKeySize = 32
+	// HKDF info of the key that encrypts the stored signing keys.
+	keyEncryptionInfo = "lingbao-market jwt key encryption"
+)
+
+var ErrKeyRotationConflict = errors.New("key rotation conflict, try again")
+
+// signingKey records a rotated key. Its secret is random and stored sealed
+// with a key derived from JWT_SECRET, so neither Redis nor JWT_SECRET alone
+// reveals it, and one leaked key says nothing about the others.
+type signingKey struct {
+	// Secret is the sealed secret; see sealSigningKey.
+	Secret    string `json:"secret,omitempty"`
+	CreatedAt int64  `json:"createdAt"`
+	// RetiresAt is when a replaced key stops verifying; 0 while active.
+	RetiresAt int64 `json:"retiresAt,omitempty"`
+}
+
+// Keyring holds the HS256 keys tokens are signed and verified with. The kids
+// are shared through Redis so every replica follows a rotation; each replica
+// keeps a copy it reloads every keyringReloadInterval, or sooner when a token
+// names a kid it doesn't know yet.
+type Keyring struct {
+	rdb         *redis.Client
+	fallback    []byte
+	kek         []byte
+	retireAfter time.Duration
+
+	mu       sync.RWMutex
+	keys     map[string][]byte
+	active   string
+	loadedAt time.Time
+}
+
+// NewKeyring starts a keyring whose only key is secret, under DefaultKeyID.
+// Replaced keys keep verifying for retireAfter.
+func NewKeyring(rdb *redis.Client, secret string, retireAfter time.Duration) *Keyring {
+	if retireAfter <= 0 {
+		retireAfter = defaultKeyRetireAfter
+	}
+	return &Keyring{
+		rdb:         rdb,
+		fallback:    []byte(secret),
+		kek:         keyEncryptionKey([]byte(secret)),
+		retireAfter: retireAfter,
+		keys:        map[string][]byte{DefaultKeyID: []byte(secret)},
+		active:      DefaultKeyID,
+	}
+}
+
+// Sign signs claims with the active key and names it in the kid header.
+func (k *Keyring) Sign(ctx context.Context, claims jwt.MapClaims) (string, error) {
+	k.reload(ctx, false)
+
+	k.mu.RLock()
+	kid, secret := k.active, k.keys[k.active]
+	k.mu.RUnlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = kid
+	return token.SignedString(secret)
+}
+
+// ActiveKeyID returns the kid new tokens are signed with.
+func (k *Keyring) ActiveKeyID(ctx context.Context) string {
+	k.reload(ctx, false)
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active
+}
+
+// Parse verifies a token against the key its kid names. Only HS256 is
+// accepted, whatever the token header claims.
+func (k *Keyring) Parse(ctx context.Context, tokenString string) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			kid = DefaultKeyID
+		}
+		if secret, ok := k.lookup(ctx, kid); ok {
+			return secret, nil
+		}
+		return nil, errors.New("unknown signing key")
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+}
+
+// Rotate makes a fresh key active. The previous key keeps verifying until it
+// retires, so outstanding tokens stay valid; keys past retirement are
+// dropped.
+func (k *Keyring) Rotate(ctx context.Context) (*model.SigningKey, error) {
+	if k.rdb == nil {
+		return nil, errors.New("keyring has no store")
+	}
+	now := time.Now()
+	kid := uuid.New().String()
+	secret := make([]byte, signingKeySize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	sealed, err := sealSigningKey(k.kek, kid, secret)
+	if err != nil {
+		return nil, err
+	}
+	fresh := signingKey{Secret: sealed, CreatedAt: now.UnixMilli()}
+
+	txf := func(tx *redis.Tx) error {
+		stored, active, err := loadSigningKeys(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if active == "" {
+			active = DefaultKeyID
+		}
+		previous, ok := stored[active]
+		if !ok {
+			// The configured key is only recorded once it is replaced.
+			previous = signingKey{}
+		}
+		previous.RetiresAt = now.Add(k.retireAfter).UnixMilli()
+
+		fields := map[string]interface{}{}
+		for _, entry := range []struct {
+			kid string
+			key signingKey
+		}{{active, previous}, {kid, fresh}} {
+			val, err := json.Marshal(entry.key)
+			if err != nil {
+				return err
+			}
+			fields[entry.kid] = val
+		}
+		var expired []string
+		for id, key := range stored {
+			if key.RetiresAt > 0 && key.RetiresAt <= now.UnixMilli() {
+				expired = append(expired, id)
+			}
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if len(expired) > 0 {
+				pipe.HDel(ctx, keySigningKeys, expired...)
+			}
+			pipe.HSet(ctx, keySigningKeys, fields)
+			pipe.Set(ctx, keySigningActive, kid, 0)
+			return nil
+		})
+		return err
+	}
+	err = k.rdb.Watch(ctx, txf, keySigningKeys, keySigningActive)
+	if errors.Is(err, redis.TxFailedErr) {
+		return nil, ErrKeyRotationConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	k.reload(ctx, true)
+	return &model.SigningKey{ID: kid, CreatedAt: fresh.CreatedAt, Active: true}, nil
+}
+
+// List describes the keys still accepted, active first. Secrets are left out.
+func (k *Keyring) List(ctx context.Context) ([]model.SigningKey, error) {
+	if k.rdb == nil {
+		return []model.SigningKey{{ID: DefaultKeyID, Active: true}}, nil
+	}
+	stored, active, err := loadSigningKeys(ctx, k.rdb)
+	if err != nil {
+		return nil, err
+	}
+	if active == "" {
+		active = DefaultKeyID
+	}
+	if _, ok := stored[DefaultKeyID]; !ok && active == DefaultKeyID {
+		stored[DefaultKeyID] = signingKey{}
+	}
+
+	now := time.Now().UnixMilli()
+	keys := make([]model.SigningKey, 0, len(stored))
+	for kid, key := range stored {
+		if key.RetiresAt > 0 && key.RetiresAt <= now {
+			continue
+		}
+		keys = append(keys, model.SigningKey{
+			ID:        kid,
+			CreatedAt: key.CreatedAt,
+			RetiresAt: key.RetiresAt,
+			Active:    kid == active,
+		})
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Active != keys[j].Active {
+			return keys[i].Active
+		}
+		return keys[i].CreatedAt > keys[j].CreatedAt
+	})
+	return keys, nil
+}
+
+func (k *Keyring) lookup(ctx context.Context, kid string) ([]byte, bool) {
+	k.reload(ctx, false)
+	k.mu.RLock()
+	secret, ok := k.keys[kid]
+	k.mu.RUnlock()
+	if ok {
+		return secret, true
+	}
+
+	// A replica may have rotated since the last reload.
+	k.mu.RLock()
+	stale := time.Since(k.loadedAt) >= keyringMissReloadInterval
+	k.mu.RUnlock()
+	if !stale {
+		return nil, false
+	}
+	k.reload(ctx, true)
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	secret, ok = k.keys[kid]
+	return secret, ok
+}
+
+// reload refreshes the keys from Redis when they are older than the reload
+// interval, or right away with force. On failure the current keys stay.
+func (k *Keyring) reload(ctx context.Context, force bool) {
+	if k.rdb == nil {
+		return
+	}
+	k.mu.RLock()
+	fresh := !force && time.Since(k.loadedAt) < keyringReloadInterval
+	k.mu.RUnlock()
+	if fresh {
+		return
+	}
+
+	stored, active, err := loadSigningKeys(ctx, k.rdb)
+	if err != nil {
+		log.Printf("Signing key reload failed: %v", err)
+		return
+	}
+
+	now := time.Now().UnixMilli()
+	keys := make(map[string][]byte, len(stored)+1)
+	keys[DefaultKeyID] = k.fallback
+	for kid, key := range stored {
+		if key.RetiresAt > 0 && key.RetiresAt <= now {
+			delete(keys, kid)
+			continue
+		}
+		if kid == DefaultKeyID {
+			continue
+		}
+		secret, err := openSigningKey(k.kek, kid, key.Secret)
+		if err != nil {
+			log.Printf("Signing key %s can't be opened: %v", kid, err)
+			continue
+		}
+		keys[kid] = secret
+	}
+	if _, ok := keys[active]; !ok {
+		active = DefaultKeyID
+		keys[DefaultKeyID] = k.fallback
+	}
+
+	k.mu.Lock()
+	k.keys, k.active, k.loadedAt = keys, active, time.Now()
+	k.mu.Unlock()
+}
+
+// keyEncryptionKey derives the key that seals stored signing keys from
+// JWT_SECRET. Changing JWT_SECRET makes every rotated key unreadable.
+func keyEncryptionKey(master []byte) []byte {
+	kek := make([]byte, 32)
+	// Reading 32 bytes from HKDF-SHA256 can't fail.
+	_, _ = io.ReadFull(hkdf.New(sha256.New, master, nil, []byte(keyEncryptionInfo)), kek)
+	return kek
+}
+
+// sealSigningKey encrypts a signing key with AES-256-GCM under kek, bound to
+// its kid, and returns base64(nonce || ciphertext).
+func sealSigningKey(kek []byte, kid string, secret []byte) (string, error) {
+	aead, err := newKeyAEAD(kek)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, secret, []byte(kid))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openSigningKey reverses sealSigningKey.
+func openSigningKey(kek []byte, kid, sealed string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newKeyAEAD(kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < aead.NonceSize() {
+		return nil, errors.New("sealed key too short")
+	}
+	nonce, ciphertext := raw[:aead.NonceSize()], raw[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, []byte(kid))
+}
+
+func newKeyAEAD(kek []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func loadSigningKeys(ctx context.Context, rdb redis.Cmdable) (map[string]signingKey, string, error) {
+	vals, err := rdb.HGetAll(ctx, keySigningKeys).Result()
+	if err != nil {
+		return nil, "", err
+	}
+	active, err := rdb.Get(ctx, keySigningActive).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, "", err
+	}
+
+	keys := make(map[string]signingKey, len(vals))
+	for kid, val := range vals {
+		var key signingKey
+		if err := json.Unmarshal([]byte(val), &key); err != nil {
+			continue
+		}
+		keys[kid] = key
+	}
+	return keys, active, nil
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestKeyringSignsWithKid(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ring := NewKeyring(nil, "secret", 0)
+	signed, err := ring.Sign(ctx, jwt.MapClaims{"sub": "user-1"})
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	token, err := ring.Parse(ctx, signed)
+	if err != nil || !token.Valid {
+		t.Fatalf("expected valid token, got %v", err)
+	}
+	if kid := token.Header["kid"]; kid != DefaultKeyID {
+		t.Fatalf("expected kid %q, got %v", DefaultKeyID, kid)
+	}
+}
+
+func TestKeyringParse(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ring := NewKeyring(nil, "secret", 0)
+	claims := jwt.MapClaims{"sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()}
+	sign := func(method jwt.SigningMethod, kid string, key interface{}) string {
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		return signed
+	}
+
+	// Tokens from before the keyring carry no kid.
+	if _, err := ring.Parse(ctx, sign(jwt.SigningMethodHS256, "", []byte("secret"))); err != nil {
+		t.Fatalf("expected token without kid to verify, got %v", err)
+	}
+
+	rejected := map[string]string{
+		"unknown kid": sign(jwt.SigningMethodHS256, "missing", []byte("secret")),
+		"wrong key":   sign(jwt.SigningMethodHS256, DefaultKeyID, []byte("other")),
+		"hs384":       sign(jwt.SigningMethodHS384, DefaultKeyID, []byte("secret")),
+		"none":        sign(jwt.SigningMethodNone, DefaultKeyID, jwt.UnsafeAllowNoneSignatureType),
+	}
+	for name, token := range rejected {
+		if _, err := ring.Parse(ctx, token); err == nil {
+			t.Fatalf("%s: expected error, got nil", name)
+		}
+	}
+}
+
+func TestSealSigningKey(t *testing.T) {
+	t.Parallel()
+
+	kek := keyEncryptionKey([]byte("secret"))
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	sealed, err := sealSigningKey(kek, "kid-1", secret)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if strings.Contains(sealed, string(secret)) {
+		t.Fatalf("expected the sealed key not to contain the secret")
+	}
+
+	opened, err := openSigningKey(kek, "kid-1", sealed)
+	if err != nil || !bytes.Equal(opened, secret) {
+		t.Fatalf("expected the secret back, got %q (%v)", opened, err)
+	}
+	if _, err := openSigningKey(kek, "kid-2", sealed); err == nil {
+		t.Fatalf("expected a sealed key not to open under another kid")
+	}
+	if _, err := openSigningKey(keyEncryptionKey([]byte("other")), "kid-1", sealed); err == nil {
+		t.Fatalf("expected a sealed key not to open under another JWT_SECRET")
+	}
+}
+
+func TestKeyringRotate(t *testing.T) {
+	rdb := testRedis(t)
+	ctx := context.Background()
+	ring := NewKeyring(rdb, "secret", time.Hour)
+
+	before, err := ring.Sign(ctx, jwt.MapClaims{"sub": "user-1"})
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	rotated, err := ring.Rotate(ctx)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	after, err := ring.Sign(ctx, jwt.MapClaims{"sub": "user-1"})
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	// Another replica with the same JWT_SECRET follows the rotation and
+	// still accepts tokens of the retiring key.
+	replica := NewKeyring(rdb, "secret", time.Hour)
+	for name, signed := range map[string]string{"before": before, "after": after} {
+		if _, err := replica.Parse(ctx, signed); err != nil {
+			t.Fatalf("%s: expected the replica to verify, got %v", name, err)
+		}
+	}
+	token, _ := replica.Parse(ctx, after)
+	if kid := token.Header["kid"]; kid != rotated.ID {
+		t.Fatalf("expected kid %q, got %v", rotated.ID, kid)
+	}
+
+	// JWT_SECRET alone can't recreate the rotated key.
+	if _, err := NewKeyring(nil, "secret", time.Hour).Parse(ctx, after); err == nil {
+		t.Fatalf("expected the rotated key not to follow from JWT_SECRET")
+	}
+	if _, err := NewKeyring(rdb, "other", time.Hour).Parse(ctx, after); err == nil {
+		t.Fatalf("expected another JWT_SECRET not to open the rotated key")
+	}
+}
@@ -0,0 +1,54 @@
+package service
+
+import "time"
+
+// MarketDay places the daily reset: a market day runs from one reset to the
+// next and is named after the date it started on.
+type MarketDay struct {
+	Hour     int
+	Minute   int
+	Location *time.Location
+}
+
+func (d MarketDay) location() *time.Location {
+	if d.Location == nil {
+		return time.Local
+	}
+	return d.Location
+}
+
+// Start returns the reset that opened the market day containing t.
+func (d MarketDay) Start(t time.Time) time.Time {
+	t = t.In(d.location())
+	start := time.Date(t.Year(), t.Month(), t.Day(), d.Hour, d.Minute, 0, 0, d.location())
+	if start.After(t) {
+		start = start.AddDate(0, 0, -1)
+	}
+	return start
+}
+
+// Date returns the name of the market day containing t.
+func (d MarketDay) Date(t time.Time) string {
+	return d.Start(t).Format(ArchiveDateLayout)
+}
+
+// Bounds returns the start and end of the market day with the given name.
+func (d MarketDay) Bounds(date string) (time.Time, time.Time, error) {
+	day, err := time.ParseInLocation(ArchiveDateLayout, date, d.location())
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	start := time.Date(day.Year(), day.Month(), day.Day(), d.Hour, d.Minute, 0, 0, d.location())
+	return start, start.AddDate(0, 0, 1), nil
+}
+
+// HourStart returns the start of the hour containing t, aligned to the
+// minute the market day resets on.
+func (d MarketDay) HourStart(t time.Time) time.Time {
+	t = t.In(d.location())
+	start := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), d.Minute, 0, 0, d.location())
+	if start.After(t) {
+		start = start.Add(-time.Hour)
+	}
+	return start
+}
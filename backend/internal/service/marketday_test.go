@@ -0,0 +1,49 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMarketDay(t *testing.T) {
+	t.Parallel()
+
+	loc := time.FixedZone("UTC+8", 8*60*60)
+	day := MarketDay{Hour: 3, Minute: 30, Location: loc}
+
+	t.Run("after reset", func(t *testing.T) {
+		now := time.Date(2024, 5, 2, 10, 0, 0, 0, loc)
+		if got := day.Date(now); got != "2024-05-02" {
+			t.Fatalf("expected 2024-05-02, got %s", got)
+		}
+	})
+
+	t.Run("before reset", func(t *testing.T) {
+		now := time.Date(2024, 5, 2, 3, 29, 0, 0, loc)
+		if got := day.Date(now); got != "2024-05-01" {
+			t.Fatalf("expected 2024-05-01, got %s", got)
+		}
+	})
+
+	t.Run("other zone", func(t *testing.T) {
+		now := time.Date(2024, 5, 1, 20, 0, 0, 0, time.UTC)
+		start := day.Start(now)
+		want := time.Date(2024, 5, 2, 3, 30, 0, 0, loc)
+		if !start.Equal(want) {
+			t.Fatalf("expected %v, got %v", want, start)
+		}
+	})
+
+	t.Run("bounds", func(t *testing.T) {
+		start, end, err := day.Bounds("2024-05-01")
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		if !start.Equal(time.Date(2024, 5, 1, 3, 30, 0, 0, loc)) || end.Sub(start) != 24*time.Hour {
+			t.Fatalf("unexpected bounds %v - %v", start, end)
+		}
+		if _, _, err := day.Bounds("2024-13-01"); err == nil {
+			t.Fatalf("expected error, got nil")
+		}
+	})
+}
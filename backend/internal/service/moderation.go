@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lingbao-market/backend/internal/model"
+	"github.com/redis/go-redis/v9"
+)
+
+// ModerationMode decides which manual submissions wait for an admin before
+// they reach the feed. Trusted users and admins are never held.
+type ModerationMode string
+
+const (
+	ModerationOff       ModerationMode = "off"
+	ModerationGuests    ModerationMode = "guests"
+	ModerationUntrusted ModerationMode = "untrusted"
+)
+
+func ParseModerationMode(value string) (ModerationMode, error) {
+	switch mode := ModerationMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case ModerationOff, ModerationGuests, ModerationUntrusted:
+		return mode, nil
+	case "":
+		return ModerationOff, nil
+	}
+	return "", fmt.Errorf("unknown moderation mode %q", value)
+}
+
+// Holds reports whether a submission from a submitter of the given tier
+// waits in the queue.
+func (m ModerationMode) Holds(guest bool, tier string) bool {
+	switch m {
+	case ModerationGuests:
+		return guest
+	case ModerationUntrusted:
+		return guest || tier == TierNew
+	}
+	return false
+}
+
+const (
+	// Hash of pending ID -> JSON submission, plus a sorted set of the same
+	// IDs scored by when they were queued.
+	keyModerationPending = "moderation:pending"
+	keyModerationQueue   = "moderation:queue"
+
+	ModerationDefaultLimit = 50
+	ModerationMaxLimit     = 500
+)
+
+var ErrPendingNotFound = errors.New("pending submission not found")
+
+// takePendingScript removes a pending submission and returns it, so that two
+// admins can't both decide on it.
+var takePendingScript = redis.NewScript(`
+local val = redis.call('HGET', KEYS[1], ARGV[1])
+if val then
+	redis.call('HDEL', KEYS[1], ARGV[1])
+	redis.call('ZREM', KEYS[2], ARGV[1])
+end
+return val
+`)
+
+// QueueSubmission holds a submission for review instead of publishing it.
+// The returned copy carries its pending ID.
+func (s *PriceService) QueueSubmission(ctx context.Context, item model.PriceItem) (*model.PriceItem, error) {
+	item.Code = normalizeFeedCode(item.Code)
+	if item.Code == "" {
+		return nil, errors.New("code is empty")
+	}
+	item.ID = uuid.New().String()
+	item.Server = strings.TrimSpace(item.Server)
+	item.Timestamp = time.Now().UnixMilli()
+	if item.Source == "" {
+		item.Source = model.PriceSourceManual
+	}
+
+	if err := s.enqueuePending(ctx, item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// ListPending returns queued submissions, oldest first. Entries that waited
+// longer than the feed window would expire on arrival and are discarded.
+func (s *PriceService) ListPending(ctx context.Context, limit int64) ([]model.PriceItem, error) {
+	if limit <= 0 {
+		limit = ModerationDefaultLimit
+	}
+	if limit > ModerationMaxLimit {
+		limit = ModerationMaxLimit
+	}
+	if err := s.prunePending(ctx); err != nil {
+		return nil, err
+	}
+
+	ids, err := s.rdb.ZRange(ctx, keyModerationQueue, 0, limit-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	items := make([]model.PriceItem, 0, len(ids))
+	if len(ids) == 0 {
+		return items, nil
+	}
+	vals, err := s.rdb.HMGet(ctx, keyModerationPending, ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, val := range vals {
+		raw, ok := val.(string)
+		if !ok {
+			continue
+		}
+		var item model.PriceItem
+		if err := json.Unmarshal([]byte(raw), &item); err == nil {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// PendingIDs returns up to limit queued IDs, oldest first.
+func (s *PriceService) PendingIDs(ctx context.Context, limit int64) ([]string, error) {
+	if limit <= 0 || limit > ModerationMaxLimit {
+		limit = ModerationMaxLimit
+	}
+	if err := s.prunePending(ctx); err != nil {
+		return nil, err
+	}
+	return s.rdb.ZRange(ctx, keyModerationQueue, 0, limit-1).Result()
+}
+
+// ApprovePending publishes a queued submission as if it had just been
+// submitted and returns the stored submission. An admin vouched for the
+// price, so it skips the outlier check.
+func (s *PriceService) ApprovePending(ctx context.Context, id string) (*model.PriceItem, error) {
+	item, err := s.takePending(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	approved := *item
+	approved.Flagged, approved.FlagReason = false, ""
+	submission, err := s.addPrice(ctx, approved)
+	if err != nil {
+		// Put it back so the decision can be retried.
+		if qerr := s.enqueuePending(ctx, *item); qerr != nil {
+			return nil, errors.Join(err, qerr)
+		}
+		return nil, err
+	}
+	return submission, nil
+}
+
+// RejectPending discards a queued submission and returns it.
+func (s *PriceService) RejectPending(ctx context.Context, id string) (*model.PriceItem, error) {
+	return s.takePending(ctx, id)
+}
+
+func (s *PriceService) takePending(ctx context.Context, id string) (*model.PriceItem, error) {
+	val, err := takePendingScript.Run(ctx, s.rdb, []string{keyModerationPending, keyModerationQueue}, id).Text()
+	if err == redis.Nil {
+		return nil, ErrPendingNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var item model.PriceItem
+	if err := json.Unmarshal([]byte(val), &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (s *PriceService) enqueuePending(ctx context.Context, item model.PriceItem) error {
+	val, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	pipe := s.rdb.TxPipeline()
+	pipe.HSet(ctx, keyModerationPending, item.ID, val)
+	pipe.ZAdd(ctx, keyModerationQueue, redis.Z{Score: float64(item.Timestamp), Member: item.ID})
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (s *PriceService) prunePending(ctx context.Context) error {
+	cutoff := strconv.FormatInt(time.Now().Add(-s.opts.FeedWindow).UnixMilli(), 10)
+	stale, err := s.rdb.ZRangeByScore(ctx, keyModerationQueue, &redis.ZRangeBy{Min: "-inf", Max: cutoff}).Result()
+	if err != nil || len(stale) == 0 {
+		return err
+	}
+	pipe := s.rdb.TxPipeline()
+	pipe.HDel(ctx, keyModerationPending, stale...)
+	pipe.ZRem(ctx, keyModerationQueue, toInterfaces(stale)...)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func toInterfaces(values []string) []interface{} {
+	out := make([]interface{}, len(values))
+	for i, v := range values {
+		out[i] = v
+	}
+	return out
+}
@@ -0,0 +1,46 @@
+package service
+
+import "testing"
+
+func TestParseModerationMode(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]ModerationMode{
+		"":          ModerationOff,
+		"OFF":       ModerationOff,
+		" guests ":  ModerationGuests,
+		"untrusted": ModerationUntrusted,
+	}
+	for value, want := range cases {
+		got, err := ParseModerationMode(value)
+		if err != nil || got != want {
+			t.Fatalf("%q: expected %q, got %q (%v)", value, want, got, err)
+		}
+	}
+	if _, err := ParseModerationMode("everyone"); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+}
+
+func TestModerationModeHolds(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		mode  ModerationMode
+		guest bool
+		tier  string
+		want  bool
+	}{
+		{ModerationOff, true, TierNew, false},
+		{ModerationGuests, true, TierNew, true},
+		{ModerationGuests, false, TierNew, false},
+		{ModerationUntrusted, false, TierNew, true},
+		{ModerationUntrusted, false, TierRegular, false},
+		{ModerationUntrusted, false, TierTrusted, false},
+	}
+	for _, tc := range cases {
+		if got := tc.mode.Holds(tc.guest, tc.tier); got != tc.want {
+			t.Fatalf("%s guest=%v tier=%s: expected %v, got %v", tc.mode, tc.guest, tc.tier, tc.want, got)
+		}
+	}
+}
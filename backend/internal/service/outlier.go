@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lingbao-market/backend/internal/model"
+	"github.com/redis/go-redis/v9"
+)
+
+// OutlierPolicy decides what happens to a submission whose price is far off
+// the code's history or the market: nothing, a flag, a stop in the moderation
+// queue, or rejection.
+type OutlierPolicy string
+
+const (
+	OutlierOff      OutlierPolicy = "off"
+	OutlierFlag     OutlierPolicy = "flag"
+	OutlierModerate OutlierPolicy = "moderate"
+	OutlierReject   OutlierPolicy = "reject"
+)
+
+func ParseOutlierPolicy(value string) (OutlierPolicy, error) {
+	switch policy := OutlierPolicy(strings.ToLower(strings.TrimSpace(value))); policy {
+	case OutlierOff, OutlierFlag, OutlierModerate, OutlierReject:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown outlier policy %q", value)
+}
+
+// Why a price was flagged.
+const (
+	OutlierReasonHistory = "code_history"
+	OutlierReasonMarket  = "market"
+)
+
+const (
+	// Flagged submission IDs scored by time, for the admin list. IDs whose
+	// submission is gone are pruned when the list is read.
+	keyFlaggedSubmissions = "market:flagged"
+	flaggedMax            = 1000
+
+	// The code's history is judged with the modified z-score over the latest
+	// unflagged price of each other submitter, once there are enough.
+	outlierHistorySample = 50
+	outlierMinHistory    = 3
+	outlierMaxZScore     = 3.5
+	// The spread never counts as less than this share of the median, so
+	// a code that always sold at one price isn't flagged for a small move.
+	outlierMinSpread = 0.05
+
+	// The price is also judged against the live feed with Tukey's far-out
+	// fences, once the feed is big enough.
+	outlierMinMarket = 20
+	outlierFence     = 3.0
+)
+
+var (
+	// ErrPriceOutlier is returned when the reject policy turns a price down.
+	ErrPriceOutlier = errors.New("price is an outlier")
+	// ErrQueuedForReview is returned with the pending copy when the
+	// moderate policy holds a price for review.
+	ErrQueuedForReview = errors.New("submission queued for review")
+)
+
+// detectOutlier returns why a price looks wrong for a code, or an empty
+// reason when it looks fine or there is too little data to tell. The price
+// is judged against both the code's history and the live market.
+func (s *PriceService) detectOutlier(ctx context.Context, code, submitterID string, price float64) (string, error) {
+	history, err := s.outlierHistory(ctx, code, submitterID)
+	if err != nil {
+		return "", err
+	}
+	if len(history) >= outlierMinHistory && historyOutlier(price, history) {
+		return OutlierReasonHistory, nil
+	}
+
+	n, err := s.rdb.ZCard(ctx, keyPriceValue).Result()
+	if err != nil || n < outlierMinMarket {
+		return "", err
+	}
+	pipe := s.rdb.Pipeline()
+	q1 := pipe.ZRangeWithScores(ctx, keyPriceValue, (n-1)/4, (n-1)/4)
+	q3 := pipe.ZRangeWithScores(ctx, keyPriceValue, 3*(n-1)/4, 3*(n-1)/4)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+	if len(q1.Val()) == 0 || len(q3.Val()) == 0 {
+		return "", nil
+	}
+	if fenceOutlier(price, q1.Val()[0].Score, q3.Val()[0].Score) {
+		return OutlierReasonMarket, nil
+	}
+	return "", nil
+}
+
+// outlierHistory returns the prices a code's history vouches for: the
+// latest unflagged price of every other submitter. The submitter's own
+// entries are left out and nobody counts twice, so repeating a price
+// can't make it the norm.
+func (s *PriceService) outlierHistory(ctx context.Context, code, submitterID string) ([]float64, error) {
+	vals, err := s.rdb.ZRevRange(ctx, keyHistoryPrefix+code, 0, outlierHistorySample-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	history := make([]float64, 0, len(vals))
+	seen := make(map[string]bool, len(vals))
+	for _, val := range vals {
+		var item model.PriceItem
+		if err := json.Unmarshal([]byte(val), &item); err != nil || item.Flagged {
+			continue
+		}
+		if item.SubmitterID != "" {
+			if item.SubmitterID == submitterID || seen[item.SubmitterID] {
+				continue
+			}
+			seen[item.SubmitterID] = true
+		}
+		history = append(history, item.Price)
+	}
+	return history, nil
+}
+
+// historyOutlier reports whether price is more than outlierMaxZScore robust
+// standard deviations (1.4826 MADs) from the median of samples.
+func historyOutlier(price float64, samples []float64) bool {
+	sorted := append([]float64(nil), samples...)
+	sort.Float64s(sorted)
+	median := percentile(sorted, 0.5)
+
+	deviations := make([]float64, len(sorted))
+	for i, v := range sorted {
+		deviations[i] = math.Abs(v - median)
+	}
+	sort.Float64s(deviations)
+	spread := 1.4826 * percentile(deviations, 0.5)
+	if floor := outlierMinSpread * math.Abs(median); spread < floor {
+		spread = floor
+	}
+	if spread == 0 {
+		return false
+	}
+	return math.Abs(price-median)/spread > outlierMaxZScore
+}
+
+// fenceOutlier reports whether price lies outside the far-out fences of the
+// quartiles q1 and q3.
+func fenceOutlier(price, q1, q3 float64) bool {
+	iqr := q3 - q1
+	return price < q1-outlierFence*iqr || price > q3+outlierFence*iqr
+}
+
+// flagSubmission queues a flagged submission into the admin list.
+func flagSubmission(ctx context.Context, pipe redis.Pipeliner, sub model.PriceItem) {
+	if !sub.Flagged {
+		return
+	}
+	pipe.ZAdd(ctx, keyFlaggedSubmissions, redis.Z{Score: float64(sub.Timestamp), Member: sub.ID})
+	pipe.ZRemRangeByRank(ctx, keyFlaggedSubmissions, 0, -flaggedMax-1)
+}
+
+// ListFlagged returns live flagged submissions, newest first.
+func (s *PriceService) ListFlagged(ctx context.Context, limit int64) ([]model.PriceItem, error) {
+	if limit <= 0 || limit > flaggedMax {
+		limit = flaggedMax
+	}
+	cutoff := time.Now().Add(-s.opts.FeedWindow).UnixMilli()
+	if err := s.rdb.ZRemRangeByScore(ctx, keyFlaggedSubmissions, "-inf", fmt.Sprintf("(%d", cutoff)).Err(); err != nil {
+		return nil, err
+	}
+	ids, err := s.rdb.ZRevRange(ctx, keyFlaggedSubmissions, 0, limit-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return s.loadIndexedSubmissions(ctx, keyFlaggedSubmissions, ids)
+}
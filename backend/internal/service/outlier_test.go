@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/lingbao-market/backend/internal/model"
+)
+
+func TestHistoryOutlier(t *testing.T) {
+	t.Parallel()
+
+	history := []float64{300, 310, 295, 305, 300}
+	if historyOutlier(320, history) {
+		t.Fatalf("expected 320 to pass against %v", history)
+	}
+	if !historyOutlier(999, history) {
+		t.Fatalf("expected 999 to be flagged against %v", history)
+	}
+	if !historyOutlier(30, history) {
+		t.Fatalf("expected 30 to be flagged against %v", history)
+	}
+
+	// Identical history falls back to the minimum spread.
+	flat := []float64{300, 300, 300}
+	if historyOutlier(330, flat) {
+		t.Fatalf("expected 330 to pass against %v", flat)
+	}
+	if !historyOutlier(400, flat) {
+		t.Fatalf("expected 400 to be flagged against %v", flat)
+	}
+}
+
+func TestFenceOutlier(t *testing.T) {
+	t.Parallel()
+
+	if fenceOutlier(500, 200, 300) {
+		t.Fatal("expected 500 to be inside the fences of [200, 300]")
+	}
+	if !fenceOutlier(700, 200, 300) {
+		t.Fatal("expected 700 to be outside the fences of [200, 300]")
+	}
+}
+
+func TestParseOutlierPolicy(t *testing.T) {
+	t.Parallel()
+
+	for _, value := range []string{"off", "FLAG", " moderate ", "reject"} {
+		if _, err := ParseOutlierPolicy(value); err != nil {
+			t.Fatalf("%q: expected nil error, got %v", value, err)
+		}
+	}
+	if _, err := ParseOutlierPolicy("drop"); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func TestDetectOutlier(t *testing.T) {
+	rdb := testRedis(t)
+	ctx := context.Background()
+	// Seed without outlier checks, so every entry counts as unflagged.
+	seed := NewPriceService(rdb, PriceServiceOptions{Outliers: OutlierOff})
+	add := func(code, submitter string, price float64) {
+		t.Helper()
+		if _, err := seed.AddPrice(ctx, model.PriceItem{Code: code, Price: price, SubmitterID: submitter}); err != nil {
+			t.Fatalf("AddPrice(%s): %v", code, err)
+		}
+	}
+	for i := 0; i < outlierMinMarket; i++ {
+		add(fmt.Sprintf("MKT%03d", i), fmt.Sprintf("user-%d", i), float64(290+i))
+	}
+	for i := 0; i < outlierMinHistory; i++ {
+		add("TROLL1", "troll", 999)
+		add("FAIR01", fmt.Sprintf("user-%d", i), float64(300+5*i))
+		add("RARE01", fmt.Sprintf("user-%d", i), float64(600+5*i))
+	}
+
+	svc := NewPriceService(rdb, PriceServiceOptions{Outliers: OutlierFlag})
+	cases := []struct {
+		code, submitter string
+		price           float64
+		want            string
+	}{
+		// Repeating a price doesn't make it the code's norm.
+		{"TROLL1", "troll", 999, OutlierReasonMarket},
+		{"TROLL1", "someone", 999, OutlierReasonMarket},
+		{"FAIR01", "user-9", 305, ""},
+		{"FAIR01", "user-9", 200, OutlierReasonHistory},
+		// Prices that fit the code's history are still checked against the market.
+		{"RARE01", "user-9", 605, OutlierReasonMarket},
+		{"NEW001", "user-9", 300, ""},
+	}
+	for _, tc := range cases {
+		got, err := svc.detectOutlier(ctx, tc.code, tc.submitter, tc.price)
+		if err != nil || got != tc.want {
+			t.Fatalf("%s by %s at %v: expected %q, got %q (%v)", tc.code, tc.submitter, tc.price, tc.want, got, err)
+		}
+	}
+}
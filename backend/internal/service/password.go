@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/lingbao-market/backend/internal/model"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// Username per outstanding reset token, keyed by the token's SHA-256.
+	keyPasswordResetPrefix = "auth:reset:"
+	// Hash of the outstanding reset token per username, so issuing a new
+	// one voids the last.
+	keyPasswordResetUserPrefix = "auth:reset:user:"
+
+	MinPasswordLength       = 6
+	defaultPasswordResetTTL = time.Hour
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrWeakPassword       = errors.New("password too short")
+	ErrInvalidResetToken  = errors.New("invalid or expired reset token")
+	ErrUserNotFound       = errors.New("user not found")
+)
+
+// ChangePassword sets a new password after checking the current one. Every
+// outstanding token of the user is revoked; the returned pair keeps the
+// caller signed in.
+func (s *AuthService) ChangePassword(ctx context.Context, username, current, next string) (*model.AuthResponse, error) {
+	if len(next) < MinPasswordLength {
+		return nil, ErrWeakPassword
+	}
+	user, err := s.GetUser(ctx, username)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(current)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+	if user.Banned {
+		return nil, ErrAccountBanned
+	}
+
+	if err := s.setPassword(ctx, user, next); err != nil {
+		return nil, err
+	}
+	version, err := s.RevokeTokens(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	return s.issueTokens(ctx, user, version)
+}
+
+// CreatePasswordReset issues a one-time token that sets a new password for
+// username within the reset window. Any earlier reset token of the user is
+// voided, and so are the user's sessions.
+func (s *AuthService) CreatePasswordReset(ctx context.Context, username string) (*model.PasswordReset, error) {
+	if _, err := s.GetUser(ctx, username); err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	hash := hashRefreshToken(token)
+	ttl := s.opts.PasswordResetTTL
+
+	previous, err := s.rdb.Get(ctx, keyPasswordResetUserPrefix+username).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	pipe := s.rdb.TxPipeline()
+	if previous != "" {
+		pipe.Del(ctx, keyPasswordResetPrefix+previous)
+	}
+	pipe.Set(ctx, keyPasswordResetPrefix+hash, username, ttl)
+	pipe.Set(ctx, keyPasswordResetUserPrefix+username, hash, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.RevokeTokens(ctx, username); err != nil {
+		return nil, err
+	}
+	return &model.PasswordReset{
+		Username:  username,
+		Token:     token,
+		ExpiresAt: time.Now().Add(ttl).UnixMilli(),
+	}, nil
+}
+
+// ResetPassword redeems a reset token. The token works once; the user's
+// sessions are revoked again so nothing issued in between survives. It
+// returns the username.
+func (s *AuthService) ResetPassword(ctx context.Context, token, next string) (string, error) {
+	if len(next) < MinPasswordLength {
+		return "", ErrWeakPassword
+	}
+	if token == "" {
+		return "", ErrInvalidResetToken
+	}
+	hash := hashRefreshToken(token)
+
+	username, err := s.rdb.GetDel(ctx, keyPasswordResetPrefix+hash).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrInvalidResetToken
+	}
+	if err != nil {
+		return "", err
+	}
+	_ = s.rdb.Del(ctx, keyPasswordResetUserPrefix+username).Err()
+
+	user, err := s.GetUser(ctx, username)
+	if err != nil {
+		return "", ErrInvalidResetToken
+	}
+	if err := s.setPassword(ctx, user, next); err != nil {
+		return "", err
+	}
+	if _, err := s.RevokeTokens(ctx, username); err != nil {
+		return "", err
+	}
+	return username, nil
+}
+
+func (s *AuthService) setPassword(ctx context.Context, user *model.User, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = string(hash)
+	return s.saveUser(ctx, user)
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lingbao-market/backend/internal/model"
+)
+
+func TestPasswordChecksBeforeStore(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	svc := NewAuthService(nil, "secret", AuthServiceOptions{})
+
+	if _, err := svc.ChangePassword(ctx, "alice", "old-password", "short"); !errors.Is(err, ErrWeakPassword) {
+		t.Fatalf("expected ErrWeakPassword, got %v", err)
+	}
+	if _, err := svc.ResetPassword(ctx, "token", "short"); !errors.Is(err, ErrWeakPassword) {
+		t.Fatalf("expected ErrWeakPassword, got %v", err)
+	}
+	if _, err := svc.ResetPassword(ctx, "", "long-enough"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Fatalf("expected ErrInvalidResetToken, got %v", err)
+	}
+}
+
+func newPasswordTestService(t *testing.T) (*AuthService, *model.AuthResponse) {
+	t.Helper()
+	ctx := context.Background()
+	svc := NewAuthService(testRedis(t), "secret", AuthServiceOptions{})
+	if _, err := svc.CreateUser(ctx, "alice", "old-password", false); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	session, err := svc.Login(ctx, "alice", "old-password")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	return svc, session
+}
+
+// expectRevoked checks that neither token of a session is accepted anymore.
+func expectRevoked(t *testing.T, svc *AuthService, session *model.AuthResponse) {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := svc.Authenticate(ctx, session.Token); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("expected the old access token to be revoked, got %v", err)
+	}
+	if _, err := svc.RefreshTokens(ctx, session.RefreshToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("expected the old refresh token to be revoked, got %v", err)
+	}
+}
+
+func TestChangePasswordRevokesTokens(t *testing.T) {
+	svc, old := newPasswordTestService(t)
+	ctx := context.Background()
+
+	if _, err := svc.ChangePassword(ctx, "alice", "wrong-password", "new-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+	}
+	fresh, err := svc.ChangePassword(ctx, "alice", "old-password", "new-password")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	expectRevoked(t, svc, old)
+	if _, err := svc.Authenticate(ctx, fresh.Token); err != nil {
+		t.Fatalf("expected the new access token to work, got %v", err)
+	}
+	if _, err := svc.Login(ctx, "alice", "old-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected the old password to be rejected, got %v", err)
+	}
+	if _, err := svc.Login(ctx, "alice", "new-password"); err != nil {
+		t.Fatalf("expected the new password to work, got %v", err)
+	}
+}
+
+func TestResetPasswordRevokesTokensOnce(t *testing.T) {
+	svc, old := newPasswordTestService(t)
+	ctx := context.Background()
+
+	voided, err := svc.CreatePasswordReset(ctx, "alice")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	reset, err := svc.CreatePasswordReset(ctx, "alice")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if _, err := svc.ResetPassword(ctx, voided.Token, "new-password"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Fatalf("expected a replaced reset token to be void, got %v", err)
+	}
+
+	username, err := svc.ResetPassword(ctx, reset.Token, "new-password")
+	if err != nil || username != "alice" {
+		t.Fatalf("expected alice, got %q (%v)", username, err)
+	}
+	expectRevoked(t, svc, old)
+
+	if _, err := svc.ResetPassword(ctx, reset.Token, "other-password"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Fatalf("expected the reset token to work only once, got %v", err)
+	}
+	if _, err := svc.Login(ctx, "alice", "new-password"); err != nil {
+		t.Fatalf("expected the new password to work, got %v", err)
+	}
+}
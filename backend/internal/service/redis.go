@@ -3,34 +3,191 @@ package service
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"log"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/lingbao-market/backend/internal/model"
 	"github.com/redis/go-redis/v9"
 )
 
 type PriceService struct {
-	rdb *redis.Client
+	rdb  *redis.Client
+	opts PriceServiceOptions
+	hub  *feedHub
+
+	// sideEffectFailures counts submissions whose history, statistics or
+	// reputation updates were lost after the feed write succeeded.
+	sideEffectFailures atomic.Int64
+}
+
+type PriceServiceOptions struct {
+	// HistoryRetention is how long per-code price history is kept. It is
+	// independent of the daily feed reset.
+	HistoryRetention time.Duration
+	// ArchiveRetention is how long archived market days and hourly
+	// statistics are kept.
+	ArchiveRetention time.Duration
+	// MarketDay places the daily reset.
+	MarketDay MarketDay
+	// FeedWindow is how long an entry stays in the feed after its last
+	// submission.
+	FeedWindow time.Duration
+	// FeedMaxSize caps the number of live entries; the oldest are dropped
+	// first.
+	FeedMaxSize int64
+	// DisputeThreshold is the number of disputes that hides a code until an
+	// admin reviews it.
+	DisputeThreshold int64
+	// Reputation places the submitter tiers.
+	Reputation ReputationOptions
+	// Moderation picks the submissions that wait for review.
+	Moderation ModerationMode
+	// Outliers decides what happens to prices far off the norm.
+	Outliers OutlierPolicy
+	// IdempotencyWindow is how long the response to an Idempotency-Key is
+	// replayed.
+	IdempotencyWindow time.Duration
+}
+
+func NewPriceService(rdb *redis.Client, opts PriceServiceOptions) *PriceService {
+	if opts.HistoryRetention <= 0 {
+		opts.HistoryRetention = defaultHistoryRetention
+	}
+	if opts.ArchiveRetention <= 0 {
+		opts.ArchiveRetention = defaultArchiveRetention
+	}
+	if opts.FeedWindow <= 0 {
+		opts.FeedWindow = defaultFeedWindow
+	}
+	if opts.FeedMaxSize <= 0 {
+		opts.FeedMaxSize = defaultFeedMaxSize
+	}
+	if opts.DisputeThreshold <= 0 {
+		opts.DisputeThreshold = defaultDisputeThreshold
+	}
+	opts.Reputation = opts.Reputation.withDefaults()
+	if opts.Moderation == "" {
+		opts.Moderation = ModerationOff
+	}
+	if opts.Outliers == "" {
+		opts.Outliers = OutlierFlag
+	}
+	if opts.IdempotencyWindow <= 0 {
+		opts.IdempotencyWindow = defaultIdempotencyWindow
+	}
+	return &PriceService{rdb: rdb, opts: opts, hub: newFeedHub()}
+}
+
+// MarketDay returns the daily reset the service was configured with.
+func (s *PriceService) MarketDay() MarketDay {
+	return s.opts.MarketDay
+}
+
+// SideEffectFailures reports how many submissions since start had their
+// history, statistics or reputation updates lost.
+func (s *PriceService) SideEffectFailures() int64 {
+	return s.sideEffectFailures.Load()
 }
 
-func NewPriceService(rdb *redis.Client) *PriceService {
-	return &PriceService{rdb: rdb}
+// Moderation returns the moderation mode the service was configured with.
+func (s *PriceService) Moderation() ModerationMode {
+	return s.opts.Moderation
 }
 
 const (
 	keyPriceTime  = "market:feed:time"
 	keyPriceValue = "market:feed:price"
+
+	// Secondary indexes for feed filters: every live code at score 0 (prefix
+	// lookups), the set of known servers, and per-server time/price sets.
+	keyFeedCodes        = "market:feed:codes"
+	keyFeedServers      = "market:feed:servers"
+	keyServerFeedPrefix = "market:feed:server:"
+	// Every live code scored by its confirmations, for sort=confirmed.
+	keyFeedConfirmed = "market:feed:confirmed"
+	// Codes hidden by disputes, scored by their last submission so they
+	// still expire. Hidden codes are in no other feed index.
+	keyFeedHidden = "market:feed:hidden"
+
+	// Entries older than the feed window drop out of the feed.
+	defaultFeedWindow = 24 * time.Hour
+
+	// Canonical per-code record; the feed sorted sets index the bare code.
+	keyCodePrefix = "market:code:"
+	// Hash of submission ID -> JSON submission, one per code.
+	keyCodeSubmissionsSuffix = ":submissions"
+	// Hash of submission ID -> code, for lookups by ID.
+	keySubmissionIndex = "market:submissions"
+	// Hash of vote tallies plus voter:<id> -> vote, one per code.
+	keyCodeVotesSuffix = ":votes"
+
+	addPriceMaxRetries = 5
+	// Most codes a single script run trims.
+	feedTrimBatch = 100
+	// Most submissions kept per live code. The record keeps counting past
+	// it; only the individual submissions go, oldest first.
+	codeSubmissionsMax = 100
+
+	defaultFeedMaxSize = 10000
 )
 
+var ErrSubmissionNotFound = errors.New("submission not found")
+
+// ClearAllPrices wipes the feed. With a fence in ctx the wipe is skipped
+// with ErrFenced once the fencing lock has changed hands.
 func (s *PriceService) ClearAllPrices(ctx context.Context) (int64, int64, error) {
-	pipe := s.rdb.TxPipeline()
-	timeCount := pipe.ZCard(ctx, keyPriceTime)
-	priceCount := pipe.ZCard(ctx, keyPriceValue)
-	pipe.Del(ctx, keyPriceTime, keyPriceValue)
+	codes, err := s.indexedCodes(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	hidden, err := s.rdb.ZRange(ctx, keyFeedHidden, 0, -1).Result()
+	if err != nil {
+		return 0, 0, err
+	}
+	codes = append(codes, hidden...)
+	servers, err := s.rdb.SMembers(ctx, keyFeedServers).Result()
+	if err != nil {
+		return 0, 0, err
+	}
 
-	_, err := pipe.Exec(ctx)
+	fence, fenced := fenceFromContext(ctx)
+	var watched []string
+	if fenced {
+		watched = append(watched, fence.Key)
+	}
+	var timeCount, priceCount *redis.IntCmd
+	txf := func(tx *redis.Tx) error {
+		if fenced {
+			if err := checkFence(ctx, tx, fence); err != nil {
+				return err
+			}
+		}
+		_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			timeCount = pipe.ZCard(ctx, keyPriceTime)
+			priceCount = pipe.ZCard(ctx, keyPriceValue)
+			pipe.Del(ctx, keyPriceTime, keyPriceValue, keySubmissionIndex, keyFeedCodes, keyFeedServers, keyFeedConfirmed, keyFeedHidden)
+			for _, server := range servers {
+				pipe.Del(ctx, serverFeedKey(server, "time"), serverFeedKey(server, "price"))
+			}
+			if len(codes) > 0 {
+				pipe.Del(ctx, codeRecordKeys(codes)...)
+				pipe.Del(ctx, codeSubmissionKeys(codes)...)
+				pipe.Del(ctx, codeVoteKeys(codes)...)
+			}
+			return nil
+		})
+		return err
+	}
+	err = s.rdb.Watch(ctx, txf, watched...)
+	if errors.Is(err, redis.TxFailedErr) {
+		// The fence key changed between the check and EXEC.
+		return 0, 0, ErrFenced
+	}
 	if err != nil {
 		return 0, 0, err
 	}
@@ -38,154 +195,852 @@ func (s *PriceService) ClearAllPrices(ctx context.Context) (int64, int64, error)
 	return timeCount.Val(), priceCount.Val(), nil
 }
 
-func (s *PriceService) AddPrice(ctx context.Context, item model.PriceItem) error {
-	item.Timestamp = time.Now().UnixMilli()
-	val, err := json.Marshal(item)
-	if err != nil {
-		return err
-	}
+// feedScriptPrelude is shared by the scripts that change the feed indexes.
+// It expects KEYS to start with the submission index, time, price, codes,
+// servers, confirmed and hidden keys and ARGV with the code key prefix,
+// submissions and votes key suffixes and server feed key prefix. It defines
+// unindex, which takes a code out of the visible feed, and drop, which
+// removes codes from every index and deletes their records. Dropped codes are
+// collected in removed.
+//
+// Every code in the time index is also in the price index and vice versa,
+// so trimming by time keeps both sorts in agreement.
+//
+// The scripts build the keys of the codes they drop and of the per-server
+// indexes from these prefixes, since those are only known once the script
+// runs; they can't all be declared in KEYS. That needs a single Redis node,
+// not Redis Cluster, which main refuses to start against.
+const feedScriptPrelude = `
+local indexKey, timeKey, priceKey, codesKey, serversKey = KEYS[1], KEYS[2], KEYS[3], KEYS[4], KEYS[5]
+local confirmedKey, hiddenKey = KEYS[6], KEYS[7]
+local codePrefix, subsSuffix, votesSuffix, serverPrefix = ARGV[1], ARGV[2], ARGV[3], ARGV[4]
+local function serverKey(name, sort)
+	return serverPrefix .. name .. ':' .. sort
+end
 
-	// Pipeline for atomicity
-	pipe := s.rdb.Pipeline()
+local function unindex(code, servers)
+	redis.call('ZREM', timeKey, code)
+	redis.call('ZREM', priceKey, code)
+	redis.call('ZREM', codesKey, code)
+	redis.call('ZREM', confirmedKey, code)
+	for _, name in ipairs(servers) do
+		redis.call('ZREM', serverKey(name, 'time'), code)
+		redis.call('ZREM', serverKey(name, 'price'), code)
+	end
+end
 
-	// 1. Index by Time (Latest first)
-	pipe.ZAdd(ctx, keyPriceTime, redis.Z{
-		Score:  float64(item.Timestamp),
-		Member: val,
-	})
+local removed = {}
+local function drop(codes)
+	if #codes == 0 then
+		return
+	end
+	local servers = redis.call('SMEMBERS', serversKey)
+	for _, victim in ipairs(codes) do
+		unindex(victim, servers)
+		redis.call('ZREM', hiddenKey, victim)
+		local subsKey = codePrefix .. victim .. subsSuffix
+		local ids = redis.call('HKEYS', subsKey)
+		for i = 1, #ids, 500 do
+			redis.call('HDEL', indexKey, unpack(ids, i, math.min(i + 499, #ids)))
+		end
+		redis.call('DEL', codePrefix .. victim, subsKey, codePrefix .. victim .. votesSuffix)
+		removed[#removed + 1] = victim
+	end
+end
+`
 
-	// 2. Index by Price (Highest first)
-	// Note: In a real prod system, we might want unique members per code to update prices,
-	// but here we are storing a stream of submissions.
-	pipe.ZAdd(ctx, keyPriceValue, redis.Z{
-		Score:  float64(item.Price),
-		Member: val,
-	})
+// addPriceScript writes a merged record and indexes it in one step, then
+// trims the feed and the code's submissions, which keep to the feed window
+// and the newest ARGV[18]. The record is only written if it still equals the
+// value the merge was based on (ARGV[5], empty for a new code); otherwise -1
+// is returned and the caller merges again. A fenced write (KEYS[10] set)
+// returns -2 once the fence key no longer holds the token. On success it
+// returns whether the code is hidden, as 0 or 1, and the trimmed codes.
+//
+// KEYS: prelude keys, record, submissions, fence
+// ARGV: prelude args, expected record, record, submission ID, submission,
+// code, server, previous server, ts, price, trim cutoff, max feed size, trim
+// batch size, fence token, max submissions per code
+var addPriceScript = redis.NewScript(feedScriptPrelude + `
+local recordKey, subsKey, fenceKey = KEYS[8], KEYS[9], KEYS[10]
+if fenceKey ~= '' and redis.call('GET', fenceKey) ~= ARGV[17] then
+	return -2
+end
+local current = redis.call('GET', recordKey)
+if (current or '') ~= ARGV[5] then
+	return -1
+end
+
+local id, code, server, previous = ARGV[7], ARGV[9], ARGV[10], ARGV[11]
+local ts, price = ARGV[12], ARGV[13]
+
+redis.call('SET', recordKey, ARGV[6])
+redis.call('HSET', subsKey, id, ARGV[8])
+redis.call('HSET', indexKey, id, code)
+
+local cutoff, maxSubs = tonumber(ARGV[14]), tonumber(ARGV[18])
+local subs = redis.call('HGETALL', subsKey)
+local kept, stale = {}, {}
+for i = 1, #subs, 2 do
+	local ok, sub = pcall(cjson.decode, subs[i + 1])
+	local subTs = ok and tonumber(sub.ts) or 0
+	if subs[i] ~= id and subTs <= cutoff then
+		stale[#stale + 1] = subs[i]
+	else
+		kept[#kept + 1] = {subs[i], subTs}
+	end
+end
+if #kept > maxSubs then
+	table.sort(kept, function(a, b) return a[2] > b[2] end)
+	for i = maxSubs + 1, #kept do
+		stale[#stale + 1] = kept[i][1]
+	end
+end
+for i = 1, #stale, 500 do
+	local last = math.min(i + 499, #stale)
+	redis.call('HDEL', subsKey, unpack(stale, i, last))
+	redis.call('HDEL', indexKey, unpack(stale, i, last))
+end
+if previous ~= '' and previous ~= server then
+	redis.call('ZREM', serverKey(previous, 'time'), code)
+	redis.call('ZREM', serverKey(previous, 'price'), code)
+end
+local hidden = 0
+if redis.call('ZSCORE', hiddenKey, code) then
+	-- A hidden code stays out of the feed until reviewed but keeps aging.
+	redis.call('ZADD', hiddenKey, ts, code)
+	hidden = 1
+else
+	redis.call('ZADD', timeKey, ts, code)
+	redis.call('ZADD', priceKey, price, code)
+	redis.call('ZADD', codesKey, 0, code)
+	redis.call('ZADD', confirmedKey, 'NX', 0, code)
+	if server ~= '' then
+		redis.call('SADD', serversKey, server)
+		redis.call('ZADD', serverKey(server, 'time'), ts, code)
+		redis.call('ZADD', serverKey(server, 'price'), price, code)
+	end
+end
+
+local batch = tonumber(ARGV[16])
+drop(redis.call('ZRANGEBYSCORE', timeKey, '-inf', ARGV[14], 'LIMIT', 0, batch))
+drop(redis.call('ZRANGEBYSCORE', hiddenKey, '-inf', ARGV[14], 'LIMIT', 0, batch))
+local maxSize = tonumber(ARGV[15])
+if maxSize > 0 then
+	local excess = redis.call('ZCARD', timeKey) - maxSize
+	if excess > batch then
+		excess = batch
+	end
+	if excess > 0 then
+		drop(redis.call('ZRANGE', timeKey, 0, excess - 1))
+	end
+end
+return {hidden, removed}
+`)
 
-	// Cleanup old data (older than 24h) from Time index
-	cutoff := time.Now().Add(-24 * time.Hour).UnixMilli()
-	pipe.ZRemRangeByScore(ctx, keyPriceTime, "-inf", fmt.Sprintf("%d", cutoff))
+// expireFeedScript drops up to ARGV[6] visible and ARGV[6] hidden codes
+// last updated at or before ARGV[5] and returns them.
+var expireFeedScript = redis.NewScript(feedScriptPrelude + `
+drop(redis.call('ZRANGEBYSCORE', timeKey, '-inf', ARGV[5], 'LIMIT', 0, tonumber(ARGV[6])))
+drop(redis.call('ZRANGEBYSCORE', hiddenKey, '-inf', ARGV[5], 'LIMIT', 0, tonumber(ARGV[6])))
+return removed
+`)
 
-	_, err = pipe.Exec(ctx)
-	return err
+func feedScriptKeys(extra ...string) []string {
+	return append([]string{
+		keySubmissionIndex, keyPriceTime, keyPriceValue, keyFeedCodes, keyFeedServers, keyFeedConfirmed, keyFeedHidden,
+	}, extra...)
 }
 
-func (s *PriceService) CleanupExpired(ctx context.Context, cutoff time.Time) (int64, int64, error) {
-	cutoffMillis := cutoff.UnixMilli()
+func feedScriptArgs(extra ...interface{}) []interface{} {
+	return append([]interface{}{keyCodePrefix, keyCodeSubmissionsSuffix, keyCodeVotesSuffix, keyServerFeedPrefix}, extra...)
+}
 
-	removedTime, err := s.rdb.ZRemRangeByScore(ctx, keyPriceTime, "-inf", fmt.Sprintf("%d", cutoffMillis)).Result()
-	if err != nil {
-		return 0, 0, err
+// AddPrice records a submission and folds it into the live entry for its
+// code. The stored submission, including its new ID, is returned.
+//
+// Prices that look like outliers are handled by the outlier policy: flagged,
+// queued for review (the pending copy is returned with ErrQueuedForReview)
+// or rejected with ErrPriceOutlier.
+func (s *PriceService) AddPrice(ctx context.Context, item model.PriceItem) (*model.PriceItem, error) {
+	item.Code = normalizeFeedCode(item.Code)
+	if item.Code == "" {
+		return nil, errors.New("code is empty")
 	}
-
-	var removedPrice int64
-	var cursor uint64
-	for {
-		vals, nextCursor, err := s.rdb.ZScan(ctx, keyPriceValue, cursor, "*", 200).Result()
+	item.Flagged, item.FlagReason = false, ""
+	if s.opts.Outliers != OutlierOff {
+		reason, err := s.detectOutlier(ctx, item.Code, item.SubmitterID, item.Price)
 		if err != nil {
-			return removedTime, removedPrice, err
+			return nil, err
 		}
-
-		var toRemove []interface{}
-		for i := 0; i < len(vals); i += 2 {
-			member := vals[i]
-			var item model.PriceItem
-			if err := json.Unmarshal([]byte(member), &item); err != nil {
-				continue
+		if reason != "" {
+			if s.opts.Outliers == OutlierReject {
+				return nil, ErrPriceOutlier
 			}
-			if item.Timestamp > 0 && item.Timestamp < cutoffMillis {
-				toRemove = append(toRemove, member)
+			item.Flagged, item.FlagReason = true, reason
+			if s.opts.Outliers == OutlierModerate {
+				pending, err := s.QueueSubmission(ctx, item)
+				if err != nil {
+					return nil, err
+				}
+				return pending, ErrQueuedForReview
 			}
 		}
+	}
+	return s.addPrice(ctx, item)
+}
 
-		if len(toRemove) > 0 {
-			removed, err := s.rdb.ZRem(ctx, keyPriceValue, toRemove...).Result()
-			if err != nil {
-				return removedTime, removedPrice, err
+func (s *PriceService) addPrice(ctx context.Context, item model.PriceItem) (*model.PriceItem, error) {
+	submission := model.PriceItem{
+		ID:        uuid.New().String(),
+		Code:      item.Code,
+		Price:     item.Price,
+		Server:    strings.TrimSpace(item.Server),
+		Source:    item.Source,
+		Timestamp: time.Now().UnixMilli(),
+
+		SubmitterID:   strings.TrimSpace(item.SubmitterID),
+		SubmitterName: strings.TrimSpace(item.SubmitterName),
+		Flagged:       item.Flagged,
+		FlagReason:    item.FlagReason,
+	}
+	if submission.Source == "" {
+		submission.Source = model.PriceSourceManual
+	}
+	submissionVal, err := json.Marshal(submission)
+	if err != nil {
+		return nil, err
+	}
+	recordKey := keyCodePrefix + item.Code
+	fenceKey, fenceToken := fenceScriptArgs(ctx)
+	keys := feedScriptKeys(recordKey, recordKey+keyCodeSubmissionsSuffix, fenceKey)
+
+	var record model.PriceItem
+	var trimmed []interface{}
+	written, hidden := false, false
+	// The script only writes if the record is still the one merged into, so
+	// concurrent re-submissions of the same code don't lose counts.
+	for i := 0; i < addPriceMaxRetries && !written; i++ {
+		current, err := s.rdb.Get(ctx, recordKey).Result()
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+		var existing *model.PriceItem
+		if current != "" {
+			var prev model.PriceItem
+			if err := json.Unmarshal([]byte(current), &prev); err != nil {
+				return nil, err
 			}
-			removedPrice += removed
+			existing = &prev
+		}
+
+		record = mergeSubmission(existing, submission)
+		val, err := json.Marshal(record)
+		if err != nil {
+			return nil, err
+		}
+		previousServer := ""
+		if existing != nil {
+			previousServer = strings.TrimSpace(existing.Server)
+		}
+
+		res, err := addPriceScript.Run(ctx, s.rdb, keys, feedScriptArgs(
+			current,
+			val,
+			submission.ID,
+			submissionVal,
+			submission.Code,
+			submission.Server,
+			previousServer,
+			submission.Timestamp,
+			submission.Price,
+			time.Now().Add(-s.opts.FeedWindow).UnixMilli(),
+			s.opts.FeedMaxSize,
+			feedTrimBatch,
+			fenceToken,
+			codeSubmissionsMax,
+		)...).Result()
+		if err != nil {
+			return nil, err
+		}
+		if code, ok := res.(int64); ok && code == -2 {
+			return nil, ErrFenced
+		}
+		if reply, ok := res.([]interface{}); ok && len(reply) == 2 {
+			flag, _ := reply[0].(int64)
+			hidden = flag == 1
+			trimmed, _ = reply[1].([]interface{})
+			written = true
+		}
+	}
+	if !written {
+		return nil, redis.TxFailedErr
+	}
+
+	// History and statistics are append-only aggregates and don't have to
+	// land atomically with the feed. Failures are counted, not retried.
+	pipe := s.rdb.TxPipeline()
+	s.appendHistory(ctx, pipe, submissionVal, submission)
+	s.recordStats(ctx, pipe, submission)
+	s.indexSubmitter(ctx, pipe, submission)
+	s.creditSubmission(ctx, pipe, submission)
+	flagSubmission(ctx, pipe, submission)
+	if _, err := pipe.Exec(ctx); err != nil {
+		failures := s.sideEffectFailures.Add(1)
+		log.Printf("Recording side effects of %s failed (%d since start): %v", submission.Code, failures, err)
+	}
+
+	for _, code := range trimmed {
+		if code, ok := code.(string); ok && code != record.Code {
+			s.publishFeedEvent(ctx, model.FeedEvent{Type: model.FeedEventDeletion, Code: code})
 		}
+	}
+	if !hidden {
+		s.publishFeedEvent(ctx, model.FeedEvent{
+			Type: model.FeedEventSubmission,
+			Code: record.Code,
+			Item: &record,
+		})
+	}
+	return &submission, nil
+}
 
-		cursor = nextCursor
-		if cursor == 0 {
-			break
+func (s *PriceService) watchRetry(ctx context.Context, txf func(*redis.Tx) error, keys ...string) error {
+	for i := 0; i < addPriceMaxRetries; i++ {
+		err := s.rdb.Watch(ctx, txf, keys...)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
 		}
 	}
+	return redis.TxFailedErr
+}
 
-	return removedTime, removedPrice, nil
+// CleanupExpired archives and then drops every entry last updated at or
+// before cutoff. Each removed code is reported as a deletion event. Entries
+// that can't be archived stay in the feed.
+func (s *PriceService) CleanupExpired(ctx context.Context, cutoff time.Time) (int64, int64, error) {
+	var removed int64
+	for {
+		if err := s.archiveExpiring(ctx, cutoff); err != nil {
+			return removed, removed, err
+		}
+		res, err := expireFeedScript.Run(ctx, s.rdb, feedScriptKeys(), feedScriptArgs(
+			cutoff.UnixMilli(),
+			feedTrimBatch,
+		)...).StringSlice()
+		if err != nil {
+			return removed, removed, err
+		}
+		for _, code := range res {
+			s.publishFeedEvent(ctx, model.FeedEvent{Type: model.FeedEventDeletion, Code: code})
+		}
+		removed += int64(len(res))
+		if len(res) < feedTrimBatch {
+			// Time and price always hold the same codes.
+			return removed, removed, nil
+		}
+	}
 }
 
+// DeletePricesByCode removes a code and everything submitted for it. Its
+// registered submitters lose reputation.
 func (s *PriceService) DeletePricesByCode(ctx context.Context, code string) (int64, int64, error) {
-	removedTime, err := s.removeByCode(ctx, keyPriceTime, code)
+	return s.deletePricesByCode(ctx, code, reputationDeletions)
+}
+
+// DeleteReportedCode is DeletePricesByCode for a code removed after a
+// feedback report, which costs its submitters more reputation.
+func (s *PriceService) DeleteReportedCode(ctx context.Context, code string) (int64, int64, error) {
+	return s.deletePricesByCode(ctx, code, reputationReports)
+}
+
+func (s *PriceService) deletePricesByCode(ctx context.Context, code, penalty string) (int64, int64, error) {
+	code = normalizeFeedCode(code)
+	if code == "" {
+		return 0, 0, nil
+	}
+
+	record, err := loadCodeRecord(ctx, s.rdb, code)
+	if err != nil {
+		return 0, 0, err
+	}
+	submitters, err := codeSubmitters(ctx, s.rdb, code)
 	if err != nil {
 		return 0, 0, err
 	}
-	removedPrice, err := s.removeByCode(ctx, keyPriceValue, code)
+	ids, err := s.submissionIDs(ctx, []string{code})
 	if err != nil {
-		return removedTime, 0, err
+		return 0, 0, err
+	}
+	servers, err := s.rdb.SMembers(ctx, keyFeedServers).Result()
+	if err != nil {
+		return 0, 0, err
 	}
-	return removedTime, removedPrice, nil
+
+	pipe := s.rdb.TxPipeline()
+	removedTime, removedPrice := unindexCodes(ctx, pipe, servers, []interface{}{code})
+	pipe.Del(ctx, keyCodePrefix+code, keyCodePrefix+code+keyCodeSubmissionsSuffix, keyCodePrefix+code+keyCodeVotesSuffix)
+	if len(ids) > 0 {
+		pipe.HDel(ctx, keySubmissionIndex, ids...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, 0, err
+	}
+
+	s.creditSubmitters(ctx, submitters, "", penalty, 1)
+	if record != nil || removedTime.Val()+removedPrice.Val() > 0 {
+		s.publishFeedEvent(ctx, model.FeedEvent{
+			Type: model.FeedEventDeletion,
+			Code: code,
+			Item: record,
+		})
+	}
+	return removedTime.Val(), removedPrice.Val(), nil
 }
 
-func (s *PriceService) removeByCode(ctx context.Context, key, code string) (int64, error) {
-	var removedTotal int64
-	var cursor uint64
-	for {
-		vals, nextCursor, err := s.rdb.ZScan(ctx, key, cursor, "*", 200).Result()
-		if err != nil {
-			return removedTotal, err
+// GetSubmission returns a single submission by ID.
+func (s *PriceService) GetSubmission(ctx context.Context, id string) (*model.PriceItem, error) {
+	code, err := s.rdb.HGet(ctx, keySubmissionIndex, id).Result()
+	if err == redis.Nil {
+		return nil, ErrSubmissionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	val, err := s.rdb.HGet(ctx, keyCodePrefix+code+keyCodeSubmissionsSuffix, id).Result()
+	if err == redis.Nil {
+		return nil, ErrSubmissionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var item model.PriceItem
+	if err := json.Unmarshal([]byte(val), &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// UpdateSubmission changes the price and/or server of one submission and
+// rebuilds the live entry of its code. Nil fields are left untouched.
+func (s *PriceService) UpdateSubmission(ctx context.Context, id string, price *float64, server *string) (*model.PriceItem, error) {
+	return s.updateSubmission(ctx, "", id, price, server)
+}
+
+// UpdateSubmissionAs is UpdateSubmission on behalf of a submitter; other
+// submitters' entries are reported as not found.
+func (s *PriceService) UpdateSubmissionAs(ctx context.Context, submitterID, id string, price *float64, server *string) (*model.PriceItem, error) {
+	if submitterID == "" {
+		return nil, ErrSubmissionNotFound
+	}
+	return s.updateSubmission(ctx, submitterID, id, price, server)
+}
+
+func (s *PriceService) updateSubmission(ctx context.Context, owner, id string, price *float64, server *string) (*model.PriceItem, error) {
+	current, err := s.GetSubmission(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var updated model.PriceItem
+	err = s.rewriteCode(ctx, current.Code, func(subs map[string]model.PriceItem) error {
+		sub, ok := subs[id]
+		if !ok || (owner != "" && sub.SubmitterID != owner) {
+			return ErrSubmissionNotFound
+		}
+		if price != nil {
+			sub.Price = *price
+		}
+		if server != nil {
+			sub.Server = strings.TrimSpace(*server)
+		}
+		subs[id] = sub
+		updated = sub
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.replaceHistory(ctx, *current, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// DeleteSubmission removes one submission. When it was the last submission of
+// its code, the code disappears from the feed.
+func (s *PriceService) DeleteSubmission(ctx context.Context, id string) (*model.PriceItem, error) {
+	return s.deleteSubmission(ctx, "", id)
+}
+
+// DeleteSubmissionAs is DeleteSubmission on behalf of a submitter; other
+// submitters' entries are reported as not found.
+func (s *PriceService) DeleteSubmissionAs(ctx context.Context, submitterID, id string) (*model.PriceItem, error) {
+	if submitterID == "" {
+		return nil, ErrSubmissionNotFound
+	}
+	return s.deleteSubmission(ctx, submitterID, id)
+}
+
+func (s *PriceService) deleteSubmission(ctx context.Context, owner, id string) (*model.PriceItem, error) {
+	current, err := s.GetSubmission(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed model.PriceItem
+	err = s.rewriteCode(ctx, current.Code, func(subs map[string]model.PriceItem) error {
+		sub, ok := subs[id]
+		if !ok || (owner != "" && sub.SubmitterID != owner) {
+			return ErrSubmissionNotFound
 		}
+		removed = sub
+		delete(subs, id)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.replaceHistory(ctx, removed, nil); err != nil {
+		return nil, err
+	}
+	return &removed, nil
+}
 
-		var toRemove []interface{}
-		for i := 0; i < len(vals); i += 2 {
-			member := vals[i]
-			var item model.PriceItem
-			if err := json.Unmarshal([]byte(member), &item); err != nil {
+// rewriteCode loads every submission of a code, lets apply modify the set and
+// writes the submissions plus the rebuilt live entry back atomically.
+func (s *PriceService) rewriteCode(ctx context.Context, code string, apply func(map[string]model.PriceItem) error) error {
+	recordKey := keyCodePrefix + code
+	subsKey := recordKey + keyCodeSubmissionsSuffix
+
+	var event model.FeedEvent
+	txf := func(tx *redis.Tx) error {
+		existing, err := loadCodeRecord(ctx, tx, code)
+		if err != nil {
+			return err
+		}
+		hidden, err := isHidden(ctx, tx, code)
+		if err != nil {
+			return err
+		}
+		raw, err := tx.HGetAll(ctx, subsKey).Result()
+		if err != nil {
+			return err
+		}
+		subs := make(map[string]model.PriceItem, len(raw))
+		for id, val := range raw {
+			var sub model.PriceItem
+			if err := json.Unmarshal([]byte(val), &sub); err != nil {
 				continue
 			}
-			if strings.EqualFold(item.Code, code) {
-				toRemove = append(toRemove, member)
+			subs[id] = sub
+		}
+
+		before := make([]string, 0, len(subs))
+		for id := range subs {
+			before = append(before, id)
+		}
+		if err := apply(subs); err != nil {
+			return err
+		}
+
+		var removed []string
+		for _, id := range before {
+			if _, ok := subs[id]; !ok {
+				removed = append(removed, id)
 			}
 		}
 
-		if len(toRemove) > 0 {
-			removed, err := s.rdb.ZRem(ctx, key, toRemove...).Result()
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if len(removed) > 0 {
+				pipe.HDel(ctx, subsKey, removed...)
+				pipe.HDel(ctx, keySubmissionIndex, removed...)
+			}
+
+			previousServer := ""
+			if existing != nil {
+				previousServer = strings.TrimSpace(existing.Server)
+			}
+
+			record, ok := buildCodeRecord(subs)
+			if !ok || record.Timestamp <= time.Now().Add(-s.opts.FeedWindow).UnixMilli() {
+				// What is left has expired; drop it the way AddPrice trims.
+				event = model.FeedEvent{Type: model.FeedEventDeletion, Code: code, Item: existing}
+				if len(subs) > 0 {
+					remaining := make([]string, 0, len(subs))
+					for id := range subs {
+						remaining = append(remaining, id)
+					}
+					pipe.HDel(ctx, keySubmissionIndex, remaining...)
+				}
+				pipe.Del(ctx, recordKey, subsKey, recordKey+keyCodeVotesSuffix)
+				var servers []string
+				if previousServer != "" {
+					servers = []string{previousServer}
+				}
+				unindexCodes(ctx, pipe, servers, []interface{}{code})
+				return nil
+			}
+
+			for id, sub := range subs {
+				val, err := json.Marshal(sub)
+				if err != nil {
+					return err
+				}
+				pipe.HSet(ctx, subsKey, id, val)
+			}
+			val, err := json.Marshal(record)
 			if err != nil {
-				return removedTotal, err
+				return err
 			}
-			removedTotal += removed
-		}
+			pipe.Set(ctx, recordKey, val, 0)
+			if hidden {
+				// Edits don't bring a hidden code back; only a review does.
+				pipe.ZAdd(ctx, keyFeedHidden, redis.Z{Score: float64(record.Timestamp), Member: code})
+				event = model.FeedEvent{}
+				return nil
+			}
+			indexRecord(ctx, pipe, record, previousServer)
+			event = model.FeedEvent{Type: model.FeedEventUpdate, Code: code, Item: &record}
+			return nil
+		})
+		return err
+	}
 
-		cursor = nextCursor
-		if cursor == 0 {
-			break
-		}
+	if err := s.watchRetry(ctx, txf, recordKey, subsKey, keyFeedHidden); err != nil {
+		return err
+	}
+	if event.Type != "" {
+		s.publishFeedEvent(ctx, event)
 	}
-	return removedTotal, nil
+	return nil
 }
 
-// GetLatestFeed returns items sorted by the requested criteria
-func (s *PriceService) GetLatestFeed(ctx context.Context, limit int64, sortBy string) ([]model.PriceItem, error) {
-	var key string
-	switch sortBy {
-	case "price":
-		key = keyPriceValue
-	default: // "time"
-		key = keyPriceTime
+// GetCode returns the live record for a single code.
+func (s *PriceService) GetCode(ctx context.Context, code string) (*model.PriceItem, error) {
+	return loadCodeRecord(ctx, s.rdb, normalizeFeedCode(code))
+}
+
+func (s *PriceService) loadCodeRecords(ctx context.Context, codes []string) ([]model.PriceItem, error) {
+	if len(codes) == 0 {
+		return nil, nil
 	}
 
-	// ZREVRANGE 0 to limit-1 (Highest Score first: Latest Time OR Highest Price)
-	vals, err := s.rdb.ZRevRange(ctx, key, 0, limit-1).Result()
-	if err != nil {
+	pipe := s.rdb.Pipeline()
+	records := pipe.MGet(ctx, codeRecordKeys(codes)...)
+	votes := make([]*redis.SliceCmd, len(codes))
+	for i, key := range codeVoteKeys(codes) {
+		votes[i] = pipe.HMGet(ctx, key, VoteConfirm, VoteDispute)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
 		return nil, err
 	}
 
 	var items []model.PriceItem
-	for _, val := range vals {
+	for i, val := range records.Val() {
+		raw, ok := val.(string)
+		if !ok {
+			continue
+		}
 		var item model.PriceItem
-		if err := json.Unmarshal([]byte(val), &item); err == nil {
+		if err := json.Unmarshal([]byte(raw), &item); err == nil {
+			item.Confirmations, item.Disputes = voteCounts(votes[i].Val())
 			items = append(items, item)
 		}
 	}
 	return items, nil
 }
+
+func (s *PriceService) indexedCodes(ctx context.Context) ([]string, error) {
+	byTime, err := s.rdb.ZRange(ctx, keyPriceTime, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	byPrice, err := s.rdb.ZRange(ctx, keyPriceValue, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{}, len(byTime)+len(byPrice))
+	codes := make([]string, 0, len(byTime)+len(byPrice))
+	for _, code := range append(byTime, byPrice...) {
+		if _, ok := seen[code]; ok {
+			continue
+		}
+		seen[code] = struct{}{}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+func loadCodeRecord(ctx context.Context, rdb redis.Cmdable, code string) (*model.PriceItem, error) {
+	val, err := rdb.Get(ctx, keyCodePrefix+code).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var item model.PriceItem
+	if err := json.Unmarshal([]byte(val), &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// indexRecord places a live entry in the feed indexes. previousServer is the
+// server the entry was indexed under before, if any; the entry is moved out of
+// that server's sets when its server changed.
+func indexRecord(ctx context.Context, pipe redis.Pipeliner, record model.PriceItem, previousServer string) {
+	server := strings.TrimSpace(record.Server)
+	previousServer = strings.TrimSpace(previousServer)
+	if previousServer != "" && previousServer != server {
+		pipe.ZRem(ctx, serverFeedKey(previousServer, "time"), record.Code)
+		pipe.ZRem(ctx, serverFeedKey(previousServer, "price"), record.Code)
+	}
+
+	timeZ := redis.Z{Score: float64(record.Timestamp), Member: record.Code}
+	priceZ := redis.Z{Score: record.Price, Member: record.Code}
+
+	pipe.ZAdd(ctx, keyPriceTime, timeZ)
+	pipe.ZAdd(ctx, keyPriceValue, priceZ)
+	pipe.ZAdd(ctx, keyFeedCodes, redis.Z{Score: 0, Member: record.Code})
+	pipe.ZAddNX(ctx, keyFeedConfirmed, redis.Z{Score: 0, Member: record.Code})
+	if server == "" {
+		return
+	}
+	pipe.SAdd(ctx, keyFeedServers, server)
+	pipe.ZAdd(ctx, serverFeedKey(server, "time"), timeZ)
+	pipe.ZAdd(ctx, serverFeedKey(server, "price"), priceZ)
+}
+
+// unindexCodes removes codes from every feed index, the hidden set included,
+// and returns the removal counts of the time and price index.
+func unindexCodes(ctx context.Context, pipe redis.Pipeliner, servers []string, codes []interface{}) (*redis.IntCmd, *redis.IntCmd) {
+	removedTime := pipe.ZRem(ctx, keyPriceTime, codes...)
+	removedPrice := pipe.ZRem(ctx, keyPriceValue, codes...)
+	pipe.ZRem(ctx, keyFeedCodes, codes...)
+	pipe.ZRem(ctx, keyFeedConfirmed, codes...)
+	pipe.ZRem(ctx, keyFeedHidden, codes...)
+	for _, server := range servers {
+		pipe.ZRem(ctx, serverFeedKey(server, "time"), codes...)
+		pipe.ZRem(ctx, serverFeedKey(server, "price"), codes...)
+	}
+	return removedTime, removedPrice
+}
+
+func serverFeedKey(server, sortBy string) string {
+	return keyServerFeedPrefix + server + ":" + sortBy
+}
+
+func (s *PriceService) submissionIDs(ctx context.Context, codes []string) ([]string, error) {
+	pipe := s.rdb.Pipeline()
+	cmds := make([]*redis.StringSliceCmd, 0, len(codes))
+	for _, key := range codeSubmissionKeys(codes) {
+		cmds = append(cmds, pipe.HKeys(ctx, key))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, cmd := range cmds {
+		ids = append(ids, cmd.Val()...)
+	}
+	return ids, nil
+}
+
+// mergeSubmission folds a new submission into the existing record for its
+// code. A nil record starts a new entry.
+func mergeSubmission(record *model.PriceItem, sub model.PriceItem) model.PriceItem {
+	merged := model.PriceItem{
+		ID:          sub.ID,
+		Code:        sub.Code,
+		Price:       sub.Price,
+		Server:      sub.Server,
+		Source:      sub.Source,
+		Timestamp:   sub.Timestamp,
+		FirstSeen:   sub.Timestamp,
+		Submissions: 1,
+		Flagged:     sub.Flagged,
+		FlagReason:  sub.FlagReason,
+	}
+	if record != nil {
+		if record.FirstSeen > 0 {
+			merged.FirstSeen = record.FirstSeen
+		}
+		merged.Submissions = record.Submissions + 1
+		merged.Servers = append(merged.Servers, record.Servers...)
+	}
+
+	server := strings.TrimSpace(sub.Server)
+	if server != "" && !containsString(merged.Servers, server) {
+		merged.Servers = append(merged.Servers, server)
+	}
+	return merged
+}
+
+// buildCodeRecord recomputes the live entry of a code from all of its
+// submissions. It reports false when there are none left.
+func buildCodeRecord(subs map[string]model.PriceItem) (model.PriceItem, bool) {
+	ordered := make([]model.PriceItem, 0, len(subs))
+	for _, sub := range subs {
+		ordered = append(ordered, sub)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if ordered[i].Timestamp == ordered[j].Timestamp {
+			return ordered[i].ID < ordered[j].ID
+		}
+		return ordered[i].Timestamp < ordered[j].Timestamp
+	})
+
+	var record *model.PriceItem
+	for _, sub := range ordered {
+		merged := mergeSubmission(record, sub)
+		record = &merged
+	}
+	if record == nil {
+		return model.PriceItem{}, false
+	}
+	return *record, true
+}
+
+func normalizeFeedCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func codeRecordKeys(codes []string) []string {
+	keys := make([]string, 0, len(codes))
+	for _, code := range codes {
+		keys = append(keys, keyCodePrefix+code)
+	}
+	return keys
+}
+
+func codeSubmissionKeys(codes []string) []string {
+	keys := make([]string, 0, len(codes))
+	for _, code := range codes {
+		keys = append(keys, keyCodePrefix+code+keyCodeSubmissionsSuffix)
+	}
+	return keys
+}
+
+func codeVoteKeys(codes []string) []string {
+	keys := make([]string, 0, len(codes))
+	for _, code := range codes {
+		keys = append(keys, keyCodePrefix+code+keyCodeVotesSuffix)
+	}
+	return keys
+}
+
+func containsString(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/lingbao-market/backend/internal/model"
+	"github.com/redis/go-redis/v9"
+)
+
+// testRedisDB keeps the Redis-backed tests away from the data of a local
+// instance; the database is flushed before and after every such test.
+const testRedisDB = 15
+
+// testRedis returns a client for the Redis-backed tests: an in-process
+// miniredis, or the Redis at REDIS_ADDR when it is set, to check the scripts
+// against a real server. Tests using it don't run in parallel, since they
+// share a database on a real server.
+func testRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+		t.Cleanup(func() { _ = rdb.Close() })
+		return rdb
+	}
+
+	rdb := redis.NewClient(&redis.Options{Addr: addr, Password: os.Getenv("REDIS_PASSWORD"), DB: testRedisDB})
+	ctx := context.Background()
+	if err := rdb.FlushDB(ctx).Err(); err != nil {
+		t.Fatalf("expected Redis at %s, got %v", addr, err)
+	}
+	t.Cleanup(func() {
+		_ = rdb.FlushDB(context.Background()).Err()
+		_ = rdb.Close()
+	})
+	return rdb
+}
+
+func TestMergeSubmission(t *testing.T) {
+	t.Parallel()
+
+	first := mergeSubmission(nil, model.PriceItem{ID: "a", Code: "ABC123", Price: 300, Server: "s1", Timestamp: 1000})
+	if first.Submissions != 1 || first.FirstSeen != 1000 || first.Timestamp != 1000 {
+		t.Fatalf("unexpected first record: %+v", first)
+	}
+
+	second := mergeSubmission(&first, model.PriceItem{ID: "b", Code: "ABC123", Price: 450, Server: "s2", Timestamp: 2000})
+	if second.ID != "b" || second.Price != 450 || second.Server != "s2" {
+		t.Fatalf("expected latest price/server, got %+v", second)
+	}
+	if second.FirstSeen != 1000 || second.Timestamp != 2000 || second.Submissions != 2 {
+		t.Fatalf("unexpected aggregate fields: %+v", second)
+	}
+	if len(second.Servers) != 2 || second.Servers[0] != "s1" || second.Servers[1] != "s2" {
+		t.Fatalf("expected servers [s1 s2], got %v", second.Servers)
+	}
+
+	third := mergeSubmission(&second, model.PriceItem{ID: "c", Code: "ABC123", Price: 400, Server: "s1", Timestamp: 3000})
+	if len(third.Servers) != 2 || third.Submissions != 3 {
+		t.Fatalf("expected dedup of servers and count 3, got %+v", third)
+	}
+}
+
+func TestBuildCodeRecord(t *testing.T) {
+	t.Parallel()
+
+	if _, ok := buildCodeRecord(map[string]model.PriceItem{}); ok {
+		t.Fatal("expected no record for empty submissions")
+	}
+
+	record, ok := buildCodeRecord(map[string]model.PriceItem{
+		"b": {ID: "b", Code: "ABC123", Price: 450, Server: "s2", Timestamp: 2000},
+		"a": {ID: "a", Code: "ABC123", Price: 300, Server: "s1", Timestamp: 1000},
+	})
+	if !ok {
+		t.Fatal("expected record")
+	}
+	if record.ID != "b" || record.Price != 450 || record.FirstSeen != 1000 || record.Submissions != 2 {
+		t.Fatalf("unexpected record: %+v", record)
+	}
+}
+
+func TestAddPriceTrimsCodeSubmissions(t *testing.T) {
+	rdb := testRedis(t)
+	ctx := context.Background()
+	subsKey := keyCodePrefix + "ABC123" + keyCodeSubmissionsSuffix
+
+	svc := NewPriceService(rdb, PriceServiceOptions{Outliers: OutlierOff})
+	for i := 0; i < codeSubmissionsMax+5; i++ {
+		if _, err := svc.AddPrice(ctx, model.PriceItem{Code: "ABC123", Price: 300}); err != nil {
+			t.Fatalf("AddPrice: %v", err)
+		}
+	}
+	if n := rdb.HLen(ctx, subsKey).Val(); n != codeSubmissionsMax {
+		t.Fatalf("expected %d kept submissions, got %d", codeSubmissionsMax, n)
+	}
+	if n := rdb.HLen(ctx, keySubmissionIndex).Val(); n != codeSubmissionsMax {
+		t.Fatalf("expected the index to follow, got %d entries", n)
+	}
+	record, err := loadCodeRecord(ctx, rdb, "ABC123")
+	if err != nil || record == nil || record.Submissions != codeSubmissionsMax+5 {
+		t.Fatalf("expected the record to keep counting, got %+v (%v)", record, err)
+	}
+
+	// Submissions older than the window go even while the code stays live.
+	windowed := NewPriceService(rdb, PriceServiceOptions{Outliers: OutlierOff, FeedWindow: time.Millisecond})
+	time.Sleep(5 * time.Millisecond)
+	item, err := windowed.AddPrice(ctx, model.PriceItem{Code: "ABC123", Price: 300})
+	if err != nil {
+		t.Fatalf("AddPrice: %v", err)
+	}
+	ids := rdb.HKeys(ctx, subsKey).Val()
+	if len(ids) != 1 || ids[0] != item.ID {
+		t.Fatalf("expected only the new submission, got %v", ids)
+	}
+}
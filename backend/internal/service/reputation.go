@@ -0,0 +1,314 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lingbao-market/backend/internal/model"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Hash of event counters plus the last known username, per user ID.
+	keyReputationPrefix = "reputation:user:"
+	// Sorted set of user ID -> reputation score, for the leaderboard.
+	keyReputationScores = "reputation:scores"
+	// Set of the codes a user has earned submission reputation for.
+	keyReputationCodesSuffix = ":codes"
+	// Fixed-window submission counters per tier and submitter.
+	keySubmitLimitPrefix = "ratelimit:submit:"
+
+	reputationSubmissions   = "submissions"
+	reputationConfirmations = "confirmations"
+	reputationDeletions     = "deletions"
+	reputationReports       = "reports"
+
+	// Only a user's first few distinct codes earn the submission point, so
+	// posting codes alone never lifts anyone out of the new tier; the rest of
+	// the score has to come from other users confirming them.
+	submissionScoreCap = 3
+
+	defaultTrustedScore = 50
+	defaultNewScore     = 5
+	defaultRegularLimit = 20
+	defaultNewLimit     = 3
+	submitLimitWindow   = time.Minute
+
+	LeaderboardDefaultLimit = 20
+	LeaderboardMaxLimit     = 100
+)
+
+// Submitter tiers, from most to least trusted. Guests are always TierNew.
+const (
+	TierTrusted = "trusted"
+	TierRegular = "regular"
+	TierNew     = "new"
+)
+
+// reputationWeights turns event counters into a score. A code removed after
+// a report costs more than one an admin removed unprompted.
+var reputationWeights = map[string]int64{
+	reputationSubmissions:   1,
+	reputationConfirmations: 2,
+	reputationDeletions:     -10,
+	reputationReports:       -20,
+}
+
+// ReputationOptions places the tier boundaries and the submission limits of
+// the lower tiers. Trusted submitters are not limited.
+type ReputationOptions struct {
+	// TrustedScore is the lowest score of a trusted submitter.
+	TrustedScore int64
+	// NewScore is the lowest score of a regular submitter; users below it
+	// count as new.
+	NewScore int64
+	// RegularLimit and NewLimit are submissions per minute.
+	RegularLimit int64
+	NewLimit     int64
+}
+
+func (o ReputationOptions) withDefaults() ReputationOptions {
+	if o.TrustedScore <= 0 {
+		o.TrustedScore = defaultTrustedScore
+	}
+	if o.NewScore <= 0 {
+		o.NewScore = defaultNewScore
+	}
+	if o.RegularLimit <= 0 {
+		o.RegularLimit = defaultRegularLimit
+	}
+	if o.NewLimit <= 0 {
+		o.NewLimit = defaultNewLimit
+	}
+	return o
+}
+
+// isUserSubmitter tells registered users, who earn reputation, from guests.
+func isUserSubmitter(id string) bool {
+	return id != "" && !strings.HasPrefix(id, AnonymousSubmitterPrefix)
+}
+
+// addReputation queues a change to one of a user's counters.
+func addReputation(ctx context.Context, pipe redis.Pipeliner, userID, name, field string, delta int64) {
+	if !isUserSubmitter(userID) || delta == 0 {
+		return
+	}
+	key := keyReputationPrefix + userID
+	pipe.HIncrBy(ctx, key, field, delta)
+	if name != "" {
+		pipe.HSet(ctx, key, "name", name)
+	}
+	pipe.ZIncrBy(ctx, keyReputationScores, float64(reputationWeights[field]*delta), userID)
+}
+
+// creditSubmission queues the count of a user's submission. It is counted
+// once per code, so resubmitting the same code doesn't farm reputation, and
+// only the first submissionScoreCap codes add to the score.
+func (s *PriceService) creditSubmission(ctx context.Context, pipe redis.Pipeliner, submission model.PriceItem) {
+	if !isUserSubmitter(submission.SubmitterID) {
+		return
+	}
+	codesKey := keyReputationPrefix + submission.SubmitterID + keyReputationCodesSuffix
+	codes := s.rdb.TxPipeline()
+	added := codes.SAdd(ctx, codesKey, submission.Code)
+	distinct := codes.SCard(ctx, codesKey)
+	if _, err := codes.Exec(ctx); err != nil {
+		log.Printf("Updating reputation (%s) failed: %v", reputationSubmissions, err)
+		return
+	}
+	if added.Val() != 1 {
+		return
+	}
+	if distinct.Val() <= submissionScoreCap {
+		addReputation(ctx, pipe, submission.SubmitterID, submission.SubmitterName, reputationSubmissions, 1)
+		return
+	}
+	key := keyReputationPrefix + submission.SubmitterID
+	pipe.HIncrBy(ctx, key, reputationSubmissions, 1)
+	if submission.SubmitterName != "" {
+		pipe.HSet(ctx, key, "name", submission.SubmitterName)
+	}
+}
+
+// creditSubmitters applies a counter change to every registered submitter of
+// a code except skip. Reputation is bookkeeping, so failures are only logged.
+func (s *PriceService) creditSubmitters(ctx context.Context, submitters map[string]string, skip, field string, delta int64) {
+	if len(submitters) == 0 {
+		return
+	}
+	pipe := s.rdb.TxPipeline()
+	for id, name := range submitters {
+		if id != skip {
+			addReputation(ctx, pipe, id, name, field, delta)
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Updating reputation (%s) failed: %v", field, err)
+	}
+}
+
+// codeSubmitters returns the registered submitters of a code's live
+// submissions, by user ID.
+func codeSubmitters(ctx context.Context, rdb redis.Cmdable, code string) (map[string]string, error) {
+	vals, err := rdb.HVals(ctx, keyCodePrefix+code+keyCodeSubmissionsSuffix).Result()
+	if err != nil {
+		return nil, err
+	}
+	submitters := make(map[string]string)
+	for _, val := range vals {
+		var sub model.PriceItem
+		if err := json.Unmarshal([]byte(val), &sub); err != nil || !isUserSubmitter(sub.SubmitterID) {
+			continue
+		}
+		if submitters[sub.SubmitterID] == "" {
+			submitters[sub.SubmitterID] = sub.SubmitterName
+		}
+	}
+	return submitters, nil
+}
+
+// GetReputation returns a user's reputation; users without any activity
+// get a zero entry.
+func (s *PriceService) GetReputation(ctx context.Context, userID string) (*model.Reputation, error) {
+	fields, err := s.rdb.HGetAll(ctx, keyReputationPrefix+userID).Result()
+	if err != nil {
+		return nil, err
+	}
+	rep := reputationFromFields(userID, fields)
+	rep.Tier = s.tierForScore(rep.Score)
+	return &rep, nil
+}
+
+// ReputationScores returns the scores of several users; users without any
+// activity are left out.
+func (s *PriceService) ReputationScores(ctx context.Context, userIDs []string) (map[string]int64, error) {
+	scores := make(map[string]int64, len(userIDs))
+	if len(userIDs) == 0 {
+		return scores, nil
+	}
+	vals, err := s.rdb.ZMScore(ctx, keyReputationScores, userIDs...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, val := range vals {
+		if val != 0 {
+			scores[userIDs[i]] = int64(val)
+		}
+	}
+	return scores, nil
+}
+
+// Leaderboard returns the users with the highest reputation.
+func (s *PriceService) Leaderboard(ctx context.Context, limit int64) ([]model.Reputation, error) {
+	if limit <= 0 {
+		limit = LeaderboardDefaultLimit
+	}
+	if limit > LeaderboardMaxLimit {
+		limit = LeaderboardMaxLimit
+	}
+
+	ids, err := s.rdb.ZRevRange(ctx, keyReputationScores, 0, limit-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	pipe := s.rdb.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.HGetAll(ctx, keyReputationPrefix+id)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	board := make([]model.Reputation, 0, len(ids))
+	for i, id := range ids {
+		rep := reputationFromFields(id, cmds[i].Val())
+		rep.Tier = s.tierForScore(rep.Score)
+		board = append(board, rep)
+	}
+	return board, nil
+}
+
+// ForgetReputation drops a deleted user's reputation.
+func (s *PriceService) ForgetReputation(ctx context.Context, userID string) error {
+	pipe := s.rdb.TxPipeline()
+	pipe.Del(ctx, keyReputationPrefix+userID, keyReputationPrefix+userID+keyReputationCodesSuffix)
+	pipe.ZRem(ctx, keyReputationScores, userID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// SubmitterTier places a submitter in a tier by reputation. Guests are new.
+func (s *PriceService) SubmitterTier(ctx context.Context, submitterID string) (string, error) {
+	if !isUserSubmitter(submitterID) {
+		return TierNew, nil
+	}
+	score, err := s.rdb.ZScore(ctx, keyReputationScores, submitterID).Result()
+	if err != nil && err != redis.Nil {
+		return "", err
+	}
+	return s.tierForScore(int64(score)), nil
+}
+
+// AllowSubmission takes one submission slot of the tier's per-minute limit
+// for key, which identifies the submitter (or the client, for guests). It
+// reports false once the limit is used up.
+func (s *PriceService) AllowSubmission(ctx context.Context, tier, key string) (bool, error) {
+	var limit int64
+	switch tier {
+	case TierTrusted:
+		return true, nil
+	case TierRegular:
+		limit = s.opts.Reputation.RegularLimit
+	default:
+		limit = s.opts.Reputation.NewLimit
+	}
+
+	window := time.Now().Truncate(submitLimitWindow).Unix()
+	counter := keySubmitLimitPrefix + tier + ":" + key + ":" + strconv.FormatInt(window, 10)
+	pipe := s.rdb.TxPipeline()
+	count := pipe.Incr(ctx, counter)
+	pipe.Expire(ctx, counter, submitLimitWindow)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+	return count.Val() <= limit, nil
+}
+
+func (s *PriceService) tierForScore(score int64) string {
+	switch {
+	case score >= s.opts.Reputation.TrustedScore:
+		return TierTrusted
+	case score >= s.opts.Reputation.NewScore:
+		return TierRegular
+	default:
+		return TierNew
+	}
+}
+
+func reputationFromFields(userID string, fields map[string]string) model.Reputation {
+	rep := model.Reputation{UserID: userID, Username: fields["name"]}
+	counters := map[string]*int64{
+		reputationSubmissions:   &rep.Submissions,
+		reputationConfirmations: &rep.Confirmations,
+		reputationDeletions:     &rep.Deletions,
+		reputationReports:       &rep.Reports,
+	}
+	for field, dst := range counters {
+		*dst, _ = strconv.ParseInt(fields[field], 10, 64)
+		rep.Score += reputationPoints(field, *dst)
+	}
+	return rep
+}
+
+// reputationPoints is what count events of one kind add to a score.
+func reputationPoints(field string, count int64) int64 {
+	if field == reputationSubmissions && count > submissionScoreCap {
+		count = submissionScoreCap
+	}
+	return reputationWeights[field] * count
+}
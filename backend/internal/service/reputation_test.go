@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lingbao-market/backend/internal/model"
+)
+
+func TestReputationFromFields(t *testing.T) {
+	t.Parallel()
+
+	rep := reputationFromFields("u1", map[string]string{
+		"name":          "alice",
+		"submissions":   "12",
+		"confirmations": "5",
+		"deletions":     "1",
+	})
+	if rep.Username != "alice" || rep.Submissions != 12 || rep.Confirmations != 5 || rep.Deletions != 1 {
+		t.Fatalf("unexpected counters: %+v", rep)
+	}
+	// Only the first three submissions count: 3 + 5*2 - 10.
+	if rep.Score != 3 {
+		t.Fatalf("expected score 3, got %d", rep.Score)
+	}
+}
+
+func TestTierForScore(t *testing.T) {
+	t.Parallel()
+
+	svc := NewPriceService(nil, PriceServiceOptions{})
+	cases := map[int64]string{
+		-20: TierNew,
+		4:   TierNew,
+		5:   TierRegular,
+		49:  TierRegular,
+		50:  TierTrusted,
+	}
+	for score, want := range cases {
+		if got := svc.tierForScore(score); got != want {
+			t.Fatalf("%d: expected %q, got %q", score, want, got)
+		}
+	}
+}
+
+func TestCreditSubmissionCapsScore(t *testing.T) {
+	rdb := testRedis(t)
+	svc := NewPriceService(rdb, PriceServiceOptions{})
+	ctx := context.Background()
+
+	for _, code := range []string{"AAA111", "AAA111", "BBB222", "CCC333", "DDD444", "EEE555"} {
+		pipe := rdb.TxPipeline()
+		svc.creditSubmission(ctx, pipe, model.PriceItem{Code: code, SubmitterID: "u1", SubmitterName: "alice"})
+		if _, err := pipe.Exec(ctx); err != nil {
+			t.Fatalf("credit %s: %v", code, err)
+		}
+	}
+
+	rep, err := svc.GetReputation(ctx, "u1")
+	if err != nil {
+		t.Fatalf("GetReputation: %v", err)
+	}
+	if rep.Submissions != 5 || rep.Score != submissionScoreCap || rep.Tier != TierNew {
+		t.Fatalf("expected 5 distinct codes capped at %d points, got %+v", submissionScoreCap, rep)
+	}
+	if scores, _ := svc.ReputationScores(ctx, []string{"u1"}); scores["u1"] != submissionScoreCap {
+		t.Fatalf("expected leaderboard score %d, got %v", submissionScoreCap, scores)
+	}
+}
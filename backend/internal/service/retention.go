@@ -0,0 +1,34 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RetentionPolicy decides how entries leave the live feed: all at once at the
+// daily reset, one by one once they are older than the feed window, or both.
+type RetentionPolicy string
+
+const (
+	RetentionDailyReset    RetentionPolicy = "daily_reset"
+	RetentionRollingWindow RetentionPolicy = "rolling_window"
+	RetentionBoth          RetentionPolicy = "both"
+)
+
+func ParseRetentionPolicy(value string) (RetentionPolicy, error) {
+	switch policy := RetentionPolicy(strings.ToLower(strings.TrimSpace(value))); policy {
+	case RetentionDailyReset, RetentionRollingWindow, RetentionBoth:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown retention policy %q", value)
+}
+
+// DailyReset reports whether the feed is wiped at the daily reset.
+func (p RetentionPolicy) DailyReset() bool {
+	return p == RetentionDailyReset || p == RetentionBoth
+}
+
+// RollingWindow reports whether entries expire individually.
+func (p RetentionPolicy) RollingWindow() bool {
+	return p == RetentionRollingWindow || p == RetentionBoth
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lingbao-market/backend/internal/model"
+)
+
+func TestParseRetentionPolicy(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		value   string
+		daily   bool
+		rolling bool
+	}{
+		{"daily_reset", true, false},
+		{"ROLLING_WINDOW", false, true},
+		{" both ", true, true},
+	}
+	for _, tc := range cases {
+		policy, err := ParseRetentionPolicy(tc.value)
+		if err != nil {
+			t.Fatalf("%q: expected nil error, got %v", tc.value, err)
+		}
+		if policy.DailyReset() != tc.daily || policy.RollingWindow() != tc.rolling {
+			t.Fatalf("%q: unexpected policy %q", tc.value, policy)
+		}
+	}
+
+	if _, err := ParseRetentionPolicy("weekly"); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+}
+
+func TestCleanupExpiredArchivesEntries(t *testing.T) {
+	svc := NewPriceService(testRedis(t), PriceServiceOptions{})
+	ctx := context.Background()
+
+	for _, code := range []string{"AAA111", "BBB222"} {
+		if _, err := svc.AddPrice(ctx, model.PriceItem{Code: code, Price: 300}); err != nil {
+			t.Fatalf("AddPrice(%s): %v", code, err)
+		}
+	}
+	now := time.Now()
+	removed, _, err := svc.CleanupExpired(ctx, now.Add(time.Second))
+	if err != nil || removed != 2 {
+		t.Fatalf("expected 2 expired entries, got %d (%v)", removed, err)
+	}
+
+	page, err := svc.GetArchive(ctx, svc.opts.MarketDay.Date(now), FeedQuery{})
+	if err != nil {
+		t.Fatalf("expected the day's archive, got %v", err)
+	}
+	if len(page.Items) != 2 {
+		t.Fatalf("expected both expired entries archived, got %+v", page.Items)
+	}
+}
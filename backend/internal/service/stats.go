@@ -0,0 +1,283 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lingbao-market/backend/internal/model"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// One bucket per market-day hour, named market:stats:<UTC YYYYMMDDHHMM of
+	// its start> so that buckets line up with the daily reset:
+	//   hash      count, max, server:<name>:count, server:<name>:max, and
+	//             price:<bin> counts sketching the price distribution
+	//   :codes    HyperLogLog of codes, plus :codes:<server> per server
+	keyStatsPrefix  = "market:stats:"
+	statsHourLayout = "200601021504"
+
+	// statsSketchGamma spaces the price bins logarithmically, so a percentile
+	// read from the sketch is within 1% of the exact one.
+	statsSketchGamma = 1.02
+
+	// StatsMaxRange bounds the range a single stats query may cover.
+	StatsMaxRange = 31 * 24 * time.Hour
+)
+
+var ErrInvalidStatsRange = errors.New("invalid stats range")
+
+// statsMaxScript raises each named hash field to ARGV[1] if it is lower.
+var statsMaxScript = redis.NewScript(`
+local value = tonumber(ARGV[1])
+for i = 2, #ARGV do
+	local current = tonumber(redis.call('HGET', KEYS[1], ARGV[i]))
+	if not current or value > current then
+		redis.call('HSET', KEYS[1], ARGV[i], ARGV[1])
+	end
+end
+return 0
+`)
+
+// recordStats queues the hourly aggregate updates for a new submission.
+// Buckets count submissions as received; later edits and deletions don't
+// change them. They are kept as long as archives.
+func (s *PriceService) recordStats(ctx context.Context, pipe redis.Pipeliner, sub model.PriceItem) {
+	key := statsHourKey(s.opts.MarketDay.HourStart(time.UnixMilli(sub.Timestamp)))
+	codesKey, serverCodesKey := key+":codes", key+":codes:"+sub.Server
+
+	pipe.HIncrBy(ctx, key, "count", 1)
+	pipe.HIncrBy(ctx, key, statsServerField(sub.Server, "count"), 1)
+	pipe.HIncrBy(ctx, key, statsPriceField(statsSketchBin(sub.Price)), 1)
+	statsMaxScript.Eval(ctx, pipe, []string{key}, sub.Price, "max", statsServerField(sub.Server, "max"))
+	pipe.PFAdd(ctx, codesKey, sub.Code)
+	pipe.PFAdd(ctx, serverCodesKey, sub.Code)
+	for _, k := range []string{key, codesKey, serverCodesKey} {
+		pipe.Expire(ctx, k, s.opts.ArchiveRetention)
+	}
+}
+
+type statsBucket struct {
+	hour     time.Time
+	fields   *redis.MapStringStringCmd
+	distinct *redis.IntCmd
+}
+
+// GetStats aggregates the hourly buckets overlapping [from, to).
+func (s *PriceService) GetStats(ctx context.Context, from, to time.Time) (*model.MarketStats, error) {
+	if !to.After(from) || to.Sub(from) > StatsMaxRange {
+		return nil, ErrInvalidStatsRange
+	}
+
+	hours := statsHours(s.opts.MarketDay, from, to)
+	buckets := make([]statsBucket, len(hours))
+	pipe := s.rdb.Pipeline()
+	for i, hour := range hours {
+		key := statsHourKey(hour)
+		buckets[i] = statsBucket{
+			hour:     hour,
+			fields:   pipe.HGetAll(ctx, key),
+			distinct: pipe.PFCount(ctx, key+":codes"),
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	stats := &model.MarketStats{
+		From:   hours[0].UnixMilli(),
+		To:     hours[len(hours)-1].Add(time.Hour).UnixMilli(),
+		Hourly: make([]model.HourlyStats, 0, len(hours)),
+	}
+	servers := make(map[string]*model.ServerStats)
+	sketch := make(statsSketch)
+	var codesKeys []string
+	for _, bucket := range buckets {
+		fields := bucket.fields.Val()
+		hourly := model.HourlyStats{
+			Hour:          bucket.hour.UnixMilli(),
+			DistinctCodes: bucket.distinct.Val(),
+		}
+		hourly.Submissions, _ = strconv.ParseInt(fields["count"], 10, 64)
+		hourly.MaxPrice, _ = strconv.ParseFloat(fields["max"], 64)
+		stats.Hourly = append(stats.Hourly, hourly)
+		if hourly.Submissions == 0 {
+			continue
+		}
+
+		stats.Submissions += hourly.Submissions
+		if hourly.MaxPrice > stats.MaxPrice {
+			stats.MaxPrice = hourly.MaxPrice
+		}
+		codesKeys = append(codesKeys, statsHourKey(bucket.hour)+":codes")
+
+		for field, value := range fields {
+			if bin, ok := parseStatsPriceField(field); ok {
+				count, _ := strconv.ParseInt(value, 10, 64)
+				sketch[bin] += count
+				continue
+			}
+			server, metric, ok := parseStatsServerField(field)
+			if !ok {
+				continue
+			}
+			entry := servers[server]
+			if entry == nil {
+				entry = &model.ServerStats{Server: server}
+				servers[server] = entry
+			}
+			switch metric {
+			case "count":
+				count, _ := strconv.ParseInt(value, 10, 64)
+				entry.Submissions += count
+			case "max":
+				if price, _ := strconv.ParseFloat(value, 64); price > entry.MaxPrice {
+					entry.MaxPrice = price
+				}
+			}
+		}
+	}
+
+	stats.Servers = make([]model.ServerStats, 0, len(servers))
+	if stats.Submissions == 0 {
+		return stats, nil
+	}
+
+	serverNames := make([]string, 0, len(servers))
+	for server := range servers {
+		serverNames = append(serverNames, server)
+	}
+	sort.Strings(serverNames)
+
+	pipe = s.rdb.Pipeline()
+	distinct := pipe.PFCount(ctx, codesKeys...)
+	serverDistinct := make([]*redis.IntCmd, len(serverNames))
+	for i, server := range serverNames {
+		keys := make([]string, len(codesKeys))
+		for j, k := range codesKeys {
+			keys[j] = k + ":" + server
+		}
+		serverDistinct[i] = pipe.PFCount(ctx, keys...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	stats.DistinctCodes = distinct.Val()
+	stats.MedianPrice = sketch.quantile(0.5)
+	stats.P90Price = sketch.quantile(0.9)
+	for i, server := range serverNames {
+		entry := servers[server]
+		entry.DistinctCodes = serverDistinct[i].Val()
+		stats.Servers = append(stats.Servers, *entry)
+	}
+	return stats, nil
+}
+
+// statsSketch counts prices per logarithmic bin. Bins from different hours
+// merge by adding their counts.
+type statsSketch map[int]int64
+
+// statsSketchZeroBin holds non-positive prices, below every other bin.
+const statsSketchZeroBin = math.MinInt32
+
+// statsSketchBin returns the bin holding price: bin i covers the prices in
+// (gamma^(i-1), gamma^i].
+func statsSketchBin(price float64) int {
+	if price <= 0 {
+		return statsSketchZeroBin
+	}
+	return int(math.Ceil(math.Log(price) / math.Log(statsSketchGamma)))
+}
+
+// statsSketchValue returns the price that stands for a bin: the point within
+// 1% of every price the bin can hold.
+func statsSketchValue(bin int) float64 {
+	if bin == statsSketchZeroBin {
+		return 0
+	}
+	return 2 * math.Pow(statsSketchGamma, float64(bin)) / (statsSketchGamma + 1)
+}
+
+// quantile interpolates between the closest ranks the same way percentile
+// does for an in-memory slice, reading each rank's price from its bin.
+func (s statsSketch) quantile(p float64) float64 {
+	bins := make([]int, 0, len(s))
+	var total int64
+	for bin, count := range s {
+		if count > 0 {
+			bins = append(bins, bin)
+			total += count
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	sort.Ints(bins)
+
+	rank := p * float64(total-1)
+	lower := int64(rank)
+	frac := rank - float64(lower)
+	at := func(rank int64) float64 {
+		var seen int64
+		for _, bin := range bins {
+			seen += s[bin]
+			if rank < seen {
+				return statsSketchValue(bin)
+			}
+		}
+		return statsSketchValue(bins[len(bins)-1])
+	}
+	value := at(lower)
+	if frac == 0 {
+		return value
+	}
+	return value + frac*(at(lower+1)-value)
+}
+
+// statsHours lists the market-day hours overlapping [from, to).
+func statsHours(day MarketDay, from, to time.Time) []time.Time {
+	var hours []time.Time
+	for hour := day.HourStart(from); hour.Before(to); hour = hour.Add(time.Hour) {
+		hours = append(hours, hour)
+	}
+	return hours
+}
+
+func statsHourKey(t time.Time) string {
+	return keyStatsPrefix + t.UTC().Format(statsHourLayout)
+}
+
+func statsServerField(server, metric string) string {
+	return "server:" + server + ":" + metric
+}
+
+func statsPriceField(bin int) string {
+	return "price:" + strconv.Itoa(bin)
+}
+
+func parseStatsPriceField(field string) (int, bool) {
+	rest, ok := strings.CutPrefix(field, "price:")
+	if !ok {
+		return 0, false
+	}
+	bin, err := strconv.Atoi(rest)
+	return bin, err == nil
+}
+
+func parseStatsServerField(field string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(field, "server:")
+	if !ok {
+		return "", "", false
+	}
+	idx := strings.LastIndex(rest, ":")
+	if idx < 0 {
+		return "", "", false
+	}
+	return rest[:idx], rest[idx+1:], true
+}
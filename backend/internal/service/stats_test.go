@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/lingbao-market/backend/internal/model"
+)
+
+func TestStatsHours(t *testing.T) {
+	t.Parallel()
+
+	loc := time.FixedZone("UTC+8", 8*60*60)
+	day := MarketDay{Hour: 3, Minute: 30, Location: loc}
+	from := time.Date(2024, 5, 1, 3, 10, 0, 0, loc)
+	hours := statsHours(day, from, from.Add(2*time.Hour))
+	if len(hours) != 3 {
+		t.Fatalf("expected 3 hours, got %d", len(hours))
+	}
+	if !hours[0].Equal(time.Date(2024, 5, 1, 2, 30, 0, 0, loc)) {
+		t.Fatalf("expected first hour 02:30, got %v", hours[0])
+	}
+	if !hours[1].Equal(day.Start(from.Add(time.Hour))) {
+		t.Fatalf("expected the second hour to open the market day, got %v", hours[1])
+	}
+	if key := statsHourKey(hours[2]); key != "market:stats:202404302030" {
+		t.Fatalf("unexpected key %q", key)
+	}
+}
+
+func TestParseStatsServerField(t *testing.T) {
+	t.Parallel()
+
+	server, metric, ok := parseStatsServerField(statsServerField("官服:1", "max"))
+	if !ok || server != "官服:1" || metric != "max" {
+		t.Fatalf("unexpected parse: %q %q %v", server, metric, ok)
+	}
+	if _, _, ok := parseStatsServerField("count"); ok {
+		t.Fatalf("expected non-server field to be rejected")
+	}
+}
+
+func TestStatsSketchQuantile(t *testing.T) {
+	t.Parallel()
+
+	var sorted []float64
+	sketch := make(statsSketch)
+	for _, price := range []float64{0, 0.5, 120, 200, 300, 310, 400, 1000, 5000, 88888} {
+		sorted = append(sorted, price)
+		sketch[statsSketchBin(price)]++
+	}
+	for _, p := range []float64{0, 0.25, 0.5, 0.9, 1} {
+		want := percentile(sorted, p)
+		if got := sketch.quantile(p); math.Abs(got-want) > 0.01*want {
+			t.Fatalf("p%v: expected within 1%% of %v, got %v", p, want, got)
+		}
+	}
+	if got := make(statsSketch).quantile(0.5); got != 0 {
+		t.Fatalf("expected 0 for an empty sketch, got %v", got)
+	}
+}
+
+func TestGetStatsUsesMarketDayHours(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*60*60)
+	day := MarketDay{Hour: 3, Minute: 30, Location: loc}
+	svc := NewPriceService(testRedis(t), PriceServiceOptions{MarketDay: day, ArchiveRetention: time.Hour})
+	ctx := context.Background()
+
+	start := day.Start(time.Now())
+	prices := []float64{100, 200, 300, 400, 1000}
+	for i, price := range prices {
+		sub := model.PriceItem{
+			ID:        fmt.Sprintf("sub-%d", i),
+			Code:      fmt.Sprintf("STAT%02d", i),
+			Price:     price,
+			Server:    "官服",
+			Timestamp: start.Add(time.Duration(i) * time.Minute).UnixMilli(),
+		}
+		pipe := svc.rdb.TxPipeline()
+		svc.recordStats(ctx, pipe, sub)
+		if _, err := pipe.Exec(ctx); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+	}
+
+	stats, err := svc.GetStats(ctx, start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(stats.Hourly) != 1 || stats.Hourly[0].Hour != start.UnixMilli() {
+		t.Fatalf("expected one bucket opening at the reset, got %+v", stats.Hourly)
+	}
+	if stats.Submissions != 5 || stats.DistinctCodes != 5 || stats.MaxPrice != 1000 {
+		t.Fatalf("unexpected totals: %+v", stats)
+	}
+	if math.Abs(stats.MedianPrice-300) > 3 || math.Abs(stats.P90Price-760) > 7.6 {
+		t.Fatalf("expected median ~300 and p90 ~760, got %v / %v", stats.MedianPrice, stats.P90Price)
+	}
+	if len(stats.Servers) != 1 || stats.Servers[0].Submissions != 5 {
+		t.Fatalf("unexpected servers: %+v", stats.Servers)
+	}
+}
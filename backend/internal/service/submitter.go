@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/lingbao-market/backend/internal/model"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Sorted set of submission IDs per submitter, scored by time. Entries
+	// whose submission is gone are pruned when the set is read.
+	keySubmitterPrefix = "market:submitter:"
+
+	// AnonymousSubmitterPrefix starts the submitter IDs handed to guests.
+	AnonymousSubmitterPrefix = "anon:"
+
+	submitterListMax = 200
+)
+
+// indexSubmitter queues the submission into its submitter's list.
+func (s *PriceService) indexSubmitter(ctx context.Context, pipe redis.Pipeliner, sub model.PriceItem) {
+	if sub.SubmitterID == "" {
+		return
+	}
+	key := keySubmitterPrefix + sub.SubmitterID
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(sub.Timestamp), Member: sub.ID})
+	pipe.ZRemRangeByRank(ctx, key, 0, -submitterListMax-1)
+	// Submissions never outlive the feed window by more than a day.
+	pipe.Expire(ctx, key, s.opts.FeedWindow+24*time.Hour)
+}
+
+// ListSubmitterSubmissions returns the live submissions of a submitter,
+// newest first.
+func (s *PriceService) ListSubmitterSubmissions(ctx context.Context, submitterID string) ([]model.PriceItem, error) {
+	key := keySubmitterPrefix + submitterID
+	ids, err := s.rdb.ZRevRange(ctx, key, 0, submitterListMax-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return s.loadIndexedSubmissions(ctx, key, ids)
+}
+
+// loadIndexedSubmissions resolves submission IDs read from the sorted set at
+// key, in order, and removes the IDs whose submission is gone from it.
+func (s *PriceService) loadIndexedSubmissions(ctx context.Context, key string, ids []string) ([]model.PriceItem, error) {
+	if len(ids) == 0 {
+		return []model.PriceItem{}, nil
+	}
+
+	codes, err := s.rdb.HMGet(ctx, keySubmissionIndex, ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := s.rdb.Pipeline()
+	cmds := make([]*redis.StringCmd, len(ids))
+	for i, code := range codes {
+		if code, ok := code.(string); ok {
+			cmds[i] = pipe.HGet(ctx, keyCodePrefix+code+keyCodeSubmissionsSuffix, ids[i])
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	items := make([]model.PriceItem, 0, len(ids))
+	var stale []interface{}
+	for i, cmd := range cmds {
+		var item model.PriceItem
+		if cmd == nil || cmd.Err() != nil || json.Unmarshal([]byte(cmd.Val()), &item) != nil {
+			stale = append(stale, ids[i])
+			continue
+		}
+		items = append(items, item)
+	}
+	if len(stale) > 0 {
+		_ = s.rdb.ZRem(ctx, key, stale...).Err()
+	}
+	return items, nil
+}
+
+// ListCodeSubmissions returns every submission of a live code, newest first.
+func (s *PriceService) ListCodeSubmissions(ctx context.Context, code string) ([]model.PriceItem, error) {
+	code = normalizeFeedCode(code)
+	raw, err := s.rdb.HGetAll(ctx, keyCodePrefix+code+keyCodeSubmissionsSuffix).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]model.PriceItem, 0, len(raw))
+	for _, val := range raw {
+		var item model.PriceItem
+		if err := json.Unmarshal([]byte(val), &item); err == nil {
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Timestamp == items[j].Timestamp {
+			return items[i].ID > items[j].ID
+		}
+		return items[i].Timestamp > items[j].Timestamp
+	})
+	return items, nil
+}
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lingbao-market/backend/internal/model"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Counter per username. Every access and refresh token carries the
+	// version it was issued under; bumping it revokes them all.
+	keyTokenVersionPrefix = "auth:tokenver:"
+	// JSON refreshRecord per refresh token, keyed by the token's SHA-256 so
+	// a leaked dump holds no usable tokens.
+	keyRefreshPrefix = "auth:refresh:"
+	// Username per refresh token that was already rotated. Presenting one
+	// again means it was stolen, so the whole session family is revoked.
+	keyRefreshUsedPrefix = "auth:refresh:used:"
+
+	// AccessTokenType marks the short-lived tokens sent as Bearer.
+	AccessTokenType = "access"
+
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidToken        = errors.New("invalid token")
+	ErrTokenRevoked        = errors.New("token revoked")
+	ErrAccountBanned       = errors.New("account banned")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+)
+
+type refreshRecord struct {
+	UserID   string `json:"userId"`
+	Username string `json:"username"`
+	Version  int64  `json:"ver"`
+}
+
+// issueTokens signs an access token and stores a new refresh token for user
+// under the given token version.
+func (s *AuthService) issueTokens(ctx context.Context, user *model.User, version int64) (*model.AuthResponse, error) {
+	now := time.Now()
+	tokenString, err := s.keyring.Sign(ctx, jwt.MapClaims{
+		"sub":      user.ID,
+		"username": user.Username,
+		"admin":    user.IsAdmin,
+		"typ":      AccessTokenType,
+		"ver":      version,
+		"iat":      now.Unix(),
+		"exp":      now.Add(s.opts.AccessTokenTTL).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	refresh := base64.RawURLEncoding.EncodeToString(raw)
+	record, err := json.Marshal(refreshRecord{UserID: user.ID, Username: user.Username, Version: version})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.rdb.Set(ctx, keyRefreshPrefix+hashRefreshToken(refresh), record, s.opts.RefreshTokenTTL).Err(); err != nil {
+		return nil, err
+	}
+
+	return &model.AuthResponse{
+		Token:        tokenString,
+		RefreshToken: refresh,
+		ExpiresIn:    int64(s.opts.AccessTokenTTL / time.Second),
+		Username:     user.Username,
+		ID:           user.ID,
+		IsAdmin:      user.IsAdmin,
+	}, nil
+}
+
+// RefreshTokens trades a refresh token for a new access and refresh token.
+// The old refresh token is consumed; presenting it a second time revokes
+// every token of the user.
+func (s *AuthService) RefreshTokens(ctx context.Context, refreshToken string) (*model.AuthResponse, error) {
+	if refreshToken == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+	hash := hashRefreshToken(refreshToken)
+
+	val, err := s.rdb.GetDel(ctx, keyRefreshPrefix+hash).Result()
+	if errors.Is(err, redis.Nil) {
+		username, err := s.rdb.Get(ctx, keyRefreshUsedPrefix+hash).Result()
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, err := s.RevokeTokens(ctx, username); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var record refreshRecord
+	if err := json.Unmarshal([]byte(val), &record); err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err := s.rdb.Set(ctx, keyRefreshUsedPrefix+hash, record.Username, s.opts.RefreshTokenTTL).Err(); err != nil {
+		return nil, err
+	}
+
+	user, version, err := s.checkTokenOwner(ctx, record.Username, record.UserID, record.Version)
+	if err != nil {
+		return nil, err
+	}
+	return s.issueTokens(ctx, user, version)
+}
+
+// Logout drops a refresh token. With all set, every token of its user is
+// revoked as well. Unknown tokens are ignored.
+func (s *AuthService) Logout(ctx context.Context, refreshToken string, all bool) error {
+	if refreshToken == "" {
+		return nil
+	}
+	val, err := s.rdb.GetDel(ctx, keyRefreshPrefix+hashRefreshToken(refreshToken)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !all {
+		return nil
+	}
+	var record refreshRecord
+	if err := json.Unmarshal([]byte(val), &record); err != nil {
+		return nil
+	}
+	_, err = s.RevokeTokens(ctx, record.Username)
+	return err
+}
+
+// RevokeTokens bumps the token version of a user, invalidating every access
+// and refresh token issued before. It returns the new version.
+func (s *AuthService) RevokeTokens(ctx context.Context, username string) (int64, error) {
+	return s.rdb.Incr(ctx, keyTokenVersionPrefix+username).Result()
+}
+
+// ParseAccessToken checks the signature and type of an access token. It
+// does not check revocation; Authenticate does.
+func (s *AuthService) ParseAccessToken(ctx context.Context, tokenString string) (jwt.MapClaims, error) {
+	if tokenString == "" {
+		return nil, ErrInvalidToken
+	}
+	token, err := s.keyring.Parse(ctx, tokenString)
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	// Untyped tokens are the long-lived ones from before access tokens;
+	// their holders sign in again.
+	if typ, _ := claims["typ"].(string); typ != AccessTokenType {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// Authenticate parses an access token and checks that its user still
+// exists, is not banned, and has not revoked it.
+func (s *AuthService) Authenticate(ctx context.Context, tokenString string) (jwt.MapClaims, error) {
+	claims, err := s.ParseAccessToken(ctx, tokenString)
+	if err != nil {
+		return nil, err
+	}
+	username, _ := claims["username"].(string)
+	if username == "" {
+		username, _ = claims["name"].(string)
+	}
+	userID, _ := claims["sub"].(string)
+	version, _ := claims["ver"].(float64)
+	if _, _, err := s.checkTokenOwner(ctx, username, userID, int64(version)); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// checkTokenOwner loads the user a token was issued to and compares the
+// token version. It returns the user and the current version.
+func (s *AuthService) checkTokenOwner(ctx context.Context, username, userID string, version int64) (*model.User, int64, error) {
+	if username == "" {
+		return nil, 0, ErrInvalidToken
+	}
+	vals, err := s.rdb.MGet(ctx, userKeyPrefix+username, keyTokenVersionPrefix+username).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	raw, ok := vals[0].(string)
+	if !ok {
+		// Deleted users lose their sessions.
+		return nil, 0, ErrTokenRevoked
+	}
+	var user model.User
+	if err := json.Unmarshal([]byte(raw), &user); err != nil {
+		return nil, 0, err
+	}
+	if userID != "" && user.ID != userID {
+		// Same name, different account: re-registered after a delete.
+		return nil, 0, ErrTokenRevoked
+	}
+	if user.Banned {
+		return nil, 0, ErrAccountBanned
+	}
+	current := int64(0)
+	if v, ok := vals[1].(string); ok {
+		current, _ = strconv.ParseInt(v, 10, 64)
+	}
+	if version != current {
+		return nil, 0, ErrTokenRevoked
+	}
+	return &user, current, nil
+}
+
+func (s *AuthService) tokenVersion(ctx context.Context, username string) (int64, error) {
+	version, err := s.rdb.Get(ctx, keyTokenVersionPrefix+username).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return version, err
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
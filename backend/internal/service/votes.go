@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lingbao-market/backend/internal/model"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	VoteConfirm = "confirm"
+	VoteDispute = "dispute"
+
+	defaultDisputeThreshold = 5
+
+	keyVoteLimitPrefix = "ratelimit:vote:"
+
+	// A client gets voteLimit votes on one code per voteLimitWindow, however
+	// many identities it votes under.
+	voteLimit       = 3
+	voteLimitWindow = time.Hour
+
+	// GuestVoteMinAge is how old a guest's submitter token must be before
+	// its votes count, so a freshly minted identity can't vote.
+	GuestVoteMinAge = time.Hour
+)
+
+var (
+	ErrInvalidVote   = errors.New("invalid vote")
+	ErrCodeNotFound  = errors.New("code not found")
+	ErrCodeNotHidden = errors.New("code not hidden")
+)
+
+// voteScript records one voter's vote on a visible code, replacing any
+// earlier vote of theirs, and hides the code once the disputes reach the
+// threshold. It returns -1 for a code that isn't in the feed, otherwise the
+// confirmations, the disputes, 1 if the vote hid the code and the change of
+// this voter's confirmation (1, 0 or -1).
+//
+// KEYS: prelude keys, votes
+// ARGV: prelude args, code, voter, vote, dispute threshold
+var voteScript = redis.NewScript(feedScriptPrelude + `
+local votesKey = KEYS[8]
+local code, voter, vote = ARGV[5], 'voter:' .. ARGV[6], ARGV[7]
+local ts = redis.call('ZSCORE', timeKey, code)
+if not ts then
+	return -1
+end
+
+local previous = redis.call('HGET', votesKey, voter)
+local confirmed = 0
+if previous ~= vote then
+	if vote == 'confirm' then
+		confirmed = 1
+	elseif previous == 'confirm' then
+		confirmed = -1
+	end
+	if previous then
+		redis.call('HINCRBY', votesKey, previous, -1)
+	end
+	redis.call('HSET', votesKey, voter, vote)
+	redis.call('HINCRBY', votesKey, vote, 1)
+end
+
+local confirms = tonumber(redis.call('HGET', votesKey, 'confirm') or '0')
+local disputes = tonumber(redis.call('HGET', votesKey, 'dispute') or '0')
+redis.call('ZADD', confirmedKey, confirms, code)
+
+local hidden = 0
+if disputes >= tonumber(ARGV[8]) then
+	unindex(code, redis.call('SMEMBERS', serversKey))
+	redis.call('ZADD', hiddenKey, ts, code)
+	hidden = 1
+end
+return {confirms, disputes, hidden, confirmed}
+`)
+
+// Vote records a voter's confirm or dispute on a live code. Each voter (a
+// user ID or an anonymous submitter ID) holds one vote per code; voting again
+// replaces it. A code that reaches the dispute threshold leaves the feed until
+// an admin restores it.
+func (s *PriceService) Vote(ctx context.Context, code, voterID, vote string) (*model.VoteResult, error) {
+	code = normalizeFeedCode(code)
+	vote = strings.ToLower(strings.TrimSpace(vote))
+	if vote != VoteConfirm && vote != VoteDispute {
+		return nil, ErrInvalidVote
+	}
+	if code == "" || voterID == "" {
+		return nil, ErrCodeNotFound
+	}
+
+	keys := feedScriptKeys(keyCodePrefix + code + keyCodeVotesSuffix)
+	res, err := voteScript.Run(ctx, s.rdb, keys, feedScriptArgs(code, voterID, vote, s.opts.DisputeThreshold)...).Result()
+	if err != nil {
+		return nil, err
+	}
+	tally, ok := res.([]interface{})
+	if !ok || len(tally) != 4 {
+		return nil, ErrCodeNotFound
+	}
+
+	result := &model.VoteResult{Code: code}
+	result.Confirmations, _ = tally[0].(int64)
+	result.Disputes, _ = tally[1].(int64)
+	hidden, _ := tally[2].(int64)
+	result.Hidden = hidden == 1
+	if confirmed, _ := tally[3].(int64); confirmed != 0 && isUserSubmitter(voterID) {
+		// Confirmations earn the submitters reputation, but not their own,
+		// and only from users: guest identities are too cheap to vouch.
+		if submitters, err := codeSubmitters(ctx, s.rdb, code); err == nil {
+			s.creditSubmitters(ctx, submitters, voterID, reputationConfirmations, confirmed)
+		}
+	}
+	if result.Hidden {
+		s.publishFeedEvent(ctx, model.FeedEvent{Type: model.FeedEventDeletion, Code: code})
+	}
+	return result, nil
+}
+
+// AllowVote takes one of the client's vote slots for code. It reports false
+// once the client has used up its votes on that code for the window.
+func (s *PriceService) AllowVote(ctx context.Context, client, code string) (bool, error) {
+	window := time.Now().Truncate(voteLimitWindow).Unix()
+	counter := keyVoteLimitPrefix + client + ":" + normalizeFeedCode(code) + ":" + strconv.FormatInt(window, 10)
+	pipe := s.rdb.TxPipeline()
+	count := pipe.Incr(ctx, counter)
+	pipe.Expire(ctx, counter, voteLimitWindow)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+	return count.Val() <= voteLimit, nil
+}
+
+// ListHiddenCodes returns the codes hidden by disputes, most recently
+// updated first.
+func (s *PriceService) ListHiddenCodes(ctx context.Context) ([]model.PriceItem, error) {
+	codes, err := s.rdb.ZRevRange(ctx, keyFeedHidden, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.loadCodeRecords(ctx, codes)
+	if err != nil {
+		return nil, err
+	}
+	if items == nil {
+		items = []model.PriceItem{}
+	}
+	return items, nil
+}
+
+// RestoreCode puts a hidden code back into the feed after review. Its
+// disputes are cleared so the same voters can dispute it again; confirmations
+// are kept.
+func (s *PriceService) RestoreCode(ctx context.Context, code string) (*model.PriceItem, error) {
+	code = normalizeFeedCode(code)
+	recordKey := keyCodePrefix + code
+	votesKey := recordKey + keyCodeVotesSuffix
+
+	var restored *model.PriceItem
+	txf := func(tx *redis.Tx) error {
+		hidden, err := isHidden(ctx, tx, code)
+		if err != nil {
+			return err
+		}
+		if !hidden {
+			return ErrCodeNotHidden
+		}
+		record, err := loadCodeRecord(ctx, tx, code)
+		if err != nil {
+			return err
+		}
+		if record == nil {
+			return ErrCodeNotFound
+		}
+		votes, err := tx.HGetAll(ctx, votesKey).Result()
+		if err != nil {
+			return err
+		}
+		var disputers []string
+		for field, vote := range votes {
+			if strings.HasPrefix(field, "voter:") && vote == VoteDispute {
+				disputers = append(disputers, field)
+			}
+		}
+		confirms, _ := strconv.ParseInt(votes[VoteConfirm], 10, 64)
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.ZRem(ctx, keyFeedHidden, code)
+			if len(disputers) > 0 {
+				pipe.HDel(ctx, votesKey, disputers...)
+			}
+			pipe.HSet(ctx, votesKey, VoteDispute, 0)
+			indexRecord(ctx, pipe, *record, "")
+			pipe.ZAdd(ctx, keyFeedConfirmed, redis.Z{Score: float64(confirms), Member: code})
+			return nil
+		})
+		record.Confirmations = confirms
+		restored = record
+		return err
+	}
+
+	if err := s.watchRetry(ctx, txf, recordKey, votesKey, keyFeedHidden); err != nil {
+		return nil, err
+	}
+	s.publishFeedEvent(ctx, model.FeedEvent{Type: model.FeedEventUpdate, Code: code, Item: restored})
+	return restored, nil
+}
+
+func isHidden(ctx context.Context, rdb redis.Cmdable, code string) (bool, error) {
+	err := rdb.ZScore(ctx, keyFeedHidden, code).Err()
+	if err == redis.Nil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// voteCounts reads the confirm and dispute tallies of an HMGET reply.
+func voteCounts(vals []interface{}) (int64, int64) {
+	var counts [2]int64
+	for i := 0; i < len(vals) && i < 2; i++ {
+		if raw, ok := vals[i].(string); ok {
+			counts[i], _ = strconv.ParseInt(raw, 10, 64)
+		}
+	}
+	return counts[0], counts[1]
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lingbao-market/backend/internal/model"
+)
+
+func newVoteTestService(t *testing.T) (*PriceService, string) {
+	t.Helper()
+	svc := NewPriceService(testRedis(t), PriceServiceOptions{DisputeThreshold: 2})
+	item, err := svc.AddPrice(context.Background(), model.PriceItem{Code: "abc123", Price: 1000, SubmitterID: "user-0"})
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	return svc, item.Code
+}
+
+func feedHasCode(t *testing.T, svc *PriceService, code string) bool {
+	t.Helper()
+	page, err := svc.GetFeed(context.Background(), FeedQuery{})
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	for _, item := range page.Items {
+		if item.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+func TestVoteReplacesEarlierVote(t *testing.T) {
+	svc, code := newVoteTestService(t)
+	ctx := context.Background()
+
+	result, err := svc.Vote(ctx, code, "user-1", VoteConfirm)
+	if err != nil || result.Confirmations != 1 || result.Disputes != 0 {
+		t.Fatalf("expected 1/0, got %+v (%v)", result, err)
+	}
+	result, err = svc.Vote(ctx, code, "user-1", VoteConfirm)
+	if err != nil || result.Confirmations != 1 {
+		t.Fatalf("expected a repeated vote to count once, got %+v (%v)", result, err)
+	}
+	result, err = svc.Vote(ctx, code, "user-1", VoteDispute)
+	if err != nil || result.Confirmations != 0 || result.Disputes != 1 || result.Hidden {
+		t.Fatalf("expected the dispute to replace the confirmation, got %+v (%v)", result, err)
+	}
+}
+
+func TestVoteThresholdHidesCode(t *testing.T) {
+	svc, code := newVoteTestService(t)
+	ctx := context.Background()
+
+	if _, err := svc.Vote(ctx, code, "user-1", VoteDispute); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if !feedHasCode(t, svc, code) {
+		t.Fatalf("expected %s to stay below the threshold", code)
+	}
+
+	result, err := svc.Vote(ctx, code, "user-2", VoteDispute)
+	if err != nil || !result.Hidden || result.Disputes != 2 {
+		t.Fatalf("expected the second dispute to hide the code, got %+v (%v)", result, err)
+	}
+	if feedHasCode(t, svc, code) {
+		t.Fatalf("expected %s to leave the feed", code)
+	}
+	hidden, err := svc.ListHiddenCodes(ctx)
+	if err != nil || len(hidden) != 1 || hidden[0].Code != code {
+		t.Fatalf("expected %s to be listed as hidden, got %+v (%v)", code, hidden, err)
+	}
+	if _, err := svc.Vote(ctx, code, "user-3", VoteConfirm); !errors.Is(err, ErrCodeNotFound) {
+		t.Fatalf("expected ErrCodeNotFound for a hidden code, got %v", err)
+	}
+}
+
+func TestRestoreCodeLetsDisputersVoteAgain(t *testing.T) {
+	svc, code := newVoteTestService(t)
+	ctx := context.Background()
+
+	if _, err := svc.Vote(ctx, code, "user-3", VoteConfirm); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	for _, voter := range []string{"user-1", "user-2"} {
+		if _, err := svc.Vote(ctx, code, voter, VoteDispute); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+	}
+
+	restored, err := svc.RestoreCode(ctx, code)
+	if err != nil || restored.Confirmations != 1 {
+		t.Fatalf("expected the confirmation to survive the restore, got %+v (%v)", restored, err)
+	}
+	if !feedHasCode(t, svc, code) {
+		t.Fatalf("expected %s back in the feed", code)
+	}
+	if _, err := svc.RestoreCode(ctx, code); !errors.Is(err, ErrCodeNotHidden) {
+		t.Fatalf("expected ErrCodeNotHidden, got %v", err)
+	}
+
+	result, err := svc.Vote(ctx, code, "user-1", VoteDispute)
+	if err != nil || result.Disputes != 1 || result.Confirmations != 1 || result.Hidden {
+		t.Fatalf("expected the disputer to vote again from zero, got %+v (%v)", result, err)
+	}
+}
+
+func TestAllowVote(t *testing.T) {
+	svc := NewPriceService(testRedis(t), PriceServiceOptions{})
+	ctx := context.Background()
+
+	for i := 0; i < voteLimit; i++ {
+		if ok, err := svc.AllowVote(ctx, "203.0.113.7", "ABC123"); err != nil || !ok {
+			t.Fatalf("vote %d: expected allowed, got %v (%v)", i+1, ok, err)
+		}
+	}
+	if ok, _ := svc.AllowVote(ctx, "203.0.113.7", "abc123"); ok {
+		t.Fatalf("expected the client to run out of votes on the code")
+	}
+	if ok, _ := svc.AllowVote(ctx, "203.0.113.7", "XYZ789"); !ok {
+		t.Fatalf("expected another code to have its own limit")
+	}
+}
+
+func TestVoteCounts(t *testing.T) {
+	t.Parallel()
+
+	confirms, disputes := voteCounts([]interface{}{"4", nil})
+	if confirms != 4 || disputes != 0 {
+		t.Fatalf("expected 4/0, got %d/%d", confirms, disputes)
+	}
+	confirms, disputes = voteCounts(nil)
+	if confirms != 0 || disputes != 0 {
+		t.Fatalf("expected 0/0, got %d/%d", confirms, disputes)
+	}
+}
+
+func TestNormalizeFeedSort(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"":          "time",
+		"time":      "time",
+		"price":     "price",
+		"confirmed": "confirmed",
+		"bogus":     "time",
+	}
+	for in, want := range cases {
+		if got := normalizeFeedSort(in); got != want {
+			t.Fatalf("%q: expected %q, got %q", in, want, got)
+		}
+	}
+}
+
+func TestOnlyUserConfirmationsEarnReputation(t *testing.T) {
+	svc, code := newVoteTestService(t)
+	ctx := context.Background()
+
+	for _, voter := range []string{AnonymousSubmitterPrefix + "guest", "user-0", "user-1"} {
+		if _, err := svc.Vote(ctx, code, voter, VoteConfirm); err != nil {
+			t.Fatalf("%s: expected nil error, got %v", voter, err)
+		}
+	}
+	rep, err := svc.GetReputation(ctx, "user-0")
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if rep.Confirmations != 1 {
+		t.Fatalf("expected only the other user's confirmation to count, got %+v", rep)
+	}
+}
@@ -5,10 +5,30 @@ import { serverApiUrl } from "@/lib/api"
 
 type LoginResponse = {
   token: string;
+  refreshToken: string;
+  expiresIn: number;
   username: string;
   id: string;
   isAdmin: boolean;
 }
+
+// Renew a little before the access token runs out.
+const REFRESH_MARGIN_MS = 30 * 1000
+
+async function refreshAccessToken(refreshToken: string): Promise<LoginResponse | null> {
+  try {
+    const res = await fetch(serverApiUrl("/api/v1/auth/refresh"), {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ refreshToken }),
+    });
+    if (!res.ok) return null;
+    return (await res.json()) as LoginResponse;
+  } catch (e) {
+    console.error("Token refresh error:", e)
+    return null
+  }
+}
  
 export const { handlers, signIn, signOut, auth } = NextAuth({
   providers: [
@@ -45,6 +65,8 @@ export const { handlers, signIn, signOut, auth } = NextAuth({
                 id: user.id,
                 name: user.username,
                 accessToken: user.token,
+                refreshToken: user.refreshToken,
+                accessTokenExpires: Date.now() + user.expiresIn * 1000,
                 isAdmin: user.isAdmin,
             }
           }
@@ -62,9 +84,41 @@ export const { handlers, signIn, signOut, auth } = NextAuth({
         if (typeof user.accessToken === 'string') {
           token.accessToken = user.accessToken
         }
+        if (typeof user.refreshToken === 'string') {
+          token.refreshToken = user.refreshToken
+        }
+        if (typeof user.accessTokenExpires === 'number') {
+          token.accessTokenExpires = user.accessTokenExpires
+        }
         token.id = user.id
         token.isAdmin = Boolean(user.isAdmin)
+        return token
+      }
+
+      if (!token.refreshToken) {
+        // Sessions from before refresh tokens hold a token the backend no
+        // longer accepts; drop it so the user signs in again.
+        delete token.accessToken
+        delete token.accessTokenExpires
+        return token
       }
+      if (!token.accessTokenExpires ||
+          Date.now() < token.accessTokenExpires - REFRESH_MARGIN_MS) {
+        return token
+      }
+
+      const refreshed = await refreshAccessToken(token.refreshToken)
+      if (!refreshed?.token) {
+        // Revoked or expired: drop the credentials so the user signs in again.
+        delete token.accessToken
+        delete token.refreshToken
+        delete token.accessTokenExpires
+        return token
+      }
+      token.accessToken = refreshed.token
+      token.refreshToken = refreshed.refreshToken
+      token.accessTokenExpires = Date.now() + refreshed.expiresIn * 1000
+      token.isAdmin = Boolean(refreshed.isAdmin)
       return token
     },
     session: async ({ session, token }) => {
@@ -85,4 +139,19 @@ export const { handlers, signIn, signOut, auth } = NextAuth({
       return !!auth
     },
   },
+  events: {
+    signOut: async (message) => {
+      const token = 'token' in message ? message.token : null
+      if (!token?.refreshToken) return
+      try {
+        await fetch(serverApiUrl("/api/v1/auth/logout"), {
+          method: "POST",
+          headers: { "Content-Type": "application/json" },
+          body: JSON.stringify({ refreshToken: token.refreshToken }),
+        });
+      } catch (e) {
+        console.error("Logout error:", e)
+      }
+    },
+  },
 })
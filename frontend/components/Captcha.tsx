@@ -0,0 +1,217 @@
+'use client';
+
+import { useCallback, useEffect, useRef, useState } from 'react';
+import { Loader2, ShieldCheck } from 'lucide-react';
+import { Input } from "@/components/ui/input";
+import { Button } from "@/components/ui/button";
+import { useTranslations } from 'next-intl';
+import { apiUrl } from '@/lib/api';
+
+type CaptchaChallenge = {
+  provider: string;
+  captchaId?: string;
+  image?: string;
+  siteKey?: string;
+  challenge?: string;
+  difficulty?: number;
+};
+
+export type CaptchaValue = {
+  captchaId: string;
+  answer: string;
+};
+
+export const emptyCaptcha: CaptchaValue = { captchaId: '', answer: '' };
+
+type CaptchaProps = {
+  onChange: (value: CaptchaValue) => void;
+  onError: (message: string) => void;
+  // Bump reloadKey to fetch a fresh challenge, e.g. after a failed attempt.
+  reloadKey: number;
+};
+
+// Turnstile, hCaptcha and reCAPTCHA all expose this explicit-render API.
+type WidgetApi = {
+  render: (container: HTMLElement, options: Record<string, unknown>) => string;
+  remove?: (widgetId: string) => void;
+};
+
+const widgetScriptUrl =
+  process.env.NEXT_PUBLIC_CAPTCHA_SCRIPT_URL ||
+  'https://challenges.cloudflare.com/turnstile/v0/api.js?render=explicit';
+
+let widgetScript: Promise<WidgetApi> | null = null;
+
+function findWidgetApi(): WidgetApi | undefined {
+  const globals = window as unknown as Record<string, WidgetApi | undefined>;
+  return globals.turnstile || globals.hcaptcha || globals.grecaptcha;
+}
+
+function loadWidgetScript(): Promise<WidgetApi> {
+  if (!widgetScript) {
+    widgetScript = new Promise((resolve, reject) => {
+      const script = document.createElement('script');
+      script.src = widgetScriptUrl;
+      script.async = true;
+      script.onload = () => {
+        const api = findWidgetApi();
+        if (api) {
+          resolve(api);
+        } else {
+          reject(new Error('captcha widget not found'));
+        }
+      };
+      script.onerror = () => {
+        widgetScript = null;
+        reject(new Error('captcha widget failed to load'));
+      };
+      document.head.appendChild(script);
+    });
+  }
+  return widgetScript;
+}
+
+function getErrorMessage(error: unknown, fallback: string): string {
+  if (error instanceof Error && error.message) {
+    return error.message;
+  }
+  return fallback;
+}
+
+// Captcha renders whichever challenge the backend is configured for: an
+// image to type back, a proof of work solved in a worker, or a remote widget.
+export default function Captcha({ onChange, onError, reloadKey }: CaptchaProps) {
+  const t = useTranslations('Auth');
+  const [challenge, setChallenge] = useState<CaptchaChallenge | null>(null);
+  const [input, setInput] = useState('');
+  const [solved, setSolved] = useState(false);
+  const widgetRef = useRef<HTMLDivElement>(null);
+
+  const loadCaptcha = useCallback(async () => {
+    try {
+      const res = await fetch(apiUrl('/api/v1/auth/captcha'));
+      if (!res.ok) {
+        throw new Error(t('error_captcha_load'));
+      }
+      const data = (await res.json()) as CaptchaChallenge;
+      if (!['image', 'pow', 'remote'].includes(data.provider)) {
+        throw new Error(t('error_captcha_unsupported'));
+      }
+      setChallenge(data);
+    } catch (error) {
+      setChallenge(null);
+      onError(getErrorMessage(error, t('error_captcha_load')));
+    } finally {
+      setInput('');
+      setSolved(false);
+      onChange(emptyCaptcha);
+    }
+  }, [onChange, onError, t]);
+
+  useEffect(() => {
+    void loadCaptcha();
+  }, [loadCaptcha, reloadKey]);
+
+  useEffect(() => {
+    if (challenge?.provider !== 'pow' || !challenge.challenge) {
+      return;
+    }
+    const worker = new Worker(new URL('../lib/pow.worker.ts', import.meta.url));
+    worker.onmessage = (event: MessageEvent<string>) => {
+      setSolved(true);
+      onChange({ captchaId: challenge.captchaId || '', answer: event.data });
+    };
+    worker.postMessage({ challenge: challenge.challenge, difficulty: challenge.difficulty || 0 });
+    return () => worker.terminate();
+  }, [challenge, onChange]);
+
+  useEffect(() => {
+    const container = widgetRef.current;
+    if (challenge?.provider !== 'remote' || !challenge.siteKey || !container) {
+      return;
+    }
+    let cancelled = false;
+    let api: WidgetApi | undefined;
+    let widgetId: string | undefined;
+    loadWidgetScript()
+      .then((loaded) => {
+        if (cancelled) {
+          return;
+        }
+        api = loaded;
+        widgetId = loaded.render(container, {
+          sitekey: challenge.siteKey,
+          callback: (token: string) => onChange({ captchaId: '', answer: token }),
+          'expired-callback': () => onChange(emptyCaptcha),
+        });
+      })
+      .catch(() => onError(t('error_captcha_load')));
+    return () => {
+      cancelled = true;
+      if (api?.remove && widgetId !== undefined) {
+        api.remove(widgetId);
+      }
+      container.innerHTML = '';
+    };
+  }, [challenge, onChange, onError, t]);
+
+  if (challenge?.provider === 'remote') {
+    return (
+      <div className="space-y-2">
+        <label className="text-sm font-medium">{t('captcha_label')}</label>
+        <div ref={widgetRef} className="min-h-[65px]" />
+      </div>
+    );
+  }
+
+  if (challenge?.provider === 'pow') {
+    return (
+      <div className="space-y-2">
+        <label className="text-sm font-medium">{t('captcha_label')}</label>
+        <div className="flex items-center h-10 px-3 rounded-md border text-sm text-muted-foreground">
+          {solved ? (
+            <>
+              <ShieldCheck className="w-4 h-4 mr-2 text-primary" /> {t('captcha_pow_solved')}
+            </>
+          ) : (
+            <>
+              <Loader2 className="w-4 h-4 mr-2 animate-spin" /> {t('captcha_pow_solving')}
+            </>
+          )}
+        </div>
+      </div>
+    );
+  }
+
+  return (
+    <div className="space-y-2">
+      <label className="text-sm font-medium">{t('captcha_label')}</label>
+      <div className="flex gap-2">
+        <Input
+          type="text"
+          placeholder={t('captcha_placeholder')}
+          value={input}
+          onChange={(e) => {
+            setInput(e.target.value);
+            onChange({ captchaId: challenge?.captchaId || '', answer: e.target.value.trim() });
+          }}
+          required
+        />
+        <Button
+          type="button"
+          variant="outline"
+          onClick={loadCaptcha}
+          className="min-w-[130px] h-10 p-0 overflow-hidden"
+          aria-label={t('captcha_label')}
+        >
+          {challenge?.image ? (
+            // eslint-disable-next-line @next/next/no-img-element
+            <img src={challenge.image} alt={t('captcha_label')} className="h-full w-full object-contain" />
+          ) : (
+            '----'
+          )}
+        </Button>
+      </div>
+    </div>
+  );
+}
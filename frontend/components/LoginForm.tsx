@@ -1,6 +1,6 @@
 'use client';
 
-import { useCallback, useEffect, useState } from 'react';
+import { useCallback, useState } from 'react';
 import { AlertCircle, Eye, EyeOff, Loader2, LogIn } from 'lucide-react';
 import { getSession, signIn } from 'next-auth/react';
 import { Input } from "@/components/ui/input";
@@ -9,69 +9,42 @@ import { Card, CardContent, CardDescription, CardHeader, CardTitle } from "@/com
 import { useTranslations } from 'next-intl';
 import { useRouter } from '@/i18n/navigation';
 import { apiUrl } from '@/lib/api';
-
-type CaptchaResponse = {
-  captchaId: string;
-  code: string;
-};
-
-function getErrorMessage(error: unknown, fallback: string): string {
-  if (error instanceof Error && error.message) {
-    return error.message;
-  }
-  return fallback;
-}
+import Captcha, { emptyCaptcha, type CaptchaValue } from '@/components/Captcha';
 
 export default function LoginForm() {
   const t = useTranslations('Auth');
   const [username, setUsername] = useState('');
   const [password, setPassword] = useState('');
   const [showPassword, setShowPassword] = useState(false);
-  const [captchaId, setCaptchaId] = useState('');
-  const [captchaValue, setCaptchaValue] = useState('');
-  const [captchaInput, setCaptchaInput] = useState('');
+  const [captcha, setCaptcha] = useState<CaptchaValue>(emptyCaptcha);
+  const [captchaKey, setCaptchaKey] = useState(0);
   const [loading, setLoading] = useState(false);
   const [error, setError] = useState('');
   const router = useRouter();
 
-  const loadCaptcha = useCallback(async () => {
-    try {
-      const res = await fetch(apiUrl('/api/v1/auth/captcha'));
-      if (!res.ok) {
-        throw new Error(t('error_captcha_load'));
-      }
-      const data = (await res.json()) as CaptchaResponse;
-      setCaptchaId(data.captchaId || '');
-      setCaptchaValue(data.code || '');
-      setCaptchaInput('');
-    } catch (error) {
-      setCaptchaId('');
-      setCaptchaValue('');
-      setError(getErrorMessage(error, t('error_captcha_load')));
-    }
-  }, [t]);
-
-  useEffect(() => {
-    void loadCaptcha();
-  }, [loadCaptcha]);
+  const reloadCaptcha = useCallback(() => setCaptchaKey((key) => key + 1), []);
 
   const handleSubmit = async (e: React.FormEvent) => {
     e.preventDefault();
     setError('');
+    if (!captcha.answer) {
+      setError(t('error_captcha_required'));
+      return;
+    }
     setLoading(true);
 
     try {
       const result = await signIn('credentials', {
         username: username.trim(),
         password,
-        captchaId,
-        captchaCode: captchaInput.trim(),
+        captchaId: captcha.captchaId,
+        captchaCode: captcha.answer,
         redirect: false,
       });
 
       if (result?.error) {
         setError(t('error_invalid_credentials'));
-        void loadCaptcha();
+        reloadCaptcha();
         return;
       }
 
@@ -91,7 +64,7 @@ export default function LoginForm() {
       router.push('/');
     } catch {
       setError(t('error_login_failed'));
-      void loadCaptcha();
+      reloadCaptcha();
     } finally {
       setLoading(false);
     }
@@ -140,26 +113,7 @@ export default function LoginForm() {
               </button>
             </div>
           </div>
-          <div className="space-y-2">
-            <label className="text-sm font-medium">{t('captcha_label')}</label>
-            <div className="flex gap-2">
-              <Input
-                type="text"
-                placeholder={t('captcha_placeholder')}
-                value={captchaInput}
-                onChange={(e) => setCaptchaInput(e.target.value)}
-                required
-              />
-              <Button
-                type="button"
-                variant="outline"
-                onClick={loadCaptcha}
-                className="min-w-[110px] font-mono tracking-widest"
-              >
-                {captchaValue || '----'}
-              </Button>
-            </div>
-          </div>
+          <Captcha onChange={setCaptcha} onError={setError} reloadKey={captchaKey} />
 
           {error && (
             <div className="bg-destructive/10 text-destructive text-sm p-3 rounded-md flex items-center">
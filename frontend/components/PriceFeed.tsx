@@ -16,6 +16,11 @@ interface PriceItem {
   ts: number;
 }
 
+interface FeedPage {
+  items: PriceItem[];
+  nextCursor?: string;
+}
+
 const fetcher = (url: string) => fetch(url).then((res) => res.json());
 
 export default function PriceFeed() {
@@ -28,22 +33,39 @@ export default function PriceFeed() {
   const token = (session as { accessToken?: string } | null)?.accessToken;
   const isAdmin = Boolean((session as { user?: { isAdmin?: boolean } } | null)?.user?.isAdmin);
   
-  const { data: prices, error, isLoading, mutate } = useSWR<PriceItem[]>(
+  const { data, error, isLoading, mutate } = useSWR<FeedPage>(
     apiUrl(`/api/v1/feed?sort=${sortBy}`),
     fetcher,
     { 
-      refreshInterval: 10000,
+      refreshInterval: 60000, // Fallback; live updates arrive over SSE
       revalidateOnFocus: false, // Don't spam when tab switching
       errorRetryCount: 3
     }
   );
+  const prices = data?.items;
+
+  useEffect(() => {
+    if (typeof EventSource === 'undefined') {
+      return;
+    }
+    const source = new EventSource(apiUrl('/api/v1/feed/stream'));
+    const refresh = () => void mutate();
+    const eventTypes = ['submission', 'update', 'deletion', 'reset'];
+    eventTypes.forEach((type) => source.addEventListener(type, refresh));
+    return () => {
+      eventTypes.forEach((type) => source.removeEventListener(type, refresh));
+      source.close();
+    };
+  }, [mutate]);
 
   const handleDeleted = useCallback(
     (code: string, removed: boolean) => {
       if (removed) {
-        void mutate((current) => current?.filter((item) => item.code !== code), {
-          revalidate: true,
-        });
+        void mutate(
+          (current) =>
+            current && { ...current, items: current.items.filter((item) => item.code !== code) },
+          { revalidate: true }
+        );
         return;
       }
       void mutate();
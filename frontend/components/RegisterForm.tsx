@@ -1,6 +1,6 @@
 'use client';
 
-import { useCallback, useEffect, useState } from 'react';
+import { useCallback, useState } from 'react';
 import { Loader2, UserPlus, AlertCircle, Eye, EyeOff } from 'lucide-react';
 import { Input } from "@/components/ui/input";
 import { Button } from "@/components/ui/button";
@@ -8,11 +8,7 @@ import { Card, CardContent, CardHeader, CardTitle, CardDescription } from "@/com
 import { useTranslations } from 'next-intl';
 import { useRouter } from '@/i18n/navigation';
 import { apiUrl } from "@/lib/api";
-
-type CaptchaResponse = {
-  captchaId: string;
-  code: string;
-};
+import Captcha, { emptyCaptcha, type CaptchaValue } from '@/components/Captcha';
 
 type ErrorResponse = {
   error?: string;
@@ -32,33 +28,13 @@ export default function RegisterForm() {
   const [confirmPassword, setConfirmPassword] = useState('');
   const [showPassword, setShowPassword] = useState(false);
   const [showConfirmPassword, setShowConfirmPassword] = useState(false);
-  const [captchaId, setCaptchaId] = useState('');
-  const [captchaValue, setCaptchaValue] = useState('');
-  const [captchaInput, setCaptchaInput] = useState('');
+  const [captcha, setCaptcha] = useState<CaptchaValue>(emptyCaptcha);
+  const [captchaKey, setCaptchaKey] = useState(0);
   const [loading, setLoading] = useState(false);
   const [error, setError] = useState('');
   const router = useRouter();
 
-  const loadCaptcha = useCallback(async () => {
-    try {
-      const res = await fetch(apiUrl('/api/v1/auth/captcha'));
-      if (!res.ok) {
-        throw new Error(t('error_captcha_load'));
-      }
-      const data = (await res.json()) as CaptchaResponse;
-      setCaptchaId(data.captchaId || '');
-      setCaptchaValue(data.code || '');
-      setCaptchaInput('');
-    } catch (error) {
-      setCaptchaId('');
-      setCaptchaValue('');
-      setError(getErrorMessage(error, t('error_captcha_load')));
-    }
-  }, [t]);
-
-  useEffect(() => {
-    void loadCaptcha();
-  }, [loadCaptcha]);
+  const reloadCaptcha = useCallback(() => setCaptchaKey((key) => key + 1), []);
 
   const handleSubmit = async (e: React.FormEvent) => {
     e.preventDefault();
@@ -70,7 +46,7 @@ export default function RegisterForm() {
       setLoading(false);
       return;
     }
-    if (!captchaInput.trim() || !captchaId) {
+    if (!captcha.answer) {
       setError(t('error_captcha_required'));
       setLoading(false);
       return;
@@ -83,8 +59,8 @@ export default function RegisterForm() {
         body: JSON.stringify({
           username: username.trim(),
           password,
-          captchaId,
-          captchaCode: captchaInput.trim(),
+          captchaId: captcha.captchaId,
+          captchaCode: captcha.answer,
         }),
       });
 
@@ -96,7 +72,7 @@ export default function RegisterForm() {
       router.push('/auth/login');
     } catch (error) {
       setError(getErrorMessage(error, t('error_login_failed')));
-      void loadCaptcha();
+      reloadCaptcha();
     } finally {
       setLoading(false);
     }
@@ -167,26 +143,7 @@ export default function RegisterForm() {
               </button>
             </div>
           </div>
-          <div className="space-y-2">
-            <label className="text-sm font-medium">{t('captcha_label')}</label>
-            <div className="flex gap-2">
-              <Input
-                type="text"
-                placeholder={t('captcha_placeholder')}
-                value={captchaInput}
-                onChange={(e) => setCaptchaInput(e.target.value)}
-                required
-              />
-              <Button
-                type="button"
-                variant="outline"
-                onClick={loadCaptcha}
-                className="min-w-[110px] font-mono tracking-widest"
-              >
-                {captchaValue || '----'}
-              </Button>
-            </div>
-          </div>
+          <Captcha onChange={setCaptcha} onError={setError} reloadKey={captchaKey} />
 
           {error && (
             <div className="bg-destructive/10 text-destructive text-sm p-3 rounded-md flex items-center">
@@ -15,6 +15,26 @@ type ParsedListingPaste = {
 
 const CODE_INPUT_MAX_LENGTH = 12;
 const PRICE_MAX = 999;
+// Guests keep the submitter token the backend hands out so they can manage
+// their own submissions later.
+const SUBMITTER_TOKEN_KEY = 'submitterToken';
+
+function readSubmitterToken(): string | undefined {
+  try {
+    return window.localStorage.getItem(SUBMITTER_TOKEN_KEY) ?? undefined;
+  } catch {
+    return undefined;
+  }
+}
+
+function storeSubmitterToken(token: unknown) {
+  if (typeof token !== 'string' || !token) return;
+  try {
+    window.localStorage.setItem(SUBMITTER_TOKEN_KEY, token);
+  } catch {
+    // Storage may be unavailable (private mode); the token is then per-visit.
+  }
+}
 
 function getAccessToken(session: unknown): string | undefined {
   if (!session || typeof session !== 'object') return undefined;
@@ -136,6 +156,10 @@ export default function SubmitForm() {
       if (token) {
         headers.Authorization = `Bearer ${token}`;
       }
+      const submitterToken = readSubmitterToken();
+      if (submitterToken) {
+        headers['X-Submitter-Token'] = submitterToken;
+      }
       const res = await fetch(apiUrl('/api/v1/submit'), {
         method: 'POST',
         headers,
@@ -145,7 +169,11 @@ export default function SubmitForm() {
           server: 'S1'
         }),
       });
+      // The backend re-issues a token signed with a retiring key.
+      storeSubmitterToken(res.headers.get('X-Submitter-Token'));
       if (res.ok) {
+        const data = await res.json().catch(() => null);
+        storeSubmitterToken(data?.submitterToken);
         setCode('');
         setPrice('');
       }
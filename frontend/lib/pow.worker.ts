@@ -0,0 +1,16 @@
+import { solvePow } from './pow';
+
+type PowRequest = {
+  challenge: string;
+  difficulty: number;
+};
+
+// Solves one challenge off the main thread and posts back the nonce. The
+// page terminates the worker when it loads a new challenge.
+self.onmessage = (event: MessageEvent<PowRequest>) => {
+  const { challenge, difficulty } = event.data;
+  const nonce = solvePow(challenge, difficulty, 0, Number.MAX_SAFE_INTEGER);
+  if (nonce !== null) {
+    self.postMessage(nonce);
+  }
+};
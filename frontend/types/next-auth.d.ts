@@ -11,6 +11,8 @@ declare module 'next-auth' {
 
   interface User {
     accessToken?: string;
+    refreshToken?: string;
+    accessTokenExpires?: number;
     isAdmin?: boolean;
   }
 }
@@ -18,6 +20,8 @@ declare module 'next-auth' {
 declare module 'next-auth/jwt' {
   interface JWT {
     accessToken?: string;
+    refreshToken?: string;
+    accessTokenExpires?: number;
     id?: string;
     isAdmin?: boolean;
   }